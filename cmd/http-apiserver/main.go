@@ -1,15 +1,174 @@
 package main
 
 import (
-	"os"
+	"context"
+	"log"
 
+	"github.com/hekike/outlier-istio/pkg/cache"
+	"github.com/hekike/outlier-istio/pkg/config"
+	"github.com/hekike/outlier-istio/pkg/dump"
+	"github.com/hekike/outlier-istio/pkg/prometheus"
 	"github.com/hekike/outlier-istio/pkg/router"
+	"github.com/hekike/outlier-istio/pkg/source"
 )
 
 func main() {
-	promAddr := os.Getenv("PROMETHEUS_HOST")
-	webDistPath := os.Getenv("WEB_DIST_PATH")
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	r := router.Setup(promAddr, webDistPath)
+	metricsSource, err := newMetricsSource(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cfg.MetricsSource.Cache.TTL > 0 {
+		metricsSource = cache.New(metricsSource, cache.Options{
+			TTL:        cfg.MetricsSource.Cache.TTL,
+			MaxEntries: cfg.MetricsSource.Cache.MaxEntries,
+		})
+	}
+
+	r := router.Setup(metricsSource, cfg.WebDistPath, router.Options{
+		Detector:          cfg.Detector,
+		LatencyThresholds: cfg.LatencyThresholds,
+	})
 	r.Run() // listen and serve on 0.0.0.0:8080
 }
+
+func newMetricsSource(cfg config.Config) (source.MetricsSource, error) {
+	if cfg.MetricsSource.Type == config.SourceFile {
+		return dump.NewSource(cfg.MetricsSource.Address, dump.Options{
+			RateWindow: cfg.MetricsSource.RateWindow,
+		})
+	}
+
+	options := prometheus.Options{
+		Timeout:             cfg.MetricsSource.QueryTimeout,
+		MaxIdleConnsPerHost: cfg.MetricsSource.MaxIdleConns,
+		MaxPoints:           cfg.MetricsSource.MaxPoints,
+		MaxPointsPerQuery:   cfg.MetricsSource.MaxPointsPerQuery,
+		RateWindow:          cfg.MetricsSource.RateWindow,
+		ScrapeInterval:      cfg.MetricsSource.ScrapeInterval,
+		MinSamplesPerWindow: cfg.MetricsSource.MinSamplesPerWindow,
+		BearerToken:         cfg.MetricsSource.Auth.BearerToken,
+		BearerTokenFile:     cfg.MetricsSource.Auth.BearerTokenFile,
+		Headers:             cfg.MetricsSource.Auth.Headers,
+		TLS: prometheus.TLSOptions{
+			CAFile:             cfg.MetricsSource.TLS.CAFile,
+			CertFile:           cfg.MetricsSource.TLS.CertFile,
+			KeyFile:            cfg.MetricsSource.TLS.KeyFile,
+			ServerName:         cfg.MetricsSource.TLS.ServerName,
+			InsecureSkipVerify: cfg.MetricsSource.TLS.InsecureSkipVerify,
+		},
+		Filters: cfg.Filters,
+	}
+	if cfg.MetricsSource.Schema != config.SchemaAuto {
+		profile, err := prometheus.GetProfile(cfg.MetricsSource.Schema)
+		if err != nil {
+			return nil, err
+		}
+		options.Profile = &profile
+	}
+	if cfg.MetricsSource.Auth.BasicAuthUsername != "" {
+		options.BasicAuth = &prometheus.BasicAuth{
+			Username: cfg.MetricsSource.Auth.BasicAuthUsername,
+			Password: cfg.MetricsSource.Auth.BasicAuthPassword,
+		}
+	}
+
+	// The schema and the scrape interval are not detected, remote read
+	// endpoints don't serve the HTTP API
+	if cfg.MetricsSource.Type == config.SourceRemoteRead {
+		return prometheus.NewRemoteReadSource(
+			cfg.MetricsSource.Address,
+			options,
+		)
+	}
+
+	metricsSource, err := newPrometheusSource(cfg, options)
+	if err != nil {
+		return nil, err
+	}
+	detectProfile := options.Profile == nil
+	detectScrapeInterval := options.ScrapeInterval == 0 &&
+		options.RateWindow == 0
+	if !detectProfile && !detectScrapeInterval &&
+		!cfg.MetricsSource.RecordingRules {
+		return metricsSource, nil
+	}
+
+	// Detect the metric schema and the scrape interval with the default
+	// options' client, without a timeout the queries use the default
+	// timeout of the source
+	ctx := context.Background()
+	if cfg.MetricsSource.QueryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.MetricsSource.QueryTimeout)
+		defer cancel()
+	}
+	if detectProfile {
+		profile, err := prometheus.DetectProfile(ctx, metricsSource)
+		if err != nil {
+			log.Printf(
+				"metric schema detection failed, using %s: %v",
+				prometheus.IstioMixer.Name,
+				err,
+			)
+		} else {
+			log.Printf("detected metric schema: %s", profile.Name)
+			options.Profile = &profile
+		}
+	}
+	if detectScrapeInterval {
+		interval, err := prometheus.DetectScrapeInterval(ctx, metricsSource)
+		if err != nil {
+			log.Printf(
+				"scrape interval detection failed, using %s rate window: %v",
+				prometheus.DefaultRateWindow,
+				err,
+			)
+		} else {
+			log.Printf("detected scrape interval: %s", interval)
+			options.ScrapeInterval = interval
+		}
+	}
+	if detectProfile || detectScrapeInterval {
+		metricsSource, err = newPrometheusSource(cfg, options)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !cfg.MetricsSource.RecordingRules {
+		return metricsSource, nil
+	}
+
+	// Recorded series of the detected schema and rate window
+	profile, err := prometheus.DetectRecordingRules(ctx, metricsSource)
+	if err != nil {
+		log.Printf("recorded series are not used: %v", err)
+		return metricsSource, nil
+	}
+	log.Printf("using recorded series over %s", profile.RecordedWindow)
+	options.Profile = &profile
+	return newPrometheusSource(cfg, options)
+}
+
+func newPrometheusSource(
+	cfg config.Config,
+	options prometheus.Options,
+) (*prometheus.Source, error) {
+	switch cfg.MetricsSource.Type {
+	case config.SourceThanos:
+		return prometheus.NewThanosSource(
+			cfg.MetricsSource.Address,
+			options,
+			prometheus.ThanosOptions{
+				Dedup:           cfg.MetricsSource.Thanos.Dedup,
+				PartialResponse: cfg.MetricsSource.Thanos.PartialResponse,
+			},
+		)
+	default:
+		return prometheus.NewSource(cfg.MetricsSource.Address, options)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/hekike/outlier-istio/pkg/prometheus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Generates the Prometheus recording rules of the rates the queries are
+// built from
+func main() {
+	schema := flag.String(
+		"schema",
+		prometheus.IstioMixer.Name,
+		"metric schema profile",
+	)
+	window := flag.Duration("window", prometheus.DefaultRateWindow, "rate window")
+	output := flag.String("output", "", "rules file, stdout when empty")
+	flag.Parse()
+
+	profile, err := prometheus.GetProfile(*schema)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rules, err := yaml.Marshal(prometheus.RecordingRules(profile, *window))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *output == "" {
+		_, err = os.Stdout.Write(rules)
+	} else {
+		err = ioutil.WriteFile(*output, rules, 0644)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
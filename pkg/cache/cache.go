@@ -0,0 +1,326 @@
+// Package cache caches the results of a metrics source.
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hekike/outlier-istio/pkg/source"
+	promModel "github.com/prometheus/common/model"
+)
+
+// DefaultOptions are used for zero option values.
+var DefaultOptions = Options{
+	TTL:        30 * time.Second,
+	Step:       5 * time.Second,
+	MaxEntries: 1000,
+}
+
+// Options configures the cache.
+type Options struct {
+	// Time to keep the results for
+	TTL time.Duration
+	// Query ranges are snapped to the step of the range queries of the
+	// source, to Step when the source isn't a source.Stepper
+	Step time.Duration
+	// Maximum number of cached results
+	MaxEntries int
+}
+
+// Stats are the counters of the cache.
+type Stats struct {
+	// Results served from the cache
+	Hits uint64 `json:"hits"`
+	// Results fetched from the source
+	Misses uint64 `json:"misses"`
+	// Results shared with an identical in-flight request
+	Coalesced uint64 `json:"coalesced"`
+	// Requests skipping the cache
+	Bypassed uint64 `json:"bypassed"`
+	// Number of cached results
+	Entries int `json:"entries"`
+}
+
+// Cache is a MetricsSource caching the results of an other source.
+// Identical in-flight requests are coalesced into a single request.
+// It is safe to use from multiple goroutines.
+type Cache struct {
+	source  source.MetricsSource
+	options Options
+
+	mu       sync.Mutex
+	entries  map[string]entry
+	inFlight map[string]*call
+
+	hits      uint64
+	misses    uint64
+	coalesced uint64
+	bypassed  uint64
+}
+
+type entry struct {
+	value interface{}
+	// Warnings of the query, replayed to every caller
+	warnings  []string
+	expiresAt time.Time
+}
+
+// Request shared by the identical requests
+type call struct {
+	done     chan struct{}
+	value    interface{}
+	warnings []string
+	err      error
+	waiters  int
+	cancel   context.CancelFunc
+}
+
+// New creates a cache in front of the given source.
+func New(metricsSource source.MetricsSource, options Options) *Cache {
+	if options.TTL == 0 {
+		options.TTL = DefaultOptions.TTL
+	}
+	if options.Step == 0 {
+		options.Step = DefaultOptions.Step
+	}
+	if options.MaxEntries == 0 {
+		options.MaxEntries = DefaultOptions.MaxEntries
+	}
+	return &Cache{
+		source:   metricsSource,
+		options:  options,
+		entries:  make(map[string]entry),
+		inFlight: make(map[string]*call),
+	}
+}
+
+type bypassKey struct{}
+
+// WithBypass returns a context whose requests skip reading the cache.
+// The fetched results are still cached.
+func WithBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassKey{}, true)
+}
+
+func isBypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(bypassKey{}).(bool)
+	return bypass
+}
+
+// Stats returns the counters of the cache.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+
+	return Stats{
+		Hits:      atomic.LoadUint64(&c.hits),
+		Misses:    atomic.LoadUint64(&c.misses),
+		Coalesced: atomic.LoadUint64(&c.coalesced),
+		Bypassed:  atomic.LoadUint64(&c.bypassed),
+		Entries:   entries,
+	}
+}
+
+// Topology returns the cached topology of the signal.
+func (c *Cache) Topology(
+	ctx context.Context,
+	signal source.Signal,
+) (promModel.Vector, error) {
+	key := fmt.Sprintf("topology|%s", signal)
+	value, err := c.get(ctx, key, func(ctx context.Context) (interface{}, error) {
+		return c.source.Topology(ctx, signal)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(promModel.Vector), nil
+}
+
+// Edges returns the cached edges, the time range of the query is snapped to
+// the query step.
+func (c *Cache) Edges(
+	ctx context.Context,
+	query source.Query,
+) (promModel.Matrix, error) {
+	query = c.normalize(query)
+	key := "edges|" + queryKey(query)
+	value, err := c.get(ctx, key, func(ctx context.Context) (interface{}, error) {
+		return c.source.Edges(ctx, query)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(promModel.Matrix), nil
+}
+
+// Statuses returns the cached statuses, the time range of the query is
+// snapped to the query step.
+func (c *Cache) Statuses(
+	ctx context.Context,
+	query source.Query,
+) (promModel.Matrix, error) {
+	query = c.normalize(query)
+	key := "statuses|" + queryKey(query)
+	value, err := c.get(ctx, key, func(ctx context.Context) (interface{}, error) {
+		return c.source.Statuses(ctx, query)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(promModel.Matrix), nil
+}
+
+// RateWindow returns the rate window of the source for the snapped range.
+func (c *Cache) RateWindow(start time.Time, end time.Time) time.Duration {
+	step := c.QueryStep(start, end)
+	return c.source.RateWindow(start.Truncate(step), end.Truncate(step))
+}
+
+// QueryStep returns the step of the range queries of the source, Step when
+// the source isn't a source.Stepper.
+func (c *Cache) QueryStep(start time.Time, end time.Time) time.Duration {
+	if stepper, ok := c.source.(source.Stepper); ok {
+		if step := stepper.QueryStep(start, end); step > 0 {
+			return step
+		}
+	}
+	return c.options.Step
+}
+
+// Snaps the time range to the query step and sets the default quantile
+func (c *Cache) normalize(query source.Query) source.Query {
+	step := c.QueryStep(query.Start, query.End)
+	query.Start = query.Start.Truncate(step)
+	query.End = query.End.Truncate(step)
+	if query.Quantile == 0 {
+		query.Quantile = source.DefaultQuantile
+	}
+	return query
+}
+
+func queryKey(query source.Query) string {
+	return fmt.Sprintf(
+		"%s|%s|%s|%s|%g|%d|%d",
+		query.Namespace,
+		query.Workload,
+		query.Direction,
+		query.Signal,
+		query.Quantile,
+		query.Start.Unix(),
+		query.End.Unix(),
+	)
+}
+
+// Returns the cached value, joins the identical in-flight request or
+// fetches the value
+func (c *Cache) get(
+	ctx context.Context,
+	key string,
+	fetch func(ctx context.Context) (interface{}, error),
+) (interface{}, error) {
+	bypass := isBypassed(ctx)
+
+	c.mu.Lock()
+	if bypass {
+		atomic.AddUint64(&c.bypassed, 1)
+	} else if e, found := c.entries[key]; found {
+		if time.Now().Before(e.expiresAt) {
+			c.mu.Unlock()
+			atomic.AddUint64(&c.hits, 1)
+			source.AddWarnings(ctx, e.warnings...)
+			return e.value, nil
+		}
+		delete(c.entries, key)
+	}
+
+	// Bypassed requests are only counted as bypassed, they don't join the
+	// request started before them. Later requests join the bypassed one.
+	cl, found := c.inFlight[key]
+	if found && !bypass {
+		atomic.AddUint64(&c.coalesced, 1)
+	} else {
+		if !bypass {
+			atomic.AddUint64(&c.misses, 1)
+		}
+		// The shared request is aborted when all of its callers are gone
+		fetchCtx, cancel := context.WithCancel(context.Background())
+		cl = &call{done: make(chan struct{}), cancel: cancel}
+		c.inFlight[key] = cl
+		go c.fetch(fetchCtx, key, cl, fetch)
+	}
+	cl.waiters++
+	c.mu.Unlock()
+
+	select {
+	case <-cl.done:
+		source.AddWarnings(ctx, cl.warnings...)
+		return cl.value, cl.err
+	case <-ctx.Done():
+		c.mu.Lock()
+		cl.waiters--
+		if cl.waiters == 0 {
+			// Later requests must not join the aborted request
+			if c.inFlight[key] == cl {
+				delete(c.inFlight, key)
+			}
+			cl.cancel()
+		}
+		c.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Cache) fetch(
+	ctx context.Context,
+	key string,
+	cl *call,
+	fetch func(ctx context.Context) (interface{}, error),
+) {
+	defer cl.cancel()
+	ctx, warnings := source.WithWarnings(ctx)
+	cl.value, cl.err = fetch(ctx)
+	cl.warnings = warnings.List()
+
+	c.mu.Lock()
+	// Requests replaced by a bypassed request don't overwrite its result
+	current := c.inFlight[key] == cl
+	if current {
+		delete(c.inFlight, key)
+	}
+	if current && cl.err == nil && cl.waiters > 0 {
+		c.set(key, cl.value, cl.warnings)
+	}
+	c.mu.Unlock()
+
+	close(cl.done)
+}
+
+// Stores the value, expired entries are dropped when the cache is full.
+// Must be called with the lock held.
+func (c *Cache) set(key string, value interface{}, warnings []string) {
+	now := time.Now()
+	if len(c.entries) >= c.options.MaxEntries {
+		for k, e := range c.entries {
+			if !now.Before(e.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	// Still full: drop any entry
+	for k := range c.entries {
+		if len(c.entries) < c.options.MaxEntries {
+			break
+		}
+		delete(c.entries, k)
+	}
+
+	c.entries[key] = entry{
+		value:     value,
+		warnings:  warnings,
+		expiresAt: now.Add(c.options.TTL),
+	}
+}
@@ -0,0 +1,327 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hekike/outlier-istio/pkg/source"
+	promModel "github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// Counts the queries, blocks them until release is closed when set
+type countingSource struct {
+	calls   int32
+	release chan struct{}
+	err     error
+	queries chan source.Query
+}
+
+func (s *countingSource) Topology(
+	ctx context.Context,
+	signal source.Signal,
+) (promModel.Vector, error) {
+	atomic.AddInt32(&s.calls, 1)
+	source.AddWarnings(ctx, "partial response")
+	return promModel.Vector{&promModel.Sample{Value: 1}}, s.err
+}
+
+func (s *countingSource) Edges(
+	ctx context.Context,
+	query source.Query,
+) (promModel.Matrix, error) {
+	return s.matrix(ctx, query)
+}
+
+func (s *countingSource) Statuses(
+	ctx context.Context,
+	query source.Query,
+) (promModel.Matrix, error) {
+	return s.matrix(ctx, query)
+}
+
+func (s *countingSource) RateWindow(
+	start time.Time,
+	end time.Time,
+) time.Duration {
+	return time.Minute
+}
+
+func (s *countingSource) matrix(
+	ctx context.Context,
+	query source.Query,
+) (promModel.Matrix, error) {
+	atomic.AddInt32(&s.calls, 1)
+	if s.queries != nil {
+		s.queries <- query
+	}
+	if s.release != nil {
+		select {
+		case <-s.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	return promModel.Matrix{&promModel.SampleStream{}}, nil
+}
+
+func testQuery(end time.Time) source.Query {
+	return source.Query{
+		Namespace: "default",
+		Workload:  "reviews-v3",
+		Direction: source.Upstream,
+		Start:     end.Add(-time.Hour),
+		End:       end,
+	}
+}
+
+func TestCacheHitMiss(t *testing.T) {
+	src := &countingSource{}
+	c := New(src, Options{})
+	ctx := context.Background()
+	end := time.Date(2018, 10, 27, 15, 0, 0, 0, time.UTC)
+
+	_, err := c.Edges(ctx, testQuery(end))
+	assert.NoError(t, err)
+	// End snapped to the same step
+	_, err = c.Edges(ctx, testQuery(end.Add(3*time.Second)))
+	assert.NoError(t, err)
+	// Default quantile is the same query
+	query := testQuery(end)
+	query.Quantile = source.DefaultQuantile
+	_, err = c.Edges(ctx, query)
+	assert.NoError(t, err)
+
+	// Different step, direction and method
+	_, err = c.Edges(ctx, testQuery(end.Add(5*time.Second)))
+	assert.NoError(t, err)
+	query.Direction = source.Downstream
+	_, err = c.Edges(ctx, query)
+	assert.NoError(t, err)
+	_, err = c.Statuses(ctx, testQuery(end))
+	assert.NoError(t, err)
+
+	assert.Equal(t, int32(4), atomic.LoadInt32(&src.calls))
+	assert.Equal(t, Stats{Hits: 2, Misses: 4, Entries: 4}, c.Stats())
+}
+
+func TestCacheSnapsQuery(t *testing.T) {
+	src := &countingSource{queries: make(chan source.Query, 1)}
+	c := New(src, Options{})
+	end := time.Date(2018, 10, 27, 15, 0, 3, 0, time.UTC)
+
+	_, err := c.Statuses(context.Background(), testQuery(end))
+	assert.NoError(t, err)
+
+	query := <-src.queries
+	assert.Equal(t, time.Date(2018, 10, 27, 15, 0, 0, 0, time.UTC), query.End)
+	assert.Equal(t, time.Date(2018, 10, 27, 14, 0, 0, 0, time.UTC), query.Start)
+	assert.Equal(t, source.DefaultQuantile, query.Quantile)
+}
+
+// Evaluates the range queries at a fixed step
+type steppingSource struct {
+	countingSource
+	step time.Duration
+}
+
+func (s *steppingSource) QueryStep(
+	start time.Time,
+	end time.Time,
+) time.Duration {
+	return s.step
+}
+
+func TestCacheSnapsQueryToQueryStep(t *testing.T) {
+	src := &steppingSource{
+		countingSource: countingSource{queries: make(chan source.Query, 1)},
+		step:           time.Minute,
+	}
+	c := New(src, Options{})
+	end := time.Date(2018, 10, 27, 15, 0, 40, 0, time.UTC)
+
+	_, err := c.Statuses(context.Background(), testQuery(end))
+	assert.NoError(t, err)
+	query := <-src.queries
+	assert.Equal(t, time.Date(2018, 10, 27, 15, 0, 0, 0, time.UTC), query.End)
+	assert.Equal(t, time.Date(2018, 10, 27, 14, 0, 0, 0, time.UTC), query.Start)
+
+	// The same step of the source
+	_, err = c.Statuses(context.Background(), testQuery(end.Add(10*time.Second)))
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&src.calls))
+	assert.Equal(t, time.Minute, c.QueryStep(query.Start, query.End))
+}
+
+func TestCacheExpires(t *testing.T) {
+	src := &countingSource{}
+	c := New(src, Options{TTL: time.Millisecond})
+	ctx := context.Background()
+
+	_, err := c.Topology(ctx, source.RequestRate)
+	assert.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+	_, err = c.Topology(ctx, source.RequestRate)
+	assert.NoError(t, err)
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&src.calls))
+	assert.Equal(t, uint64(2), c.Stats().Misses)
+}
+
+func TestCacheMaxEntries(t *testing.T) {
+	src := &countingSource{}
+	c := New(src, Options{MaxEntries: 2})
+	ctx := context.Background()
+	end := time.Date(2018, 10, 27, 15, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 5; i++ {
+		_, err := c.Edges(ctx, testQuery(end.Add(time.Duration(i)*time.Minute)))
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, 2, c.Stats().Entries)
+}
+
+func TestCacheCoalesces(t *testing.T) {
+	src := &countingSource{
+		release: make(chan struct{}),
+		queries: make(chan source.Query, 1),
+	}
+	c := New(src, Options{})
+	end := time.Date(2018, 10, 27, 15, 0, 0, 0, time.UTC)
+
+	var wg sync.WaitGroup
+	results := make([]promModel.Matrix, 3)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			matrix, err := c.Edges(context.Background(), testQuery(end))
+			assert.NoError(t, err)
+			results[i] = matrix
+		}(i)
+	}
+
+	// Wait for the request to reach the source and the others to join
+	<-src.queries
+	for c.Stats().Coalesced != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	close(src.release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&src.calls))
+	assert.Equal(t, Stats{Misses: 1, Coalesced: 2, Entries: 1}, c.Stats())
+	for _, matrix := range results {
+		assert.Len(t, matrix, 1)
+	}
+}
+
+func TestCacheBypassDoesNotJoin(t *testing.T) {
+	src := &countingSource{
+		release: make(chan struct{}),
+		queries: make(chan source.Query, 2),
+	}
+	c := New(src, Options{})
+	end := time.Date(2018, 10, 27, 15, 0, 0, 0, time.UTC)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, err := c.Edges(context.Background(), testQuery(end))
+		assert.NoError(t, err)
+	}()
+	<-src.queries
+
+	// The bypassed request fetches again instead of joining
+	go func() {
+		defer wg.Done()
+		_, err := c.Edges(WithBypass(context.Background()), testQuery(end))
+		assert.NoError(t, err)
+	}()
+	<-src.queries
+	close(src.release)
+	wg.Wait()
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&src.calls))
+	assert.Equal(t, Stats{Misses: 1, Bypassed: 1, Entries: 1}, c.Stats())
+}
+
+func TestCacheCancelledWaiter(t *testing.T) {
+	src := &countingSource{
+		release: make(chan struct{}),
+		queries: make(chan source.Query, 2),
+	}
+	c := New(src, Options{})
+	end := time.Date(2018, 10, 27, 15, 0, 0, 0, time.UTC)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := c.Edges(ctx, testQuery(end))
+		done <- err
+	}()
+	<-src.queries
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+
+	// Shared request is aborted without caching
+	close(src.release)
+	_, err := c.Edges(context.Background(), testQuery(end))
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&src.calls))
+}
+
+func TestCacheBypass(t *testing.T) {
+	src := &countingSource{}
+	c := New(src, Options{})
+	end := time.Date(2018, 10, 27, 15, 0, 0, 0, time.UTC)
+
+	_, err := c.Edges(context.Background(), testQuery(end))
+	assert.NoError(t, err)
+	_, err = c.Edges(WithBypass(context.Background()), testQuery(end))
+	assert.NoError(t, err)
+	// Refreshed by the bypassed request
+	_, err = c.Edges(context.Background(), testQuery(end))
+	assert.NoError(t, err)
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&src.calls))
+	// The bypassed request isn't a miss
+	assert.Equal(t, Stats{Hits: 1, Misses: 1, Bypassed: 1, Entries: 1}, c.Stats())
+}
+
+func TestCacheSkipsErrors(t *testing.T) {
+	src := &countingSource{err: errors.New("unavailable")}
+	c := New(src, Options{})
+	end := time.Date(2018, 10, 27, 15, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		_, err := c.Statuses(context.Background(), testQuery(end))
+		assert.EqualError(t, err, "unavailable")
+	}
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&src.calls))
+	assert.Equal(t, 0, c.Stats().Entries)
+}
+
+func TestCacheReplaysWarnings(t *testing.T) {
+	src := &countingSource{}
+	c := New(src, Options{})
+
+	for i := 0; i < 2; i++ {
+		ctx, warnings := source.WithWarnings(context.Background())
+		_, err := c.Topology(ctx, source.RequestRate)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"partial response"}, warnings.List())
+	}
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&src.calls))
+}
@@ -0,0 +1,313 @@
+// Package config loads the server configuration.
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hekike/outlier-istio/pkg/models"
+	"github.com/hekike/outlier-istio/pkg/source"
+)
+
+const (
+	// SourcePrometheus reads metrics from the Prometheus HTTP API
+	SourcePrometheus = "prometheus"
+	// SourceThanos reads metrics from a Thanos Querier
+	SourceThanos = "thanos"
+	// SourceFile reads metrics from a directory or a file of Prometheus
+	// responses exported as JSON, the address is the path
+	SourceFile = "file"
+	// SourceRemoteRead reads raw series from the Prometheus remote read
+	// API, the address is the URL of the read endpoint
+	SourceRemoteRead = "remote-read"
+)
+
+// SchemaAuto detects the metric schema profile at startup
+const SchemaAuto = "auto"
+
+const defaultSourceAddress = "http://prometheus.istio-system.svc.cluster.local:9090"
+
+// Config struct.
+type Config struct {
+	WebDistPath   string
+	MetricsSource MetricsSource
+	// Series selected for the analysis, the filters of the metric schema
+	// profile when nil
+	Filters *source.Filters
+	// Outlier detector of the statuses when the request doesn't select one
+	Detector string
+	// Latency thresholds by workload and edge, the default threshold when
+	// nil
+	LatencyThresholds *models.Thresholds
+}
+
+// MetricsSource configures where metrics are read from.
+type MetricsSource struct {
+	Type         string
+	Address      string
+	QueryTimeout time.Duration
+	// Metric schema profile name or SchemaAuto
+	Schema string
+	// Idle connections kept open to the source
+	MaxIdleConns int
+	// Points per series of a range and of a single range query
+	MaxPoints         int
+	MaxPointsPerQuery int
+	// Window of rate(), derived from the scrape interval when zero
+	RateWindow time.Duration
+	// Scrape interval of the Istio metrics, read from Prometheus when zero
+	ScrapeInterval      time.Duration
+	MinSamplesPerWindow int
+	// Use the series of the recording rules when Prometheus has them
+	RecordingRules bool
+	Auth           Auth
+	TLS            TLS
+	Thanos         Thanos
+	Cache          Cache
+}
+
+// Cache configures the query result cache, disabled when TTL is zero.
+type Cache struct {
+	TTL        time.Duration
+	MaxEntries int
+}
+
+// Auth configures the authentication to the source.
+type Auth struct {
+	BearerToken       string
+	BearerTokenFile   string
+	BasicAuthUsername string
+	BasicAuthPassword string
+	// Headers added to every request
+	Headers map[string]string
+}
+
+// TLS configures the TLS connection to the source.
+type TLS struct {
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// Thanos configures the Thanos specific query parameters.
+type Thanos struct {
+	Dedup           bool
+	PartialResponse bool
+}
+
+// Load loads the configuration from environment variables and from the
+// optional CONFIG_FILE.
+func Load() (Config, error) {
+	var err error
+	cfg := Config{
+		WebDistPath: os.Getenv("WEB_DIST_PATH"),
+		MetricsSource: MetricsSource{
+			Type: getEnv("METRICS_SOURCE", SourcePrometheus),
+			// PROMETHEUS_HOST is kept for backward compatibility
+			Address: getEnv(
+				"METRICS_SOURCE_ADDRESS",
+				getEnv("PROMETHEUS_HOST", defaultSourceAddress),
+			),
+			Schema: getEnv("METRICS_SCHEMA", SchemaAuto),
+		},
+		Detector: getEnv("OUTLIER_DETECTOR", models.DefaultDetector),
+	}
+
+	cfg.MetricsSource.QueryTimeout, err = getEnvDuration(
+		"METRICS_SOURCE_QUERY_TIMEOUT",
+		30*time.Second,
+	)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.MetricsSource.MaxIdleConns, err = getEnvInt(
+		"METRICS_SOURCE_MAX_IDLE_CONNS",
+		32,
+	)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.MetricsSource.MaxPoints, err = getEnvInt(
+		"METRICS_SOURCE_MAX_POINTS",
+		5000,
+	)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.MetricsSource.MaxPointsPerQuery, err = getEnvInt(
+		"METRICS_SOURCE_MAX_POINTS_PER_QUERY",
+		1000,
+	)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.MetricsSource.RateWindow, err = getEnvDuration("METRICS_RATE_WINDOW", 0)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.MetricsSource.ScrapeInterval, err = getEnvDuration(
+		"METRICS_SCRAPE_INTERVAL",
+		0,
+	)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.MetricsSource.MinSamplesPerWindow, err = getEnvInt(
+		"METRICS_MIN_SAMPLES_PER_WINDOW",
+		4,
+	)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.MetricsSource.RecordingRules, err = getEnvBool(
+		"METRICS_RECORDING_RULES",
+		true,
+	)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.MetricsSource.Auth = Auth{
+		BearerToken:       os.Getenv("METRICS_SOURCE_BEARER_TOKEN"),
+		BearerTokenFile:   os.Getenv("METRICS_SOURCE_BEARER_TOKEN_FILE"),
+		BasicAuthUsername: os.Getenv("METRICS_SOURCE_BASIC_AUTH_USERNAME"),
+		BasicAuthPassword: os.Getenv("METRICS_SOURCE_BASIC_AUTH_PASSWORD"),
+	}
+	cfg.MetricsSource.Auth.Headers, err = getEnvMap("METRICS_SOURCE_HEADERS")
+	if err != nil {
+		return cfg, err
+	}
+	cfg.MetricsSource.TLS = TLS{
+		CAFile:     os.Getenv("METRICS_SOURCE_CA_FILE"),
+		CertFile:   os.Getenv("METRICS_SOURCE_CERT_FILE"),
+		KeyFile:    os.Getenv("METRICS_SOURCE_KEY_FILE"),
+		ServerName: os.Getenv("METRICS_SOURCE_SERVER_NAME"),
+	}
+	cfg.MetricsSource.TLS.InsecureSkipVerify, err = getEnvBool(
+		"METRICS_SOURCE_INSECURE_SKIP_VERIFY",
+		false,
+	)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.MetricsSource.Thanos.Dedup, err = getEnvBool("THANOS_DEDUP", true)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.MetricsSource.Thanos.PartialResponse, err = getEnvBool(
+		"THANOS_PARTIAL_RESPONSE",
+		false,
+	)
+	if err != nil {
+		return cfg, err
+	}
+
+	cfg.MetricsSource.Cache.TTL, err = getEnvDuration(
+		"METRICS_CACHE_TTL",
+		30*time.Second,
+	)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.MetricsSource.Cache.MaxEntries, err = getEnvInt(
+		"METRICS_CACHE_MAX_ENTRIES",
+		1000,
+	)
+	if err != nil {
+		return cfg, err
+	}
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		file, err := loadFile(path)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Filters = file.Filters
+		cfg.LatencyThresholds = file.LatencyThresholds
+	}
+
+	switch cfg.MetricsSource.Type {
+	case SourcePrometheus, SourceThanos, SourceFile, SourceRemoteRead:
+	default:
+		return cfg, fmt.Errorf(
+			"unknown METRICS_SOURCE: %s",
+			cfg.MetricsSource.Type,
+		)
+	}
+	if err := models.ValidateDetector(cfg.Detector); err != nil {
+		return cfg, fmt.Errorf("unknown OUTLIER_DETECTOR: %s", cfg.Detector)
+	}
+	// Prometheus durations are whole seconds
+	if window := cfg.MetricsSource.RateWindow; window != 0 && window < time.Second {
+		return cfg, fmt.Errorf(
+			"METRICS_RATE_WINDOW must be at least 1s, got: %s",
+			window,
+		)
+	}
+
+	return cfg, nil
+}
+
+func getEnv(key string, fallback string) string {
+	if value, found := os.LookupEnv(key); found && value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getEnvBool(key string, fallback bool) (bool, error) {
+	value, found := os.LookupEnv(key)
+	if !found || value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return fallback, fmt.Errorf("invalid %s: %s", key, err)
+	}
+	return parsed, nil
+}
+
+// Parses comma separated key=value pairs
+func getEnvMap(key string) (map[string]string, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil, nil
+	}
+	parsed := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("invalid %s: expected key=value", key)
+		}
+		parsed[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return parsed, nil
+}
+
+func getEnvInt(key string, fallback int) (int, error) {
+	value, found := os.LookupEnv(key)
+	if !found || value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return fallback, fmt.Errorf("invalid %s: %s", key, err)
+	}
+	return parsed, nil
+}
+
+func getEnvDuration(key string, fallback time.Duration) (time.Duration, error) {
+	value, found := os.LookupEnv(key)
+	if !found || value == "" {
+		return fallback, nil
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fallback, fmt.Errorf("invalid %s: %s", key, err)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	os.Setenv("PROMETHEUS_HOST", "http://prometheus:9090")
+	defer os.Unsetenv("PROMETHEUS_HOST")
+
+	cfg, err := Load()
+	assert.NoError(t, err)
+	assert.Equal(t, MetricsSource{
+		Type:                SourcePrometheus,
+		Address:             "http://prometheus:9090",
+		QueryTimeout:        30 * time.Second,
+		Schema:              SchemaAuto,
+		MaxIdleConns:        32,
+		MaxPoints:           5000,
+		MaxPointsPerQuery:   1000,
+		MinSamplesPerWindow: 4,
+		RecordingRules:      true,
+		Thanos:              Thanos{Dedup: true},
+		Cache:               Cache{TTL: 30 * time.Second, MaxEntries: 1000},
+	}, cfg.MetricsSource)
+	assert.Equal(t, "median", cfg.Detector)
+
+	os.Setenv("METRICS_SOURCE", "thanos")
+	os.Setenv("METRICS_SOURCE_ADDRESS", "http://thanos-query:9090")
+	os.Setenv("METRICS_SOURCE_QUERY_TIMEOUT", "10s")
+	os.Setenv("METRICS_SCHEMA", "istio-telemetry-v2")
+	os.Setenv("METRICS_CACHE_TTL", "0")
+	os.Setenv("METRICS_RATE_WINDOW", "2m")
+	defer os.Unsetenv("METRICS_RATE_WINDOW")
+	defer os.Unsetenv("METRICS_CACHE_TTL")
+	defer os.Unsetenv("METRICS_SCHEMA")
+	defer os.Unsetenv("METRICS_SOURCE")
+	defer os.Unsetenv("METRICS_SOURCE_ADDRESS")
+	defer os.Unsetenv("METRICS_SOURCE_QUERY_TIMEOUT")
+
+	cfg, err = Load()
+	assert.NoError(t, err)
+	assert.Equal(t, MetricsSource{
+		Type:                SourceThanos,
+		Address:             "http://thanos-query:9090",
+		QueryTimeout:        10 * time.Second,
+		Schema:              "istio-telemetry-v2",
+		MaxIdleConns:        32,
+		MaxPoints:           5000,
+		MaxPointsPerQuery:   1000,
+		RateWindow:          2 * time.Minute,
+		MinSamplesPerWindow: 4,
+		RecordingRules:      true,
+		Thanos:              Thanos{Dedup: true},
+		Cache:               Cache{MaxEntries: 1000},
+	}, cfg.MetricsSource)
+}
+
+func TestLoadInvalid(t *testing.T) {
+	os.Setenv("METRICS_SOURCE", "graphite")
+	defer os.Unsetenv("METRICS_SOURCE")
+
+	_, err := Load()
+	assert.EqualError(t, err, "unknown METRICS_SOURCE: graphite")
+}
+
+func TestLoadInvalidDetector(t *testing.T) {
+	os.Setenv("OUTLIER_DETECTOR", "iforest")
+	defer os.Unsetenv("OUTLIER_DETECTOR")
+
+	_, err := Load()
+	assert.EqualError(t, err, "unknown OUTLIER_DETECTOR: iforest")
+
+	os.Setenv("OUTLIER_DETECTOR", "mad")
+	cfg, err := Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "mad", cfg.Detector)
+}
+
+func TestLoadInvalidTimeout(t *testing.T) {
+	os.Setenv("METRICS_SOURCE_QUERY_TIMEOUT", "soon")
+	defer os.Unsetenv("METRICS_SOURCE_QUERY_TIMEOUT")
+
+	_, err := Load()
+	assert.Contains(t, err.Error(), "invalid METRICS_SOURCE_QUERY_TIMEOUT")
+}
+
+func TestLoadInvalidRateWindow(t *testing.T) {
+	os.Setenv("METRICS_RATE_WINDOW", "500ms")
+	defer os.Unsetenv("METRICS_RATE_WINDOW")
+
+	_, err := Load()
+	assert.EqualError(t, err, "METRICS_RATE_WINDOW must be at least 1s, got: 500ms")
+
+	os.Setenv("METRICS_RATE_WINDOW", "1500ms")
+	cfg, err := Load()
+	assert.NoError(t, err)
+	assert.Equal(t, 1500*time.Millisecond, cfg.MetricsSource.RateWindow)
+}
+
+func TestLoadAuth(t *testing.T) {
+	os.Setenv("METRICS_SOURCE_BEARER_TOKEN_FILE", "/var/run/secrets/token")
+	os.Setenv("METRICS_SOURCE_HEADERS", "X-Scope-OrgID=mesh, X-Team=sre")
+	os.Setenv("METRICS_SOURCE_CA_FILE", "/etc/prometheus/ca.crt")
+	defer os.Unsetenv("METRICS_SOURCE_BEARER_TOKEN_FILE")
+	defer os.Unsetenv("METRICS_SOURCE_HEADERS")
+	defer os.Unsetenv("METRICS_SOURCE_CA_FILE")
+
+	cfg, err := Load()
+	assert.NoError(t, err)
+	assert.Equal(t, Auth{
+		BearerTokenFile: "/var/run/secrets/token",
+		Headers: map[string]string{
+			"X-Scope-OrgID": "mesh",
+			"X-Team":        "sre",
+		},
+	}, cfg.MetricsSource.Auth)
+	assert.Equal(t, TLS{
+		CAFile: "/etc/prometheus/ca.crt",
+	}, cfg.MetricsSource.TLS)
+
+	os.Setenv("METRICS_SOURCE_HEADERS", "X-Scope-OrgID")
+	_, err = Load()
+	assert.EqualError(t, err, "invalid METRICS_SOURCE_HEADERS: expected key=value")
+}
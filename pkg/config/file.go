@@ -0,0 +1,42 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/hekike/outlier-istio/pkg/models"
+	"github.com/hekike/outlier-istio/pkg/source"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// File is the YAML configuration file for settings that don't fit in
+// environment variables.
+type File struct {
+	Filters           *source.Filters    `yaml:"filters"`
+	LatencyThresholds *models.Thresholds `yaml:"latencyThresholds"`
+}
+
+func loadFile(path string) (File, error) {
+	var file File
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return file, fmt.Errorf("unable to read config file: %s", err)
+	}
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return file, fmt.Errorf("invalid config file %s: %s", path, err)
+	}
+
+	if file.Filters != nil {
+		if err := file.Filters.Validate(); err != nil {
+			return file, fmt.Errorf("invalid config file %s: %s", path, err)
+		}
+	}
+	if file.LatencyThresholds != nil {
+		if err := file.LatencyThresholds.Validate(); err != nil {
+			return file, fmt.Errorf("invalid config file %s: %s", path, err)
+		}
+	}
+
+	return file, nil
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/hekike/outlier-istio/pkg/models"
+	"github.com/hekike/outlier-istio/pkg/source"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadFile(t *testing.T) {
+	os.Setenv("CONFIG_FILE", "../../test/config/filters.yaml")
+	defer os.Unsetenv("CONFIG_FILE")
+
+	cfg, err := Load()
+	assert.NoError(t, err)
+	assert.Equal(t, &source.Filters{
+		Include: []source.LabelMatcher{
+			source.LabelMatcher{
+				Label: "destination_workload_namespace",
+				Value: "default",
+			},
+		},
+		Exclude: []source.LabelMatcher{
+			source.LabelMatcher{
+				Label: "source_app",
+				Regex: "health-checker|load-generator-.*",
+			},
+			source.LabelMatcher{Label: "destination_app", Value: "mixer"},
+		},
+	}, cfg.Filters)
+}
+
+func TestLoadFileThresholds(t *testing.T) {
+	os.Setenv("CONFIG_FILE", "../../test/config/thresholds.yaml")
+	defer os.Unsetenv("CONFIG_FILE")
+
+	cfg, err := Load()
+	assert.NoError(t, err)
+	assert.Nil(t, cfg.Filters)
+	assert.Equal(t, &models.Thresholds{
+		Default: &models.Threshold{Relative: 0.25, Absolute: 0.01},
+		Workloads: []models.WorkloadThreshold{
+			{
+				Namespace: "default",
+				Workload:  "reviews-v3",
+				Threshold: models.Threshold{Relative: 0.5},
+			},
+			{
+				Workload:  "redis-cache",
+				Threshold: models.Threshold{Absolute: 0.001},
+			},
+		},
+		Edges: []models.EdgeThreshold{
+			{
+				Source:      "productpage-v1",
+				Destination: "details-v1",
+				Threshold:   models.Threshold{Relative: 1, Absolute: 0.1},
+			},
+		},
+	}, cfg.LatencyThresholds)
+}
+
+func TestLoadFileMissing(t *testing.T) {
+	os.Setenv("CONFIG_FILE", "../../test/config/missing.yaml")
+	defer os.Unsetenv("CONFIG_FILE")
+
+	_, err := Load()
+	assert.Contains(t, err.Error(), "unable to read config file")
+}
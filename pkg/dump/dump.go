@@ -0,0 +1,250 @@
+// Package dump serves metrics from JSON exports of Prometheus query results.
+package dump
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hekike/outlier-istio/pkg/source"
+	promModel "github.com/prometheus/common/model"
+)
+
+// Source is a MetricsSource of Prometheus HTTP API responses dumped to a
+// directory or to a single file.
+//
+// In a directory every response is a .json file:
+//
+//	topology.json                                     request and TCP connection rates
+//	topology_grpc-errors.json                         gRPC error rates
+//	<namespace>/<workload>/<direction>.json           edges of Latency
+//	<namespace>/<workload>/<direction>_<signal>.json  edges of the signal
+//	<namespace>/<workload>/statuses.json              statuses of Latency
+//	<namespace>/<workload>/statuses_<signal>.json     statuses of the signal
+//
+// A single file is a JSON object of the same paths without the extension
+// and the responses. Missing responses are empty results.
+type Source struct {
+	responses  map[string]response
+	rateWindow time.Duration
+}
+
+// Options of the dump source.
+type Options struct {
+	// Window of rate() the range queries were dumped with
+	RateWindow time.Duration
+}
+
+// Response of the Prometheus HTTP API, the format of test/mock
+type response struct {
+	Status string `json:"status"`
+	Data   struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+	ErrorType string   `json:"errorType"`
+	Error     string   `json:"error"`
+	Warnings  []string `json:"warnings"`
+}
+
+// NewSource loads the responses of the directory or of the file at path.
+func NewSource(path string, options Options) (*Source, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Source{
+		responses:  make(map[string]response),
+		rateWindow: options.RateWindow,
+	}
+	if info.IsDir() {
+		err = s.loadDir(path)
+	} else {
+		err = s.loadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Source) loadDir(dir string) error {
+	return filepath.Walk(dir, func(
+		file string,
+		info os.FileInfo,
+		err error,
+	) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(file) != ".json" {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		key := strings.TrimSuffix(filepath.ToSlash(rel), ".json")
+		return s.add(key, data)
+	})
+}
+
+func (s *Source) loadFile(file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	dump := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &dump); err != nil {
+		return fmt.Errorf("invalid dump %s: %s", file, err)
+	}
+	for key, data := range dump {
+		if err := s.add(key, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Source) add(key string, data []byte) error {
+	resp := response{}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return fmt.Errorf("invalid response %s: %s", key, err)
+	}
+	s.responses[key] = resp
+	return nil
+}
+
+// Topology returns the dumped topology of the signal.
+func (s *Source) Topology(
+	ctx context.Context,
+	signal source.Signal,
+) (promModel.Vector, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// Request and TCP connection rates are the topology of the other
+	// signals too
+	key := "topology"
+	if signal == source.GRPCErrorRate {
+		key += "_" + string(signal)
+	}
+	resp, found := s.responses[key]
+	if !found {
+		return promModel.Vector{}, nil
+	}
+
+	vector := promModel.Vector{}
+	if err := s.result(ctx, key, resp, promModel.ValVector, &vector); err != nil {
+		return nil, err
+	}
+	return vector, nil
+}
+
+// Edges returns the dumped edges within the query's time range.
+func (s *Source) Edges(
+	ctx context.Context,
+	query source.Query,
+) (promModel.Matrix, error) {
+	direction := query.Direction
+	if direction == "" {
+		direction = source.Upstream
+	}
+	return s.matrix(ctx, query, string(direction))
+}
+
+// Statuses returns the dumped statuses within the query's time range.
+func (s *Source) Statuses(
+	ctx context.Context,
+	query source.Query,
+) (promModel.Matrix, error) {
+	return s.matrix(ctx, query, "statuses")
+}
+
+// RateWindow returns the rate window of the dumped range queries.
+func (s *Source) RateWindow(start time.Time, end time.Time) time.Duration {
+	return s.rateWindow
+}
+
+// Returns the matrix of the workload's namespace, the matrices of the
+// workload in every namespace when the namespace is empty
+func (s *Source) matrix(
+	ctx context.Context,
+	query source.Query,
+	name string,
+) (promModel.Matrix, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if query.Signal != source.Latency {
+		name += "_" + string(query.Signal)
+	}
+
+	namespace := query.Namespace
+	if namespace == "" {
+		namespace = "*"
+	}
+	pattern := path.Join(namespace, query.Workload, name)
+
+	keys := []string{}
+	for key := range s.responses {
+		if matched, _ := path.Match(pattern, key); matched {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	matrix := promModel.Matrix{}
+	for _, key := range keys {
+		keyMatrix := promModel.Matrix{}
+		err := s.result(ctx, key, s.responses[key], promModel.ValMatrix, &keyMatrix)
+		if err != nil {
+			return nil, err
+		}
+		matrix = append(matrix, keyMatrix...)
+	}
+	return source.FilterRange(matrix, query.Start, query.End), nil
+}
+
+// Decodes the result of the response, errors of the dumped query are
+// returned as they were reported by Prometheus
+func (s *Source) result(
+	ctx context.Context,
+	key string,
+	resp response,
+	expected promModel.ValueType,
+	result interface{},
+) error {
+	source.AddWarnings(ctx, resp.Warnings...)
+	if resp.Status == "error" {
+		return &source.QueryError{
+			Query:   key,
+			Type:    resp.ErrorType,
+			Message: resp.Error,
+		}
+	}
+	if resp.Data.ResultType != expected.String() {
+		return &source.ResultTypeError{
+			Query:    key,
+			Expected: expected.String(),
+			Actual:   resp.Data.ResultType,
+		}
+	}
+	if err := json.Unmarshal(resp.Data.Result, result); err != nil {
+		return fmt.Errorf("invalid result %s: %s", key, err)
+	}
+	return nil
+}
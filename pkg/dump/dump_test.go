@@ -0,0 +1,140 @@
+package dump
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hekike/outlier-istio/pkg/source"
+	promModel "github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSourceDirectory(t *testing.T) {
+	s, err := NewSource("../../test/dump", Options{RateWindow: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	vector, err := s.Topology(ctx, source.RequestRate)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, vector)
+
+	// Not dumped
+	vector, err = s.Topology(ctx, source.GRPCErrorRate)
+	assert.NoError(t, err)
+	assert.Equal(t, promModel.Vector{}, vector)
+
+	query := source.Query{
+		Namespace: "default",
+		Workload:  "productpage-v1",
+		Direction: source.Downstream,
+		Start:     time.Date(2018, 10, 27, 22, 30, 0, 0, time.UTC),
+		End:       time.Date(2018, 10, 27, 23, 0, 0, 0, time.UTC),
+	}
+	matrix, err := s.Edges(ctx, query)
+	assert.NoError(t, err)
+	assert.Len(t, matrix, 4)
+	// Samples of the range every 5s
+	for _, sampleStream := range matrix {
+		assert.Len(t, sampleStream.Values, 360)
+	}
+
+	matrix, err = s.Statuses(ctx, query)
+	assert.NoError(t, err)
+	assert.Len(t, matrix, 1)
+
+	// Workload of every namespace
+	query.Namespace = ""
+	matrix, err = s.Statuses(ctx, query)
+	assert.NoError(t, err)
+	assert.Len(t, matrix, 1)
+
+	assert.Equal(t, time.Minute, s.RateWindow(query.Start, query.End))
+}
+
+func TestSourceFile(t *testing.T) {
+	s, err := NewSource("../../test/dump.json", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, warnings := source.WithWarnings(context.Background())
+	vector, err := s.Topology(ctx, source.GRPCErrorRate)
+	assert.NoError(t, err)
+	assert.Len(t, vector, 1)
+	assert.Equal(
+		t,
+		[]string{"partial response: store prometheus-1 unavailable"},
+		warnings.List(),
+	)
+
+	query := source.Query{
+		Namespace: "default",
+		Workload:  "reviews-v3",
+		Direction: source.Upstream,
+		Signal:    source.ErrorRate,
+		Start:     time.Unix(1540683000, 0),
+		End:       time.Unix(1540683060, 0),
+	}
+	matrix, err := s.Edges(context.Background(), query)
+	assert.NoError(t, err)
+	assert.Equal(t, promModel.Matrix{
+		&promModel.SampleStream{
+			Metric: promModel.Metric{
+				"destination_workload":           "reviews-v3",
+				"destination_workload_namespace": "default",
+				"source_workload":                "productpage-v1",
+				"source_workload_namespace":      "default",
+			},
+			Values: []promModel.SamplePair{
+				{Timestamp: 1540683000000, Value: 0.2},
+				{Timestamp: 1540683060000, Value: 0.3},
+			},
+		},
+	}, matrix)
+
+	// Workload of every namespace
+	query.Namespace = ""
+	matrix, err = s.Edges(context.Background(), query)
+	assert.NoError(t, err)
+	assert.Len(t, matrix, 2)
+
+	// Outside of the range
+	query.Start = time.Unix(1540683100, 0)
+	query.End = time.Unix(1540683200, 0)
+	matrix, err = s.Edges(context.Background(), query)
+	assert.NoError(t, err)
+	assert.Equal(t, promModel.Matrix{}, matrix)
+}
+
+func TestSourceErrors(t *testing.T) {
+	s, err := NewSource("../../test/dump.json", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := source.Query{
+		Namespace: "default",
+		Workload:  "reviews-v3",
+		Signal:    source.RequestRate,
+	}
+
+	_, err = s.Statuses(context.Background(), query)
+	assert.EqualError(
+		t,
+		err,
+		"query failed: bad_data: 1:1: parse error: unexpected end of input",
+	)
+
+	query.Signal = source.ErrorRate
+	_, err = s.Statuses(context.Background(), query)
+	assert.Equal(t, &source.ResultTypeError{
+		Query:    "default/reviews-v3/statuses_errors",
+		Expected: "matrix",
+		Actual:   "vector",
+	}, err)
+
+	_, err = NewSource("../../test/missing", Options{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,333 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/hekike/outlier-istio/pkg/statistics"
+	"github.com/montanaflynn/stats"
+)
+
+const (
+	// DetectorMedian compares the median of the steps to the approximate
+	// median of the baseline with the threshold of the signal, rates are
+	// compared relative to the baseline
+	DetectorMedian = "median"
+	// DetectorMAD compares the median of the steps to the median of the
+	// baseline in median absolute deviations (modified z-score)
+	DetectorMAD = "mad"
+	// DetectorZScore compares the mean of the steps to the mean of the
+	// baseline in standard deviations
+	DetectorZScore = "zscore"
+	// DetectorEWMA compares the exponentially weighted moving average of the
+	// steps to the control limits of the baseline
+	DetectorEWMA = "ewma"
+)
+
+// DefaultDetector is used when the request and the configuration don't
+// select a detector.
+const DefaultDetector = DetectorMedian
+
+// Detectors are the names of the detectors.
+var Detectors = []string{
+	DetectorMedian,
+	DetectorMAD,
+	DetectorZScore,
+	DetectorEWMA,
+}
+
+// ValidateDetector returns an error for an unknown detector name, empty
+// selects the default.
+func ValidateDetector(name string) error {
+	if name == "" {
+		return nil
+	}
+	for _, detector := range Detectors {
+		if name == detector {
+			return nil
+		}
+	}
+	return fmt.Errorf(
+		"Detector must be one of %s, got: %s",
+		strings.Join(Detectors, ", "),
+		name,
+	)
+}
+
+// Modified z-score of an outlier (Iglewicz and Hoaglin)
+const madDeviations = 3.5
+
+// Standard deviations of an outlier
+const zScoreDeviations = 3
+
+// Weight of the latest value in the moving average and the width of the
+// control limits in standard deviations
+const ewmaLambda = 0.2
+const ewmaDeviations = 3
+
+// Standard deviations in a median absolute deviation of normal values
+const madScale = 1.4826
+
+// Samples needed for a baseline
+const minBaselineSamples = 5
+
+// Direction of the deviation from the baseline.
+type Direction int
+
+const (
+	// Within the threshold of the detector
+	Within Direction = iota
+	// Above the baseline
+	Above
+	// Below the baseline
+	Below
+)
+
+// Verdict of a detector on the values of a step.
+type Verdict struct {
+	Direction Direction
+	// Deviation from the baseline in units of the threshold, outliers are
+	// beyond 1 above and -1 below the baseline
+	Score float64
+}
+
+// Detector compares the values of a step to the baseline.
+type Detector interface {
+	Detect(baseline *Baseline, values []float64) Verdict
+}
+
+// SteppedDetector is a Detector carrying state from step to step, Advance
+// moves it over a step once the step is detected. Detect doesn't change the
+// state, a stepped detector compares the steps of a single series.
+type SteppedDetector interface {
+	Detector
+	Advance(baseline *Baseline, values []float64)
+}
+
+// Baseline summarizes the historical values and the values of the steps up
+// to the current one in bounded memory.
+type Baseline struct {
+	median  *statistics.GK
+	moments statistics.Moments
+}
+
+// NewBaseline creates a baseline of the historical values.
+func NewBaseline(values statistics.Measurements) *Baseline {
+	baseline := &Baseline{
+		median: statistics.NewGK(0.5, statistics.DefaultEpsilon),
+	}
+	baseline.Add(values...)
+	return baseline
+}
+
+// Add adds values to the baseline, NaN values are skipped.
+func (b *Baseline) Add(values ...float64) {
+	for _, value := range values {
+		b.median.Add(value)
+		b.moments.Add(value)
+	}
+}
+
+// Established reports whether the baseline has enough values to compare to.
+func (b *Baseline) Established() bool {
+	return b.median.Count() > minBaselineSamples
+}
+
+// Median returns the approximate median.
+func (b *Baseline) Median() float64 {
+	return b.median.Quantile()
+}
+
+// MAD returns the approximate median absolute deviation.
+func (b *Baseline) MAD() float64 {
+	return b.median.MedianAbsoluteDeviation()
+}
+
+// Mean returns the mean.
+func (b *Baseline) Mean() float64 {
+	return b.moments.Mean()
+}
+
+// StdDev returns the standard deviation.
+func (b *Baseline) StdDev() float64 {
+	return b.moments.StdDev()
+}
+
+// Medians deviating from the approximate median with more than the
+// threshold are outliers, without an established baseline any median is
+// within
+type medianRule struct {
+	threshold Threshold
+}
+
+func (r medianRule) Detect(baseline *Baseline, values []float64) Verdict {
+	if !baseline.Established() {
+		return Verdict{}
+	}
+	return r.compare(median(values), baseline.Median())
+}
+
+func (r medianRule) compare(median float64, approximateMedian float64) Verdict {
+	return deviationVerdict(
+		median-approximateMedian,
+		0,
+		r.threshold.Tolerance(approximateMedian),
+	)
+}
+
+// Rates falling under dropRatio or exceeding spikeRatio of the approximate
+// median with more than the threshold are outliers, without an established
+// baseline any rate is within
+type relativeRule struct {
+	threshold  Threshold
+	dropRatio  float64
+	spikeRatio float64
+}
+
+func (r relativeRule) Detect(baseline *Baseline, values []float64) Verdict {
+	if !baseline.Established() {
+		return Verdict{}
+	}
+	return r.compare(median(values), baseline.Median())
+}
+
+func (r relativeRule) compare(median float64, approximateMedian float64) Verdict {
+	if approximateMedian <= 0 {
+		return Verdict{}
+	}
+	tolerance := r.threshold.Tolerance(approximateMedian)
+	if median < approximateMedian {
+		verdict := Verdict{
+			Score: (median - approximateMedian) /
+				(approximateMedian * (1 - r.dropRatio)),
+		}
+		if median < approximateMedian*r.dropRatio &&
+			approximateMedian-median > tolerance {
+			verdict.Direction = Below
+		}
+		return verdict
+	}
+	verdict := Verdict{
+		Score: (median - approximateMedian) /
+			(approximateMedian * (r.spikeRatio - 1)),
+	}
+	if median > approximateMedian*r.spikeRatio &&
+		median-approximateMedian > tolerance {
+		verdict.Direction = Above
+	}
+	return verdict
+}
+
+// Medians deviating from the median of the baseline with more than
+// scaled median absolute deviations and the threshold are outliers
+type madDetector struct {
+	deviations float64
+	threshold  Threshold
+}
+
+func (d madDetector) Detect(baseline *Baseline, values []float64) Verdict {
+	if !baseline.Established() {
+		return Verdict{}
+	}
+	return deviationVerdict(
+		median(values)-baseline.Median(),
+		d.deviations*madScale*baseline.MAD(),
+		d.threshold.Tolerance(baseline.Median()),
+	)
+}
+
+// Means deviating from the mean of the baseline with more than deviations
+// standard deviations and the threshold are outliers
+type zScoreDetector struct {
+	deviations float64
+	threshold  Threshold
+}
+
+func (d zScoreDetector) Detect(baseline *Baseline, values []float64) Verdict {
+	if !baseline.Established() {
+		return Verdict{}
+	}
+	return deviationVerdict(
+		statistics.Avg(values)-baseline.Mean(),
+		d.deviations*baseline.StdDev(),
+		d.threshold.Tolerance(baseline.Mean()),
+	)
+}
+
+// The moving average of the step means, started from the mean of the
+// baseline, outside of the control limits of deviations standard deviations
+// and the threshold is an outlier
+type ewmaDetector struct {
+	lambda     float64
+	deviations float64
+	threshold  Threshold
+	// Moving average of the previous steps, the mean of the baseline until
+	// the first step
+	average *float64
+}
+
+func (d *ewmaDetector) Detect(baseline *Baseline, values []float64) Verdict {
+	if !baseline.Established() {
+		return Verdict{}
+	}
+	mean := baseline.Mean()
+	average := d.movingAverage(baseline, values)
+	// Asymptotic standard deviation of the moving average
+	stdDev := baseline.StdDev() * math.Sqrt(d.lambda/(2-d.lambda))
+	return deviationVerdict(
+		average-mean,
+		d.deviations*stdDev,
+		d.threshold.Tolerance(mean),
+	)
+}
+
+// Advance carries the moving average of the step over to the next step.
+func (d *ewmaDetector) Advance(baseline *Baseline, values []float64) {
+	if !baseline.Established() {
+		return
+	}
+	average := d.movingAverage(baseline, values)
+	d.average = &average
+}
+
+// Moving average of the previous steps and the mean of the step
+func (d *ewmaDetector) movingAverage(
+	baseline *Baseline,
+	values []float64,
+) float64 {
+	previous := baseline.Mean()
+	if d.average != nil {
+		previous = *d.average
+	}
+	return d.lambda*statistics.Avg(values) + (1-d.lambda)*previous
+}
+
+// Deviations beyond the larger of the spread of the baseline and the
+// tolerance are outliers
+func deviationVerdict(
+	deviation float64,
+	spread float64,
+	tolerance float64,
+) Verdict {
+	threshold := math.Max(spread, tolerance)
+	if math.IsNaN(deviation) || !(threshold > 0) {
+		return Verdict{}
+	}
+	verdict := Verdict{Score: deviation / threshold}
+	if verdict.Score > 1 {
+		verdict.Direction = Above
+	} else if verdict.Score < -1 {
+		verdict.Direction = Below
+	}
+	return verdict
+}
+
+// Median of the values of a step, they are never empty
+func median(values []float64) float64 {
+	median, err := stats.Median(values)
+	if err != nil {
+		panic(err)
+	}
+	return median
+}
@@ -0,0 +1,183 @@
+package models
+
+import (
+	"math"
+	"testing"
+
+	"github.com/hekike/outlier-istio/pkg/statistics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateDetector(t *testing.T) {
+	assert.NoError(t, ValidateDetector(""))
+	for _, name := range Detectors {
+		assert.NoError(t, ValidateDetector(name))
+	}
+	assert.EqualError(
+		t,
+		ValidateDetector("iforest"),
+		"Detector must be one of median, mad, zscore, ewma, got: iforest",
+	)
+}
+
+func TestBaseline(t *testing.T) {
+	baseline := NewBaseline(statistics.Measurements{10, 11, 12, 13, 12})
+	assert.False(t, baseline.Established())
+
+	baseline.Add(11, math.NaN())
+	assert.True(t, baseline.Established())
+	assert.Equal(t, 11.5, baseline.Median())
+	assert.Equal(t, 0.5, baseline.MAD())
+	assert.InDelta(t, 11.5, baseline.Mean(), 1e-9)
+	assert.InDelta(t, math.Sqrt(1.1), baseline.StdDev(), 1e-9)
+}
+
+func TestDetectors(t *testing.T) {
+	baseline := NewBaseline(statistics.Measurements{
+		10, 11, 12, 13, 12, 11, 10, 12, 11, 12,
+	})
+	empty := NewBaseline(statistics.Measurements{})
+
+	tests := []struct {
+		name     string
+		detector Detector
+		baseline *Baseline
+		values   []float64
+		expected Direction
+	}{
+		{"median rule", medianRule{threshold: Threshold{Absolute: 2}}, baseline, []float64{14, 14}, Above},
+		{"median rule", medianRule{threshold: Threshold{Absolute: 2}}, baseline, []float64{13, 13}, Within},
+		{"median rule", medianRule{threshold: Threshold{Absolute: 2}}, baseline, []float64{8}, Below},
+		// Within without a baseline
+		{"median rule", medianRule{threshold: Threshold{Absolute: 2}}, empty, []float64{13}, Within},
+		{"mad", madDetector{deviations: 3.5, threshold: Threshold{Absolute: 0.1}}, baseline, []float64{17}, Above},
+		{"mad", madDetector{deviations: 3.5, threshold: Threshold{Absolute: 0.1}}, baseline, []float64{14}, Within},
+		{"mad", madDetector{deviations: 3.5, threshold: Threshold{Absolute: 0.1}}, baseline, []float64{6}, Below},
+		{"mad", madDetector{deviations: 3.5, threshold: Threshold{Absolute: 10}}, baseline, []float64{17}, Within},
+		{"zscore", zScoreDetector{deviations: 3, threshold: Threshold{Absolute: 0.1}}, baseline, []float64{15, 15}, Above},
+		{"zscore", zScoreDetector{deviations: 3, threshold: Threshold{Absolute: 0.1}}, baseline, []float64{13, 13}, Within},
+		{"ewma", &ewmaDetector{lambda: 0.2, deviations: 3, threshold: Threshold{Absolute: 0.1}}, baseline, []float64{17, 17}, Above},
+		{"ewma", &ewmaDetector{lambda: 0.2, deviations: 3, threshold: Threshold{Absolute: 0.1}}, baseline, []float64{14, 14, 14}, Within},
+		{"ewma", &ewmaDetector{lambda: 0.2, deviations: 3, threshold: Threshold{Absolute: 0.1}}, baseline, []float64{6}, Below},
+	}
+	for _, test := range tests {
+		verdict := test.detector.Detect(test.baseline, test.values)
+		assert.Equal(t, test.expected, verdict.Direction, "%s %v", test.name, test.values)
+		switch test.expected {
+		case Above:
+			assert.True(t, verdict.Score > 1, test.name)
+		case Below:
+			assert.True(t, verdict.Score < -1, test.name)
+		default:
+			assert.True(t, math.Abs(verdict.Score) <= 1, test.name)
+		}
+	}
+
+	// Without a baseline the detectors don't detect outliers
+	for _, name := range Detectors {
+		verdict := latencyDetection.detector(name).Detect(empty, []float64{100})
+		assert.Equal(t, Verdict{}, verdict, name)
+	}
+}
+
+func TestDetectorsOfConstantBaseline(t *testing.T) {
+	// No deviation in the baseline, the tolerance is the threshold
+	baseline := NewBaseline(statistics.Measurements{0, 0, 0, 0, 0, 0})
+	for _, name := range Detectors {
+		detector := errorRateDetection.detector(name)
+		assert.Equal(
+			t,
+			"ok",
+			errorRateDetection.status(detector.Detect(baseline, []float64{0.04})),
+			name,
+		)
+		assert.Equal(
+			t,
+			"errors",
+			errorRateDetection.status(detector.Detect(baseline, []float64{0.5, 0.5, 0.5})),
+			name,
+		)
+	}
+}
+
+func TestAggregateWithDetector(t *testing.T) {
+	status := AggregatedStatus{
+		StatusTimeline: map[unixTime]AggregatedStatusItem{
+			60:  AggregatedStatusItem{Values: []float64{0.011, 0.012}},
+			120: AggregatedStatusItem{Values: []float64{0.03, 0.031}},
+		},
+		Detector: madDetector{
+			deviations: madDeviations,
+			threshold:  Threshold{Absolute: 0.005},
+		},
+		Classify: func(verdict Verdict) string {
+			if verdict.Direction == Above {
+				return "high"
+			}
+			return "ok"
+		},
+	}
+
+	statuses := status.Aggregate(statistics.Measurements{
+		0.010, 0.011, 0.012, 0.011, 0.010, 0.012,
+	})
+	assert.Equal(t, "ok", statuses[0].Status)
+	assert.Equal(t, "high", statuses[1].Status)
+
+	// Within the threshold
+	status.Detector = madDetector{
+		deviations: madDeviations,
+		threshold:  Threshold{Absolute: 0.05},
+	}
+	statuses = status.Aggregate(statistics.Measurements{
+		0.010, 0.011, 0.012, 0.011, 0.010, 0.012,
+	})
+	assert.Equal(t, "ok", statuses[0].Status)
+	assert.Equal(t, "ok", statuses[1].Status)
+}
+
+func TestEWMADetectorAcrossSteps(t *testing.T) {
+	baseline := NewBaseline(statistics.Measurements{
+		10, 11, 12, 13, 12, 11, 10, 12, 11, 12,
+	})
+	detector := &ewmaDetector{
+		lambda:     0.2,
+		deviations: 3,
+		threshold:  Threshold{Absolute: 0.1},
+	}
+
+	// A single step over the baseline is within, the average of the
+	// following steps drifts above the control limits
+	directions := []Direction{}
+	for step := 0; step < 5; step++ {
+		verdict := detector.Detect(baseline, []float64{13, 13, 13})
+		directions = append(directions, verdict.Direction)
+		detector.Advance(baseline, []float64{13, 13, 13})
+	}
+	assert.Equal(
+		t,
+		[]Direction{Within, Within, Within, Within, Above},
+		directions,
+	)
+}
+
+func TestEWMADetectorDetectsStepOnce(t *testing.T) {
+	baseline := NewBaseline(statistics.Measurements{
+		10, 11, 12, 13, 12, 11, 10, 12, 11, 12,
+	})
+	detector := &ewmaDetector{
+		lambda:     0.2,
+		deviations: 3,
+		threshold:  Threshold{Absolute: 0.1},
+	}
+
+	// Detect doesn't move the average
+	values := []float64{13, 13}
+	verdict := detector.Detect(baseline, values)
+	assert.Equal(t, verdict, detector.Detect(baseline, values))
+	assert.Nil(t, detector.average)
+
+	detector.Advance(baseline, values)
+	assert.InDelta(t, 11.72, *detector.average, 1e-9)
+	assert.NotEqual(t, verdict, detector.Detect(baseline, values))
+}
@@ -2,14 +2,28 @@ package models
 
 import promModel "github.com/prometheus/common/model"
 
-func getSourceFromMetric(metric promModel.Metric) (name string, app string) {
+func getSourceFromMetric(metric promModel.Metric) (
+	namespace string,
+	name string,
+	app string,
+) {
+	namespace = string(metric["source_workload_namespace"])
 	name = string(metric["source_workload"])
 	app = string(metric["source_app"])
-	return name, app
+	return namespace, name, app
 }
 
-func getDestinationFromMetric(metric promModel.Metric) (name string, app string) {
+func getDestinationFromMetric(metric promModel.Metric) (
+	namespace string,
+	name string,
+	app string,
+) {
+	namespace = string(metric["destination_workload_namespace"])
 	name = string(metric["destination_workload"])
 	app = string(metric["destination_app"])
-	return name, app
+	return namespace, name, app
+}
+
+func getProtocolFromMetric(metric promModel.Metric) string {
+	return string(metric["request_protocol"])
 }
@@ -9,20 +9,24 @@ import (
 
 func TestGetSourceFromMetric(t *testing.T) {
 	metric := promModel.Metric{
-		"source_workload": "workload-name",
-		"source_app":      "workload-app",
+		"source_workload_namespace": "workload-namespace",
+		"source_workload":           "workload-name",
+		"source_app":                "workload-app",
 	}
-	name, app := getSourceFromMetric(metric)
+	namespace, name, app := getSourceFromMetric(metric)
+	assert.Equal(t, namespace, "workload-namespace")
 	assert.Equal(t, name, "workload-name")
 	assert.Equal(t, app, "workload-app")
 }
 
 func TestGetDestinationFromMetric(t *testing.T) {
 	metric := promModel.Metric{
-		"destination_workload": "workload-name",
-		"destination_app":      "workload-app",
+		"destination_workload_namespace": "workload-namespace",
+		"destination_workload":           "workload-name",
+		"destination_app":                "workload-app",
 	}
-	name, app := getDestinationFromMetric(metric)
+	namespace, name, app := getDestinationFromMetric(metric)
+	assert.Equal(t, namespace, "workload-namespace")
 	assert.Equal(t, name, "workload-name")
 	assert.Equal(t, app, "workload-app")
 }
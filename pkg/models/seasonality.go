@@ -0,0 +1,104 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hekike/outlier-istio/pkg/source"
+	"github.com/hekike/outlier-istio/pkg/statistics"
+	promModel "github.com/prometheus/common/model"
+)
+
+const (
+	// BaselinePrevious is the historical window right before the start and
+	// the steps up to the current one
+	BaselinePrevious = "previous"
+	// BaselineDaily is the same window 1 day earlier
+	BaselineDaily = "daily"
+	// BaselineWeekly is the same window 7 days earlier
+	BaselineWeekly = "weekly"
+	// BaselineBlend combines the previous, the daily and the weekly baselines
+	BaselineBlend = "blend"
+)
+
+// DefaultBaseline is used when the request doesn't select a baseline.
+const DefaultBaseline = BaselinePrevious
+
+// Baselines are the names of the baseline modes.
+var Baselines = []string{
+	BaselinePrevious,
+	BaselineDaily,
+	BaselineWeekly,
+	BaselineBlend,
+}
+
+// ValidateBaseline returns an error for an unknown baseline mode, empty
+// selects the default.
+func ValidateBaseline(name string) error {
+	if name == "" {
+		return nil
+	}
+	for _, baseline := range Baselines {
+		if name == baseline {
+			return nil
+		}
+	}
+	return fmt.Errorf(
+		"Baseline must be one of %s, got: %s",
+		strings.Join(Baselines, ", "),
+		name,
+	)
+}
+
+const day = 24 * time.Hour
+const week = 7 * day
+
+// Offsets of the seasonal windows of the baseline mode
+func baselineOffsets(name string) []time.Duration {
+	switch name {
+	case BaselineDaily:
+		return []time.Duration{day}
+	case BaselineWeekly:
+		return []time.Duration{week}
+	case BaselineBlend:
+		return []time.Duration{day, week}
+	}
+	return nil
+}
+
+// Only the seasonal windows are the baseline, the steps are compared to the
+// same time of the earlier days instead of the minutes before them
+func isSeasonal(name string) bool {
+	return name == BaselineDaily || name == BaselineWeekly
+}
+
+// Fetches the range of the query shifted by the offsets of the baseline
+// mode, the values are keyed by the metric of their sample stream
+func getSeasonalValues(
+	ctx context.Context,
+	fetch func(context.Context, source.Query) (promModel.Matrix, error),
+	query source.Query,
+	baseline string,
+	key func(metric promModel.Metric) string,
+) (map[string]statistics.Measurements, error) {
+	values := make(map[string]statistics.Measurements)
+	for _, offset := range baselineOffsets(baseline) {
+		shiftedQuery := query
+		shiftedQuery.Start = query.Start.Add(-offset)
+		shiftedQuery.End = query.End.Add(-offset)
+
+		matrix, err := fetch(ctx, shiftedQuery)
+		if err != nil {
+			return values, err
+		}
+		for _, sampleStream := range matrix {
+			k := key(sampleStream.Metric)
+			for _, samplePair := range sampleStream.Values {
+				values[k] = append(values[k], float64(samplePair.Value))
+			}
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,182 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hekike/outlier-istio/pkg/source"
+	promModel "github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateBaseline(t *testing.T) {
+	assert.NoError(t, ValidateBaseline(""))
+	for _, name := range Baselines {
+		assert.NoError(t, ValidateBaseline(name))
+	}
+	assert.EqualError(
+		t,
+		ValidateBaseline("monthly"),
+		"Baseline must be one of previous, daily, weekly, blend, got: monthly",
+	)
+}
+
+func TestGetWorkloadStatusByNameSeasonal(t *testing.T) {
+	start := time.Unix(0, 0).Add(week)
+	end := start.Add(30 * time.Minute)
+	metric := promModel.Metric{
+		"source_workload_namespace":      "default",
+		"source_workload":                "productpage-v1",
+		"source_app":                     "productpage",
+		"destination_workload_namespace": "default",
+		"destination_workload":           "details-v1",
+		"destination_app":                "details",
+	}
+
+	// 30ms during the same window yesterday, 10ms and 30ms in the last 5
+	// minutes today, nothing a week earlier
+	latencies := []promModel.SamplePair{}
+	for t := start.Add(-day); !t.After(end.Add(-day)); t = t.Add(time.Minute) {
+		latencies = append(latencies, promModel.SamplePair{
+			Timestamp: promModel.TimeFromUnixNano(t.UnixNano()),
+			Value:     0.03,
+		})
+	}
+	for t := start; !t.After(end); t = t.Add(time.Minute) {
+		value := promModel.SampleValue(0.01)
+		if t.After(end.Add(-5 * time.Minute)) {
+			value = 0.03
+		}
+		latencies = append(latencies, promModel.SamplePair{
+			Timestamp: promModel.TimeFromUnixNano(t.UnixNano()),
+			Value:     value,
+		})
+	}
+
+	fake := source.NewFake()
+	fake.Matrices[source.Query{
+		Namespace: "default",
+		Workload:  "productpage-v1",
+		Direction: source.Downstream,
+	}] = promModel.Matrix{
+		&promModel.SampleStream{Metric: metric, Values: latencies},
+	}
+	// 1ms of another series yesterday, it's not compared
+	other := []promModel.SamplePair{}
+	for _, samplePair := range latencies {
+		if samplePair.Timestamp.Time().Before(start) {
+			other = append(other, promModel.SamplePair{
+				Timestamp: samplePair.Timestamp,
+				Value:     0.001,
+			})
+		}
+	}
+	fake.Matrices[source.Query{
+		Namespace: "default",
+		Workload:  "productpage-v1",
+	}] = promModel.Matrix{
+		&promModel.SampleStream{Metric: promModel.Metric{}, Values: latencies},
+		&promModel.SampleStream{
+			Metric: promModel.Metric{"reporter": "source"},
+			Values: other,
+		},
+	}
+
+	tests := []struct {
+		baseline string
+		expected string
+	}{
+		{BaselinePrevious, "high"},
+		{BaselineDaily, "ok"},
+		// Falls back to the steps without samples a week earlier
+		{BaselineWeekly, "high"},
+		{BaselineBlend, "ok"},
+	}
+	for _, test := range tests {
+		workload, err := GetWorkloadStatusByName(
+			context.Background(),
+			fake,
+			"default",
+			"productpage-v1",
+			start.Add(15*time.Minute),
+			end,
+			start,
+			5*time.Minute,
+			StatusOptions{
+				Quantiles: []float64{0.95},
+				Baseline:  test.baseline,
+				LatencyThresholds: &Thresholds{
+					Default: &Threshold{Relative: 0.2, Absolute: 0.005},
+				},
+			},
+		)
+		assert.NoError(t, err)
+		assert.Len(t, workload.Statuses, 7, test.baseline)
+		assert.Equal(t, test.expected, workload.Statuses[6].Status, test.baseline)
+		assert.Equal(
+			t,
+			test.expected,
+			workload.Destinations[0].Statuses[6].Status,
+			test.baseline,
+		)
+	}
+}
+
+// Counts the queries of the fake source
+type countingSource struct {
+	*source.Fake
+	queries int
+}
+
+func (s *countingSource) Edges(
+	ctx context.Context,
+	query source.Query,
+) (promModel.Matrix, error) {
+	s.queries++
+	return s.Fake.Edges(ctx, query)
+}
+
+func (s *countingSource) Statuses(
+	ctx context.Context,
+	query source.Query,
+) (promModel.Matrix, error) {
+	s.queries++
+	return s.Fake.Statuses(ctx, query)
+}
+
+func TestGetStatusesSeasonalWithoutSamples(t *testing.T) {
+	counting := &countingSource{Fake: source.NewFake()}
+	query := source.Query{
+		Namespace: "default",
+		Workload:  "productpage-v1",
+		Start:     time.Unix(0, 0).Add(week),
+		End:       time.Unix(0, 0).Add(week + time.Hour),
+	}
+	options := StatusOptions{Baseline: BaselineBlend}
+
+	// The shifted ranges aren't queried without samples
+	statuses, err := getStatuses(
+		context.Background(),
+		counting,
+		query,
+		5*time.Minute,
+		latencyDetection,
+		options,
+	)
+	assert.NoError(t, err)
+	assert.Empty(t, statuses)
+
+	query.Direction = source.Downstream
+	edges, err := getEdges(
+		context.Background(),
+		counting,
+		query,
+		5*time.Minute,
+		latencyDetection,
+		options,
+	)
+	assert.NoError(t, err)
+	assert.Empty(t, edges)
+	assert.Equal(t, 2, counting.queries)
+}
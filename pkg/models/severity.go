@@ -0,0 +1,25 @@
+package models
+
+// Severity is the graded status of a step.
+type Severity string
+
+const (
+	// SeverityOK is within the threshold
+	SeverityOK Severity = "ok"
+	// SeverityWarning is within the threshold, closer to it than to the
+	// baseline
+	SeverityWarning Severity = "warning"
+	// SeverityHigh is above the threshold
+	SeverityHigh Severity = "high"
+	// SeverityCritical is above the double of the threshold
+	SeverityCritical Severity = "critical"
+	// SeverityLow is below the threshold, like suspiciously fast responses
+	// which often mean errors
+	SeverityLow Severity = "low"
+	// SeverityNoData has no values
+	SeverityNoData Severity = "no-data"
+)
+
+// Scores of the warning and the critical steps
+const warningScore = 0.5
+const criticalScore = 2
@@ -14,8 +14,26 @@ import (
 // 0.1 millisecond accuracy (results are in second)
 const decimals = 10000
 
-// 0.5 milliseconds
-const highTolerance = 0.5
+// 5 percentage points of the responses
+const errorRateTolerance = 0.05
+
+// 5 milliseconds of network and sidecar overhead
+const reporterGapTolerance = 0.005
+
+// Rate falling under half of the baseline is a drop
+const trafficDropRatio = 0.5
+
+// Rate exceeding the double of the baseline is a spike
+const trafficSpikeRatio = 2
+
+// Changes smaller than 0.1 request per second are ignored
+const trafficTolerance = 0.1
+
+// Changes smaller than 0.1 TCP connection per second are ignored
+const connectionTolerance = 0.1
+
+// Changes smaller than 1 KiB per second are ignored
+const throughputTolerance = 1024
 
 type unixTime = int64
 
@@ -23,6 +41,19 @@ type unixTime = int64
 type AggregatedStatus struct {
 	Step           time.Duration
 	StatusTimeline map[unixTime]AggregatedStatusItem
+	// Compares the steps to the baseline, when nil medians exceeding the
+	// approximate median with DefaultLatencyThreshold are above
+	Detector Detector
+	// Threshold of the detector, echoed in the status items
+	Threshold *Threshold
+	// Status of the verdicts, when nil steps above the baseline are "high"
+	Classify func(verdict Verdict) string
+	// Grades the statuses by Severity and scores the steps, steps without
+	// values are "no-data"
+	Graded bool
+	// The baseline is only the historical values, the values of the steps
+	// are added when the historical values don't establish it
+	Seasonal bool
 }
 
 // AggregatedStatusItem holds the status.
@@ -34,6 +65,11 @@ type AggregatedStatusItem struct {
 	ApproximateMedian *float64 `json:"approximateMedian"`
 	Avg               *float64 `json:"avg"`
 	Median            *float64 `json:"median"`
+	// Threshold the step is compared with, null without values
+	Threshold *Threshold `json:"threshold"`
+	// Anomaly score of the graded statuses: the deviation from the baseline
+	// in units of the threshold, beyond 1 and -1 outside of it
+	Score *float64 `json:"score,omitempty"`
 }
 
 // AddSample adds a new workload status.
@@ -72,6 +108,12 @@ func (as *AggregatedStatus) Aggregate(
 ) []AggregatedStatusItem {
 	statusItems := make([]AggregatedStatusItem, 0, len(as.StatusTimeline))
 
+	// Streaming estimate of the baseline, the historical values are added
+	// once instead of re-sorting them on every step
+	baseline := NewBaseline(historicalSampleValues)
+	addSteps := !as.Seasonal || !baseline.Established()
+	detector := as.detector()
+
 	// Sort timeline steps
 	timeKeys := util.SliceInt64{}
 	for timeKey := range as.StatusTimeline {
@@ -85,6 +127,9 @@ func (as *AggregatedStatus) Aggregate(
 
 		// Skip if we don't have any values for time frame
 		if len(statusItem.Values) == 0 {
+			if as.Graded {
+				statusItem.Status = string(SeverityNoData)
+			}
 			statusItems = append(statusItems, statusItem)
 			continue
 		}
@@ -102,11 +147,11 @@ func (as *AggregatedStatus) Aggregate(
 
 		// We add current values to historical values before we calculate the
 		// approximate median
-		for _, value := range statusItem.Values {
-			historicalSampleValues = append(historicalSampleValues, value)
+		if addSteps {
+			baseline.Add(statusItem.Values...)
 		}
-		if len(historicalSampleValues) > 5 {
-			approximateMedian = statistics.ApproximateMedian(historicalSampleValues)
+		if baseline.Established() {
+			approximateMedian = baseline.Median()
 		}
 
 		// Store statistical results
@@ -124,10 +169,15 @@ func (as *AggregatedStatus) Aggregate(
 		}
 
 		// Determinate status
-		if (medianFormatted - highTolerance) <= amFormatted {
-			statusItem.Status = "ok"
-		} else {
-			statusItem.Status = "high"
+		verdict := detector.Detect(baseline, statusItem.Values)
+		if stepped, ok := detector.(SteppedDetector); ok {
+			stepped.Advance(baseline, statusItem.Values)
+		}
+		statusItem.Threshold = as.Threshold
+		statusItem.Status = as.classify(verdict)
+		if as.Graded {
+			score := roundToDecimals(verdict.Score)
+			statusItem.Score = &score
 		}
 
 		statusItems = append(statusItems, statusItem)
@@ -135,20 +185,188 @@ func (as *AggregatedStatus) Aggregate(
 	return statusItems
 }
 
+// Fill adds an empty step for every missing step after start until end.
+func (as *AggregatedStatus) Fill(start time.Time, end time.Time) {
+	step := start.Round(as.Step)
+	if !step.After(start) {
+		step = step.Add(as.Step)
+	}
+	for ; !step.After(end); step = step.Add(as.Step) {
+		if _, found := as.StatusTimeline[step.Unix()]; !found {
+			as.StatusTimeline[step.Unix()] = AggregatedStatusItem{
+				Time:   step,
+				Values: make([]float64, 0),
+			}
+		}
+	}
+}
+
+func (as *AggregatedStatus) detector() Detector {
+	if as.Detector == nil {
+		return latencyDetection.detector(DetectorMedian)
+	}
+	return as.Detector
+}
+
+func (as *AggregatedStatus) classify(verdict Verdict) string {
+	if as.Classify != nil {
+		return as.Classify(verdict)
+	}
+	if as.Graded {
+		return latencyDetection.severity(verdict)
+	}
+	return latencyDetection.status(verdict)
+}
+
+// Signal specific outlier detection
+type detection struct {
+	// Smallest deviation from the baseline that is an outlier
+	threshold Threshold
+	// The threshold is configured by workload and edge
+	configurable bool
+	// The median rule compares rates relative to the baseline
+	relative bool
+	// Status of the steps above and below the baseline, ok when empty
+	above string
+	below string
+	// Graded steps below the baseline are low, otherwise ok
+	low bool
+	// Steps without samples mean zero, like no requests at all
+	zeroFill bool
+}
+
+// Detector of the signal by name, the median rule when unknown
+func (d detection) detector(name string) Detector {
+	switch name {
+	case DetectorMAD:
+		return madDetector{deviations: madDeviations, threshold: d.threshold}
+	case DetectorZScore:
+		return zScoreDetector{
+			deviations: zScoreDeviations,
+			threshold:  d.threshold,
+		}
+	case DetectorEWMA:
+		return &ewmaDetector{
+			lambda:     ewmaLambda,
+			deviations: ewmaDeviations,
+			threshold:  d.threshold,
+		}
+	}
+	if d.relative {
+		return relativeRule{
+			threshold:  d.threshold,
+			dropRatio:  trafficDropRatio,
+			spikeRatio: trafficSpikeRatio,
+		}
+	}
+	return medianRule{threshold: d.threshold}
+}
+
+func (d detection) status(verdict Verdict) string {
+	if verdict.Direction == Above && d.above != "" {
+		return d.above
+	}
+	if verdict.Direction == Below && d.below != "" {
+		return d.below
+	}
+	return "ok"
+}
+
+// Graded status of the verdict
+func (d detection) severity(verdict Verdict) string {
+	switch {
+	case verdict.Direction == Above && verdict.Score > criticalScore:
+		return string(SeverityCritical)
+	case verdict.Direction == Above:
+		return string(SeverityHigh)
+	case verdict.Direction == Below && d.low:
+		return string(SeverityLow)
+	case verdict.Score > warningScore:
+		return string(SeverityWarning)
+	}
+	return string(SeverityOK)
+}
+
+var latencyDetection = detection{
+	threshold:    DefaultLatencyThreshold,
+	configurable: true,
+	above:        "high",
+	low:          true,
+}
+
+var errorRateDetection = detection{
+	threshold: Threshold{Absolute: errorRateTolerance},
+	above:     "errors",
+}
+
+var grpcErrorRateDetection = detection{
+	threshold: Threshold{Absolute: errorRateTolerance},
+	above:     "grpc-errors",
+}
+
+var reporterGapDetection = detection{
+	threshold: Threshold{Absolute: reporterGapTolerance},
+	above:     "high-gap",
+}
+
+var trafficDetection = detection{
+	threshold: Threshold{Absolute: trafficTolerance},
+	relative:  true,
+	above:     "traffic-spike",
+	below:     "traffic-drop",
+	low:       true,
+	zeroFill:  true,
+}
+
+var connectionDetection = detection{
+	threshold: Threshold{Absolute: connectionTolerance},
+	relative:  true,
+	above:     "connections-spike",
+	below:     "connections-drop",
+	low:       true,
+	zeroFill:  true,
+}
+
+var throughputDetection = detection{
+	threshold: Threshold{Absolute: throughputTolerance},
+	relative:  true,
+	above:     "throughput-spike",
+	below:     "throughput-drop",
+	low:       true,
+	zeroFill:  true,
+}
+
 // Calculates statuses based on samples
 func calculateStatusesBySamples(
 	samples []promModel.SamplePair,
 	start time.Time,
+	end time.Time,
 	statusStep time.Duration,
+	detection detection,
+	options StatusOptions,
+	seasonalSampleValues statistics.Measurements,
 ) []AggregatedStatusItem {
-	historicalSampleValues := statistics.Measurements{}
+	// Values of the seasonal windows are historical values as well
+	historicalSampleValues := append(
+		statistics.Measurements{},
+		seasonalSampleValues...,
+	)
 
 	aggregatedStatus := AggregatedStatus{
 		Step:           statusStep,
 		StatusTimeline: make(map[int64]AggregatedStatusItem),
+		Detector:       detection.detector(options.Detector),
+		Threshold:      &detection.threshold,
+		Classify:       detection.status,
+		Graded:         options.Graded,
+		Seasonal:       isSeasonal(options.Baseline),
+	}
+	if options.Graded {
+		aggregatedStatus.Classify = detection.severity
 	}
 
-	// Sort sample pairs by time
+	// Sort sample pairs by time, on a copy as sources can share the results
+	samples = append([]promModel.SamplePair(nil), samples...)
 	sort.Slice(samples, func(i, j int) bool {
 		return samples[i].Timestamp.Time().Unix() <
 			samples[j].Timestamp.Time().Unix()
@@ -175,6 +393,22 @@ func calculateStatusesBySamples(
 		}
 	}
 
+	// Missing steps of the graded statuses are "no-data"
+	if options.Graded {
+		aggregatedStatus.Fill(start, end)
+	}
+
+	// Missing steps have zero value, the series disappears without requests
+	if detection.zeroFill {
+		aggregatedStatus.Fill(start, end)
+		for timeKey, statusItem := range aggregatedStatus.StatusTimeline {
+			if len(statusItem.Values) == 0 {
+				statusItem.Values = append(statusItem.Values, 0)
+				aggregatedStatus.StatusTimeline[timeKey] = statusItem
+			}
+		}
+	}
+
 	// Calculate statuses
 	statuses := aggregatedStatus.Aggregate(historicalSampleValues)
 	return statuses
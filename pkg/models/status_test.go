@@ -84,3 +84,103 @@ func TestAggregate(t *testing.T) {
 		},
 	}, statuses)
 }
+
+func TestAggregateGraded(t *testing.T) {
+	sampleTime1, _ := time.Parse(time.RFC3339, "1970-01-01T00:01:00.000001+00:00")
+	sampleTime2, _ := time.Parse(time.RFC3339, "1970-01-01T00:01:02.000000+00:00")
+	sampleTime3, _ := time.Parse(time.RFC3339, "1970-01-01T00:01:03.000000+00:00")
+
+	status := AggregatedStatus{
+		StatusTimeline: map[unixTime]AggregatedStatusItem{
+			60: AggregatedStatusItem{
+				Time:   sampleTime1,
+				Values: []float64{10, 11, 12, 11, 13, 19},
+			},
+			62: AggregatedStatusItem{
+				Time:   sampleTime2,
+				Values: []float64{},
+			},
+			63: AggregatedStatusItem{
+				Time:   sampleTime3,
+				Values: []float64{12, 14, 15, 16, 17},
+			},
+		},
+		Detector: medianRule{threshold: Threshold{Relative: 0.2}},
+		Graded:   true,
+	}
+
+	var historicalSampleValues statistics.Measurements = statistics.Measurements{10, 11, 12, 13, 12, 11}
+	statuses := status.Aggregate(historicalSampleValues)
+
+	assert.Len(t, statuses, 3)
+	assert.Equal(t, "ok", statuses[0].Status)
+	assert.Equal(t, 0.0, *statuses[0].Score)
+	assert.Equal(t, "no-data", statuses[1].Status)
+	assert.Nil(t, statuses[1].Score)
+	// 3 over the baseline of 12 with a 2.4 threshold
+	assert.Equal(t, "high", statuses[2].Status)
+	assert.Equal(t, 1.25, *statuses[2].Score)
+}
+
+func TestSeverity(t *testing.T) {
+	assert.Equal(t, "ok", latencyDetection.severity(Verdict{Score: 0.2}))
+	assert.Equal(t, "warning", latencyDetection.severity(Verdict{Score: 0.8}))
+	assert.Equal(t, "high", latencyDetection.severity(Verdict{Direction: Above, Score: 1.5}))
+	assert.Equal(t, "critical", latencyDetection.severity(Verdict{Direction: Above, Score: 2.5}))
+	// Below the baseline
+	assert.Equal(t, "ok", latencyDetection.severity(Verdict{Score: -0.8}))
+	assert.Equal(t, "low", latencyDetection.severity(Verdict{Direction: Below, Score: -1.5}))
+	assert.Equal(t, "ok", errorRateDetection.severity(Verdict{Direction: Below, Score: -1.5}))
+	assert.Equal(t, "low", trafficDetection.severity(Verdict{Direction: Below, Score: -1.5}))
+}
+
+func TestClassifyTraffic(t *testing.T) {
+	rule := trafficDetection.detector(DetectorMedian).(relativeRule)
+	classifyTraffic := func(median float64, approximateMedian float64) string {
+		return trafficDetection.status(rule.compare(median, approximateMedian))
+	}
+
+	// No baseline
+	assert.Equal(t, "ok", classifyTraffic(10, 0))
+
+	assert.Equal(t, "ok", classifyTraffic(10, 10))
+	assert.Equal(t, "ok", classifyTraffic(6, 10))
+	assert.Equal(t, "traffic-drop", classifyTraffic(4, 10))
+	assert.Equal(t, "traffic-drop", classifyTraffic(0, 10))
+	assert.Equal(t, "ok", classifyTraffic(19, 10))
+	assert.Equal(t, "traffic-spike", classifyTraffic(21, 10))
+
+	// Too small changes
+	assert.Equal(t, "ok", classifyTraffic(0, 0.05))
+	assert.Equal(t, "ok", classifyTraffic(0.15, 0.05))
+}
+
+func TestFill(t *testing.T) {
+	start := time.Unix(0, 0)
+	status := AggregatedStatus{
+		Step: time.Minute,
+		StatusTimeline: map[unixTime]AggregatedStatusItem{
+			120: AggregatedStatusItem{
+				Time:   start.Add(2 * time.Minute),
+				Values: []float64{1},
+			},
+		},
+	}
+
+	status.Fill(start, start.Add(3*time.Minute))
+
+	assert.Equal(t, map[unixTime]AggregatedStatusItem{
+		60: AggregatedStatusItem{
+			Time:   start.Add(time.Minute),
+			Values: []float64{},
+		},
+		120: AggregatedStatusItem{
+			Time:   start.Add(2 * time.Minute),
+			Values: []float64{1},
+		},
+		180: AggregatedStatusItem{
+			Time:   start.Add(3 * time.Minute),
+			Values: []float64{},
+		},
+	}, status.StatusTimeline)
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"fmt"
+	"math"
+)
+
+// Threshold is the deviation from the baseline an outlier exceeds, the
+// larger of the relative and the absolute deviation.
+type Threshold struct {
+	// Fraction of the baseline, like 0.2 for 20% over the baseline
+	Relative float64 `json:"relative" yaml:"relative"`
+	// Deviation in the unit of the signal, seconds for latencies
+	Absolute float64 `json:"absolute" yaml:"absolute"`
+}
+
+// Tolerance returns the deviation allowed from the baseline.
+func (t Threshold) Tolerance(baseline float64) float64 {
+	return math.Max(t.Relative*math.Abs(baseline), t.Absolute)
+}
+
+// Validate returns an error for negative or zero thresholds.
+func (t Threshold) Validate() error {
+	if t.Relative < 0 || t.Absolute < 0 {
+		return fmt.Errorf("threshold can't be negative")
+	}
+	if t.Relative == 0 && t.Absolute == 0 {
+		return fmt.Errorf("threshold needs a relative or an absolute value")
+	}
+	return nil
+}
+
+// DefaultLatencyThreshold is used for the workloads and the edges without
+// a configured threshold: 500 milliseconds over the baseline.
+var DefaultLatencyThreshold = Threshold{Absolute: 0.5}
+
+// Thresholds configures the latency thresholds by workload and edge.
+type Thresholds struct {
+	// DefaultLatencyThreshold when nil
+	Default *Threshold `yaml:"default"`
+	// Latency of the workloads, used for their statuses and the edges they
+	// are the destination of
+	Workloads []WorkloadThreshold `yaml:"workloads"`
+	// Latency of the edges, from the source to the destination
+	Edges []EdgeThreshold `yaml:"edges"`
+}
+
+// WorkloadThreshold is the threshold of a workload.
+type WorkloadThreshold struct {
+	// Any namespace when empty
+	Namespace string `yaml:"namespace"`
+	Workload  string `yaml:"workload"`
+	Threshold `yaml:",inline"`
+}
+
+// EdgeThreshold is the threshold of the edges between two workloads.
+type EdgeThreshold struct {
+	// Any namespace when empty
+	SourceNamespace      string `yaml:"sourceNamespace"`
+	Source               string `yaml:"source"`
+	DestinationNamespace string `yaml:"destinationNamespace"`
+	Destination          string `yaml:"destination"`
+	Threshold            `yaml:",inline"`
+}
+
+// Validate returns an error for the thresholds without a workload and for
+// invalid threshold values.
+func (t *Thresholds) Validate() error {
+	if t.Default != nil {
+		if err := t.Default.Validate(); err != nil {
+			return fmt.Errorf("invalid default threshold: %s", err)
+		}
+	}
+	for _, w := range t.Workloads {
+		if w.Workload == "" {
+			return fmt.Errorf("workload threshold without workload")
+		}
+		if err := w.Validate(); err != nil {
+			return fmt.Errorf("invalid threshold of %s: %s", w.Workload, err)
+		}
+	}
+	for _, e := range t.Edges {
+		if e.Source == "" || e.Destination == "" {
+			return fmt.Errorf("edge threshold without source or destination")
+		}
+		if err := e.Validate(); err != nil {
+			return fmt.Errorf(
+				"invalid threshold of %s -> %s: %s",
+				e.Source,
+				e.Destination,
+				err,
+			)
+		}
+	}
+	return nil
+}
+
+// Workload returns the threshold of the workload, the default when it has
+// none. Thresholds can be nil.
+func (t *Thresholds) Workload(namespace string, name string) Threshold {
+	if t == nil {
+		return DefaultLatencyThreshold
+	}
+	for _, w := range t.Workloads {
+		if w.Workload == name && matchesNamespace(w.Namespace, namespace) {
+			return w.Threshold
+		}
+	}
+	if t.Default != nil {
+		return *t.Default
+	}
+	return DefaultLatencyThreshold
+}
+
+// Edge returns the threshold of the edge, the threshold of the destination
+// workload when it has none. Thresholds can be nil.
+func (t *Thresholds) Edge(
+	sourceNamespace string,
+	source string,
+	destinationNamespace string,
+	destination string,
+) Threshold {
+	if t != nil {
+		for _, e := range t.Edges {
+			if e.Source == source && e.Destination == destination &&
+				matchesNamespace(e.SourceNamespace, sourceNamespace) &&
+				matchesNamespace(e.DestinationNamespace, destinationNamespace) {
+				return e.Threshold
+			}
+		}
+	}
+	return t.Workload(destinationNamespace, destination)
+}
+
+// Empty configured namespaces match any namespace, empty namespaces of the
+// requests only the configurations without namespace
+func matchesNamespace(configured string, namespace string) bool {
+	return configured == "" || configured == namespace
+}
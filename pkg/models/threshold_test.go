@@ -0,0 +1,84 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThresholdTolerance(t *testing.T) {
+	threshold := Threshold{Relative: 0.2, Absolute: 0.005}
+	// Absolute floor
+	assert.Equal(t, 0.005, threshold.Tolerance(0.002))
+	assert.InDelta(t, 0.4, threshold.Tolerance(2), 1e-9)
+	assert.Equal(t, 0.0, Threshold{Relative: 0.2}.Tolerance(0))
+}
+
+func TestThresholdsValidate(t *testing.T) {
+	assert.NoError(t, (&Thresholds{}).Validate())
+	assert.EqualError(t, (&Thresholds{
+		Default: &Threshold{},
+	}).Validate(), "invalid default threshold: threshold needs a relative or an absolute value")
+	assert.EqualError(t, (&Thresholds{
+		Workloads: []WorkloadThreshold{{Threshold: Threshold{Relative: 1}}},
+	}).Validate(), "workload threshold without workload")
+	assert.EqualError(t, (&Thresholds{
+		Workloads: []WorkloadThreshold{
+			{Workload: "reviews-v3", Threshold: Threshold{Relative: -1}},
+		},
+	}).Validate(), "invalid threshold of reviews-v3: threshold can't be negative")
+	assert.EqualError(t, (&Thresholds{
+		Edges: []EdgeThreshold{
+			{Source: "productpage-v1", Threshold: Threshold{Relative: 1}},
+		},
+	}).Validate(), "edge threshold without source or destination")
+}
+
+func TestThresholdsLookup(t *testing.T) {
+	var thresholds *Thresholds
+	assert.Equal(t, DefaultLatencyThreshold, thresholds.Workload("default", "reviews-v3"))
+	assert.Equal(
+		t,
+		DefaultLatencyThreshold,
+		thresholds.Edge("default", "productpage-v1", "default", "reviews-v3"),
+	)
+
+	reviews := Threshold{Relative: 0.5}
+	cache := Threshold{Absolute: 0.001}
+	edge := Threshold{Absolute: 0.1}
+	fallback := Threshold{Relative: 0.25}
+	thresholds = &Thresholds{
+		Default: &fallback,
+		Workloads: []WorkloadThreshold{
+			{Namespace: "default", Workload: "reviews-v3", Threshold: reviews},
+			{Workload: "redis-cache", Threshold: cache},
+		},
+		Edges: []EdgeThreshold{
+			{Source: "productpage-v1", Destination: "reviews-v3", Threshold: edge},
+		},
+	}
+
+	assert.Equal(t, reviews, thresholds.Workload("default", "reviews-v3"))
+	assert.Equal(t, fallback, thresholds.Workload("staging", "reviews-v3"))
+	// Any namespace
+	assert.Equal(t, fallback, thresholds.Workload("", "reviews-v3"))
+	assert.Equal(t, cache, thresholds.Workload("staging", "redis-cache"))
+	assert.Equal(t, fallback, thresholds.Workload("default", "details-v1"))
+
+	assert.Equal(
+		t,
+		edge,
+		thresholds.Edge("default", "productpage-v1", "default", "reviews-v3"),
+	)
+	// Threshold of the destination
+	assert.Equal(
+		t,
+		reviews,
+		thresholds.Edge("default", "reviews-v2", "default", "reviews-v3"),
+	)
+	assert.Equal(
+		t,
+		cache,
+		thresholds.Edge("default", "reviews-v3", "default", "redis-cache"),
+	)
+}
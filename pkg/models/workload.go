@@ -2,11 +2,46 @@ package models
 
 // Workload struct.
 type Workload struct {
-	Name         string                 `json:"name"`          // name of the workload
-	App          string                 `json:"app,omitempty"` // istio app
+	Namespace    string                 `json:"namespace,omitempty"` // kubernetes namespace
+	Name         string                 `json:"name"`                // name of the workload
+	App          string                 `json:"app,omitempty"`       // istio app
+	Protocol     string                 `json:"protocol,omitempty"`  // http, grpc or tcp edge
 	Sources      []Workload             `json:"sources"`
 	Destinations []Workload             `json:"destinations"`
 	Statuses     []AggregatedStatusItem `json:"statuses"`
+	Quantiles    []QuantileStatuses     `json:"quantiles,omitempty"`
+	// Statuses of the 5xx response ratio
+	Errors []AggregatedStatusItem `json:"errors,omitempty"`
+	// Statuses of the non-OK gRPC status ratio
+	GRPCErrors []AggregatedStatusItem `json:"grpcErrors,omitempty"`
+	// Statuses of the request rate, drops and spikes
+	Traffic []AggregatedStatusItem `json:"traffic,omitempty"`
+	// Statuses of the source minus the destination reported request duration
+	ReporterGap []AggregatedStatusItem `json:"reporterGap,omitempty"`
+	// Statuses of the opened and closed TCP connections per second
+	Connections []AggregatedStatusItem `json:"connections,omitempty"`
+	// Statuses of the sent and received TCP bytes per second
+	Throughput []AggregatedStatusItem `json:"throughput,omitempty"`
+	// Requests per second of the edge in the topology
+	RequestRate *float64 `json:"requestRate,omitempty"`
+	// Opened TCP connections per second of the edge in the topology
+	ConnectionRate *float64 `json:"connectionRate,omitempty"`
+	// Ratio of non-OK gRPC calls of the edge in the topology
+	GRPCErrorRate *float64 `json:"grpcErrorRate,omitempty"`
+	// Window the rates of the statuses are calculated over, like 60s
+	RateWindow string `json:"rateWindow,omitempty"`
+}
+
+// TCP edges are marked with the "tcp" protocol
+const protocolTCP = "tcp"
+
+// gRPC edges are marked with the "grpc" protocol
+const protocolGRPC = "grpc"
+
+// QuantileStatuses holds the statuses of a request duration quantile.
+type QuantileStatuses struct {
+	Quantile float64                `json:"quantile"`
+	Statuses []AggregatedStatusItem `json:"statuses"`
 }
 
 // AddSource adds a source workload
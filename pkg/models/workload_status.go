@@ -1,11 +1,14 @@
 package models
 
 import (
+	"context"
+	"errors"
 	"sync"
 	"time"
 
 	multierror "github.com/hashicorp/go-multierror"
-	"github.com/hekike/outlier-istio/pkg/prometheus"
+	"github.com/hekike/outlier-istio/pkg/source"
+	promModel "github.com/prometheus/common/model"
 )
 
 // WorkloadStatus struct.
@@ -14,167 +17,549 @@ type WorkloadStatus struct {
 	Status string    `json:"status"`
 }
 
+// StatusOptions configures the analyses of GetWorkloadStatusByName.
+type StatusOptions struct {
+	// Request duration quantiles, the first one is used for the Statuses
+	Quantiles []float64
+	// Compares the request durations reported by the source and the
+	// destination of the edges in the first quantile
+	ReporterGap bool
+	// Name of the detector, DefaultDetector when empty
+	Detector string
+	// Latency thresholds by workload and edge, DefaultLatencyThreshold when
+	// nil
+	LatencyThresholds *Thresholds
+	// Grades the statuses by Severity and scores them
+	Graded bool
+	// Baseline mode, DefaultBaseline when empty
+	Baseline string
+}
+
 // GetWorkloadStatusByName returns a single workload with it's status.
+// Latency statuses are calculated for every quantile, the first quantile is
+// used for the workload's and its edges' Statuses. Error statuses are
+// calculated from the ratio of 5xx responses, gRPC error statuses from the
+// ratio of non-OK grpc_response_status, traffic statuses from the request
+// rate, connections and throughput statuses from the TCP metrics. The
+// reporter gap of the edges is only calculated when requested. The steps are
+// compared to the baseline by the detector of the options, latencies with
+// the threshold of the workload or the edge, graded by Severity when the
+// options ask for it. Seasonal baselines fetch the same range 1 day or 7
+// days earlier. The rate window of the source is returned in RateWindow.
+// Queries are aborted when ctx is done or when any of them fails.
 func GetWorkloadStatusByName(
-	addr string,
+	ctx context.Context,
+	metricsSource source.MetricsSource,
+	namespace string,
 	name string,
 	start time.Time,
 	end time.Time,
 	/** we fetch historical values for baseline calculation */
 	historicalStart time.Time,
 	statusStep time.Duration,
+	options StatusOptions,
 ) (*Workload, error) {
+	quantiles := options.Quantiles
+
 	workload := Workload{
+		Namespace:    namespace,
 		Name:         name,
 		Statuses:     make([]AggregatedStatusItem, 0),
+		Quantiles:    make([]QuantileStatuses, 0, len(quantiles)),
 		Sources:      make([]Workload, 0),
 		Destinations: make([]Workload, 0),
+		RateWindow: source.FormatRateWindow(
+			metricsSource.RateWindow(historicalStart, end),
+		),
 	}
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	var wg sync.WaitGroup
+	var mu sync.Mutex
 	var combinedErr error
 
-	// Add destinations
-	wg.Add((1))
-	go func() {
-		defer wg.Done()
-		workloads, err := getDownstreams(
-			addr,
-			historicalStart,
-			end,
-			statusStep,
-			workload.Name,
-		)
-		if err != nil {
-			combinedErr = multierror.Append(combinedErr, err)
-		}
-		for _, w := range workloads {
-			workload.AddDestination(w)
-		}
-	}()
-
-	// Add sources
-	wg.Add((1))
-	go func() {
-		defer wg.Done()
-		workloads, err := getUpstreams(
-			addr,
-			historicalStart,
-			end,
-			statusStep,
-			workload.Name,
-		)
-		if err != nil {
-			combinedErr = multierror.Append(combinedErr, err)
-		}
-		for _, w := range workloads {
-			workload.AddSource(w)
+	// Collects the error and aborts the other queries
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		// Skip queries aborted by an earlier failure
+		if combinedErr != nil && errors.Is(err, context.Canceled) {
+			return
 		}
-	}()
-
-	// Add aggregated statuses
-	wg.Add((1))
-	go func() {
-		defer wg.Done()
-		statuses, err := getStatuses(
-			addr,
-			historicalStart,
-			end,
-			statusStep,
-			workload.Name,
-		)
-		if err != nil {
-			combinedErr = multierror.Append(combinedErr, err)
-		}
-		workload.Statuses = statuses
-	}()
+		combinedErr = multierror.Append(combinedErr, err)
+		cancel()
+	}
+
+	// Runs the query in parallel with the others
+	run := func(query func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := query(); err != nil {
+				fail(err)
+			}
+		}()
+	}
+
+	query := source.Query{
+		Namespace: namespace,
+		Workload:  name,
+		Start:     historicalStart,
+		End:       end,
+	}
+
+	// Latency results by quantile index
+	downstreams := make([][]Workload, len(quantiles))
+	upstreams := make([][]Workload, len(quantiles))
+	statuses := make([][]AggregatedStatusItem, len(quantiles))
+
+	for i, quantile := range quantiles {
+		i := i
+		latencyQuery := query
+		latencyQuery.Quantile = quantile
+
+		// Add destinations
+		run(func() (err error) {
+			downstreamQuery := latencyQuery
+			downstreamQuery.Direction = source.Downstream
+			downstreams[i], err = getEdges(
+				ctx,
+				metricsSource,
+				downstreamQuery,
+				statusStep,
+				latencyDetection,
+				options,
+			)
+			return err
+		})
+
+		// Add sources
+		run(func() (err error) {
+			upstreamQuery := latencyQuery
+			upstreamQuery.Direction = source.Upstream
+			upstreams[i], err = getEdges(
+				ctx,
+				metricsSource,
+				upstreamQuery,
+				statusStep,
+				latencyDetection,
+				options,
+			)
+			return err
+		})
+
+		// Add aggregated statuses
+		run(func() (err error) {
+			statuses[i], err = getStatuses(
+				ctx,
+				metricsSource,
+				latencyQuery,
+				statusStep,
+				latencyDetection,
+				options,
+			)
+			return err
+		})
+	}
+
+	// Runs the edge and workload queries of a signal
+	runSignal := func(
+		signal source.Signal,
+		detection detection,
+		downstream *[]Workload,
+		upstream *[]Workload,
+		statuses *[]AggregatedStatusItem,
+	) {
+		signalQuery := query
+		signalQuery.Signal = signal
+
+		run(func() (err error) {
+			downstreamQuery := signalQuery
+			downstreamQuery.Direction = source.Downstream
+			*downstream, err = getEdges(
+				ctx,
+				metricsSource,
+				downstreamQuery,
+				statusStep,
+				detection,
+				options,
+			)
+			return err
+		})
+		run(func() (err error) {
+			upstreamQuery := signalQuery
+			upstreamQuery.Direction = source.Upstream
+			*upstream, err = getEdges(
+				ctx,
+				metricsSource,
+				upstreamQuery,
+				statusStep,
+				detection,
+				options,
+			)
+			return err
+		})
+		run(func() (err error) {
+			*statuses, err = getStatuses(
+				ctx,
+				metricsSource,
+				signalQuery,
+				statusStep,
+				detection,
+				options,
+			)
+			return err
+		})
+	}
+
+	var downstreamErrors, upstreamErrors []Workload
+	runSignal(
+		source.ErrorRate,
+		errorRateDetection,
+		&downstreamErrors,
+		&upstreamErrors,
+		&workload.Errors,
+	)
+
+	var downstreamGRPCErrors, upstreamGRPCErrors []Workload
+	runSignal(
+		source.GRPCErrorRate,
+		grpcErrorRateDetection,
+		&downstreamGRPCErrors,
+		&upstreamGRPCErrors,
+		&workload.GRPCErrors,
+	)
+
+	var downstreamTraffic, upstreamTraffic []Workload
+	runSignal(
+		source.RequestRate,
+		trafficDetection,
+		&downstreamTraffic,
+		&upstreamTraffic,
+		&workload.Traffic,
+	)
+
+	var downstreamConnections, upstreamConnections []Workload
+	runSignal(
+		source.ConnectionChurn,
+		connectionDetection,
+		&downstreamConnections,
+		&upstreamConnections,
+		&workload.Connections,
+	)
+
+	var downstreamThroughput, upstreamThroughput []Workload
+	runSignal(
+		source.Throughput,
+		throughputDetection,
+		&downstreamThroughput,
+		&upstreamThroughput,
+		&workload.Throughput,
+	)
+
+	// Network and sidecar overhead
+	var downstreamGaps, upstreamGaps []Workload
+	if options.ReporterGap && len(quantiles) > 0 {
+		gapQuery := query
+		gapQuery.Signal = source.ReporterGap
+		gapQuery.Quantile = quantiles[0]
+
+		run(func() (err error) {
+			downstreamQuery := gapQuery
+			downstreamQuery.Direction = source.Downstream
+			downstreamGaps, err = getEdges(
+				ctx,
+				metricsSource,
+				downstreamQuery,
+				statusStep,
+				reporterGapDetection,
+				options,
+			)
+			return err
+		})
+		run(func() (err error) {
+			upstreamQuery := gapQuery
+			upstreamQuery.Direction = source.Upstream
+			upstreamGaps, err = getEdges(
+				ctx,
+				metricsSource,
+				upstreamQuery,
+				statusStep,
+				reporterGapDetection,
+				options,
+			)
+			return err
+		})
+	}
 
 	wg.Wait()
 
+	destinations := mergeQuantiles(quantiles, downstreams)
+	destinations = mergeErrors(destinations, downstreamErrors)
+	destinations = mergeGRPCErrors(destinations, downstreamGRPCErrors)
+	destinations = mergeTraffic(destinations, downstreamTraffic)
+	destinations = mergeConnections(destinations, downstreamConnections)
+	destinations = mergeThroughput(destinations, downstreamThroughput)
+	destinations = mergeReporterGaps(destinations, downstreamGaps)
+	for _, w := range destinations {
+		workload.AddDestination(w)
+	}
+	sources := mergeQuantiles(quantiles, upstreams)
+	sources = mergeErrors(sources, upstreamErrors)
+	sources = mergeGRPCErrors(sources, upstreamGRPCErrors)
+	sources = mergeTraffic(sources, upstreamTraffic)
+	sources = mergeConnections(sources, upstreamConnections)
+	sources = mergeThroughput(sources, upstreamThroughput)
+	sources = mergeReporterGaps(sources, upstreamGaps)
+	for _, w := range sources {
+		workload.AddSource(w)
+	}
+	for i, quantile := range quantiles {
+		workload.Quantiles = append(workload.Quantiles, QuantileStatuses{
+			Quantile: quantile,
+			Statuses: statuses[i],
+		})
+	}
+	if len(statuses) > 0 {
+		workload.Statuses = statuses[0]
+	}
+
 	return &workload, combinedErr
 }
 
-// Get downstream workloads with statuses
-func getDownstreams(
-	addr string,
-	start time.Time,
-	end time.Time,
-	statusStep time.Duration,
-	workload string,
-) ([]Workload, error) {
-	workloads := []Workload{}
+// Edges of different protocols between the same workloads are separate
+func edgeID(w Workload) string {
+	return w.Namespace + "/" + w.Name + "-" + w.App + "/" + w.Protocol
+}
 
-	matrix, err := prometheus.GetDownstreamRequestDurations(
-		addr,
-		start,
-		end,
-		workload,
-	)
-	if err != nil {
-		return workloads, err
-	}
+// Merges the edges of every quantile into a single list of edges
+func mergeQuantiles(
+	quantiles []float64,
+	workloadsByQuantile [][]Workload,
+) []Workload {
+	merged := []Workload{}
+	indexes := make(map[string]int)
 
-	// Iterate on destination workload dimension
-	for _, sampleStream := range matrix {
-		metric := sampleStream.Metric
-		statuses := calculateStatusesBySamples(
-			sampleStream.Values,
-			start,
-			statusStep,
-		)
-		name, app := getDestinationFromMetric(metric)
+	for i, workloads := range workloadsByQuantile {
+		for _, w := range workloads {
+			id := edgeID(w)
+			index, found := indexes[id]
+			if !found {
+				index = len(merged)
+				indexes[id] = index
+				merged = append(merged, Workload{
+					Namespace: w.Namespace,
+					Name:      w.Name,
+					App:       w.App,
+					Protocol:  w.Protocol,
+					Statuses:  make([]AggregatedStatusItem, 0),
+					Quantiles: make([]QuantileStatuses, 0, len(quantiles)),
+				})
+			}
 
-		workload := Workload{
-			Name:     name,
-			App:      app,
-			Statuses: statuses,
+			// First quantile is the default
+			if i == 0 {
+				merged[index].Statuses = w.Statuses
+			}
+			merged[index].Quantiles = append(
+				merged[index].Quantiles,
+				QuantileStatuses{
+					Quantile: quantiles[i],
+					Statuses: w.Statuses,
+				},
+			)
 		}
+	}
 
-		workloads = append(
-			workloads,
-			workload,
-		)
+	return merged
+}
+
+// Adds the error statuses to the edges, edges without latency are appended
+func mergeErrors(edges []Workload, errorEdges []Workload) []Workload {
+	return mergeSignal(
+		edges,
+		errorEdges,
+		func(w *Workload, statuses []AggregatedStatusItem) {
+			w.Errors = statuses
+		},
+	)
+}
+
+// Adds the gRPC error statuses to the gRPC edges
+func mergeGRPCErrors(edges []Workload, errorEdges []Workload) []Workload {
+	return mergeSignal(
+		edges,
+		errorEdges,
+		func(w *Workload, statuses []AggregatedStatusItem) {
+			w.GRPCErrors = statuses
+		},
+	)
+}
+
+// Adds the traffic statuses to the edges, edges without latency are appended
+func mergeTraffic(edges []Workload, trafficEdges []Workload) []Workload {
+	return mergeSignal(
+		edges,
+		trafficEdges,
+		func(w *Workload, statuses []AggregatedStatusItem) {
+			w.Traffic = statuses
+		},
+	)
+}
+
+// Adds the TCP connection statuses to the edges
+func mergeConnections(
+	edges []Workload,
+	connectionEdges []Workload,
+) []Workload {
+	return mergeSignal(
+		edges,
+		connectionEdges,
+		func(w *Workload, statuses []AggregatedStatusItem) {
+			w.Connections = statuses
+		},
+	)
+}
+
+// Adds the TCP throughput statuses to the edges
+func mergeThroughput(
+	edges []Workload,
+	throughputEdges []Workload,
+) []Workload {
+	return mergeSignal(
+		edges,
+		throughputEdges,
+		func(w *Workload, statuses []AggregatedStatusItem) {
+			w.Throughput = statuses
+		},
+	)
+}
+
+// Adds the reporter gap statuses to the edges
+func mergeReporterGaps(edges []Workload, gapEdges []Workload) []Workload {
+	return mergeSignal(
+		edges,
+		gapEdges,
+		func(w *Workload, statuses []AggregatedStatusItem) {
+			w.ReporterGap = statuses
+		},
+	)
+}
+
+// Sets the statuses of an other signal on the matching edges
+func mergeSignal(
+	edges []Workload,
+	signalEdges []Workload,
+	set func(w *Workload, statuses []AggregatedStatusItem),
+) []Workload {
+	indexes := make(map[string]int, len(edges))
+	for i, w := range edges {
+		indexes[edgeID(w)] = i
 	}
 
-	return workloads, nil
+	for _, w := range signalEdges {
+		index, found := indexes[edgeID(w)]
+		if !found {
+			index = len(edges)
+			indexes[edgeID(w)] = index
+			edges = append(edges, Workload{
+				Namespace: w.Namespace,
+				Name:      w.Name,
+				App:       w.App,
+				Protocol:  w.Protocol,
+				Statuses:  make([]AggregatedStatusItem, 0),
+			})
+		}
+		set(&edges[index], w.Statuses)
+	}
+
+	return edges
 }
 
-// Get upstream workloads with statuses
-func getUpstreams(
-	addr string,
-	start time.Time,
-	end time.Time,
+// The workload on the other side of the edge without statuses
+func getEdgeFromMetric(
+	direction source.Direction,
+	metric promModel.Metric,
+) Workload {
+	var namespace, name, app string
+	if direction == source.Downstream {
+		namespace, name, app = getDestinationFromMetric(metric)
+	} else {
+		namespace, name, app = getSourceFromMetric(metric)
+	}
+	return Workload{
+		Namespace: namespace,
+		Name:      name,
+		App:       app,
+		Protocol:  getProtocolFromMetric(metric),
+	}
+}
+
+// Get downstream or upstream workloads with statuses
+func getEdges(
+	ctx context.Context,
+	metricsSource source.MetricsSource,
+	query source.Query,
 	statusStep time.Duration,
-	workload string,
+	detection detection,
+	options StatusOptions,
 ) ([]Workload, error) {
 	workloads := []Workload{}
 
-	matrixByDestination, err := prometheus.GetUpstreamRequestDurations(
-		addr,
-		start,
-		end,
-		workload,
+	matrix, err := metricsSource.Edges(ctx, query)
+	if err != nil || len(matrix) == 0 {
+		return workloads, err
+	}
+
+	seasonalValues, err := getSeasonalValues(
+		ctx,
+		metricsSource.Edges,
+		query,
+		options.Baseline,
+		func(metric promModel.Metric) string {
+			return edgeID(getEdgeFromMetric(query.Direction, metric))
+		},
 	)
 	if err != nil {
 		return workloads, err
 	}
 
-	// Iterate on source workload dimension
-	for _, sampleStream := range matrixByDestination {
+	// Iterate on the other side's workload dimension
+	for _, sampleStream := range matrix {
 		metric := sampleStream.Metric
-		statuses := calculateStatusesBySamples(
+
+		workload := getEdgeFromMetric(query.Direction, metric)
+		edgeDetection := detection
+		if detection.configurable {
+			if query.Direction == source.Downstream {
+				edgeDetection.threshold = options.LatencyThresholds.Edge(
+					query.Namespace,
+					query.Workload,
+					workload.Namespace,
+					workload.Name,
+				)
+			} else {
+				edgeDetection.threshold = options.LatencyThresholds.Edge(
+					workload.Namespace,
+					workload.Name,
+					query.Namespace,
+					query.Workload,
+				)
+			}
+		}
+
+		workload.Statuses = calculateStatusesBySamples(
 			sampleStream.Values,
-			start,
+			query.Start,
+			query.End,
 			statusStep,
+			edgeDetection,
+			options,
+			seasonalValues[edgeID(workload)],
 		)
 
-		name, app := getSourceFromMetric(metric)
-		workload := Workload{
-			Name:     name,
-			App:      app,
-			Statuses: statuses,
-		}
-
 		workloads = append(
 			workloads,
 			workload,
@@ -186,27 +571,46 @@ func getUpstreams(
 
 // Returns statuses for given workload
 func getStatuses(
-	addr string,
-	start time.Time,
-	end time.Time,
+	ctx context.Context,
+	metricsSource source.MetricsSource,
+	query source.Query,
 	statusStep time.Duration,
-	workload string,
+	detection detection,
+	options StatusOptions,
 ) ([]AggregatedStatusItem, error) {
-	matrix, err := prometheus.GetStatuses(
-		addr,
-		start,
-		end,
-		workload,
-	)
+	matrix, err := metricsSource.Statuses(ctx, query)
 	if err != nil {
 		return make([]AggregatedStatusItem, 0), err
 	}
 
 	if len(matrix) > 0 {
+		// Only the first sample stream is compared, the seasonal streams
+		// are keyed by their metric
+		seasonalValues, err := getSeasonalValues(
+			ctx,
+			metricsSource.Statuses,
+			query,
+			options.Baseline,
+			func(metric promModel.Metric) string { return metric.String() },
+		)
+		if err != nil {
+			return make([]AggregatedStatusItem, 0), err
+		}
+
+		if detection.configurable {
+			detection.threshold = options.LatencyThresholds.Workload(
+				query.Namespace,
+				query.Workload,
+			)
+		}
 		statuses := calculateStatusesBySamples(
 			matrix[0].Values,
-			start,
+			query.Start,
+			query.End,
 			statusStep,
+			detection,
+			options,
+			seasonalValues[matrix[0].Metric.String()],
 		)
 		return statuses, nil
 	}
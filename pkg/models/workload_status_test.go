@@ -0,0 +1,490 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hekike/outlier-istio/pkg/source"
+	promModel "github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeQuantiles(t *testing.T) {
+	p50 := []AggregatedStatusItem{AggregatedStatusItem{Status: "ok"}}
+	p99 := []AggregatedStatusItem{AggregatedStatusItem{Status: "high"}}
+
+	merged := mergeQuantiles([]float64{0.5, 0.99}, [][]Workload{
+		[]Workload{
+			Workload{Namespace: "default", Name: "details-v1", Statuses: p50},
+		},
+		[]Workload{
+			Workload{Namespace: "default", Name: "details-v1", Statuses: p99},
+		},
+	})
+
+	assert.Equal(t, []Workload{
+		Workload{
+			Namespace: "default",
+			Name:      "details-v1",
+			Statuses:  p50,
+			Quantiles: []QuantileStatuses{
+				QuantileStatuses{Quantile: 0.5, Statuses: p50},
+				QuantileStatuses{Quantile: 0.99, Statuses: p99},
+			},
+		},
+	}, merged)
+}
+
+func TestGetWorkloadStatusByNameErrors(t *testing.T) {
+	start := time.Unix(0, 0)
+	end := start.Add(30 * time.Minute)
+	metric := promModel.Metric{
+		"source_workload_namespace":      "default",
+		"source_workload":                "productpage-v1",
+		"source_app":                     "productpage",
+		"destination_workload_namespace": "default",
+		"destination_workload":           "details-v1",
+		"destination_app":                "details",
+	}
+
+	// 1% errors, 50% in the last 5 minutes
+	errorRates := []promModel.SamplePair{}
+	for t := start; !t.After(end); t = t.Add(time.Minute) {
+		value := promModel.SampleValue(0.01)
+		if t.After(end.Add(-5 * time.Minute)) {
+			value = 0.5
+		}
+		errorRates = append(errorRates, promModel.SamplePair{
+			Timestamp: promModel.TimeFromUnixNano(t.UnixNano()),
+			Value:     value,
+		})
+	}
+
+	fake := source.NewFake()
+	fake.Matrices[source.Query{
+		Namespace: "default",
+		Workload:  "productpage-v1",
+		Direction: source.Downstream,
+		Signal:    source.ErrorRate,
+	}] = promModel.Matrix{
+		&promModel.SampleStream{Metric: metric, Values: errorRates},
+	}
+
+	workload, err := GetWorkloadStatusByName(
+		context.Background(),
+		fake,
+		"default",
+		"productpage-v1",
+		start.Add(15*time.Minute),
+		end,
+		start,
+		5*time.Minute,
+		StatusOptions{Quantiles: []float64{0.95}},
+	)
+	assert.NoError(t, err)
+
+	// Edge only has error rates
+	assert.Len(t, workload.Destinations, 1)
+	details := workload.Destinations[0]
+	assert.Equal(t, "details-v1", details.Name)
+	assert.Empty(t, details.Statuses)
+
+	statuses := make([]string, len(details.Errors))
+	for i, status := range details.Errors {
+		statuses[i] = status.Status
+	}
+	assert.Equal(t, []string{
+		"ok", "ok", "ok", "ok", "ok", "ok", "errors",
+	}, statuses)
+}
+
+func TestGetWorkloadStatusByNameTraffic(t *testing.T) {
+	start := time.Unix(0, 0)
+	end := start.Add(30 * time.Minute)
+	metric := promModel.Metric{
+		"source_workload_namespace":      "default",
+		"source_workload":                "productpage-v1",
+		"source_app":                     "productpage",
+		"destination_workload_namespace": "default",
+		"destination_workload":           "details-v1",
+		"destination_app":                "details",
+	}
+
+	// 10 requests per second, the series disappears in the last 5 minutes
+	requestRates := []promModel.SamplePair{}
+	for t := start; t.Before(end.Add(-5 * time.Minute)); t = t.Add(time.Minute) {
+		requestRates = append(requestRates, promModel.SamplePair{
+			Timestamp: promModel.TimeFromUnixNano(t.UnixNano()),
+			Value:     10,
+		})
+	}
+
+	fake := source.NewFake()
+	fake.Matrices[source.Query{
+		Namespace: "default",
+		Workload:  "productpage-v1",
+		Direction: source.Downstream,
+		Signal:    source.RequestRate,
+	}] = promModel.Matrix{
+		&promModel.SampleStream{Metric: metric, Values: requestRates},
+	}
+
+	workload, err := GetWorkloadStatusByName(
+		context.Background(),
+		fake,
+		"default",
+		"productpage-v1",
+		start.Add(15*time.Minute),
+		end,
+		start,
+		5*time.Minute,
+		StatusOptions{Quantiles: []float64{0.95}},
+	)
+	assert.NoError(t, err)
+
+	assert.Len(t, workload.Destinations, 1)
+	details := workload.Destinations[0]
+	assert.Equal(t, "details-v1", details.Name)
+
+	statuses := make([]string, len(details.Traffic))
+	for i, status := range details.Traffic {
+		statuses[i] = status.Status
+	}
+	assert.Equal(t, []string{
+		"ok", "ok", "ok", "ok", "ok", "ok", "traffic-drop",
+	}, statuses)
+	assert.Equal(t, 0.0, *details.Traffic[6].Median)
+}
+
+func TestGetWorkloadStatusByNameThresholds(t *testing.T) {
+	start := time.Unix(0, 0)
+	end := start.Add(30 * time.Minute)
+	metric := promModel.Metric{
+		"source_workload_namespace":      "default",
+		"source_workload":                "productpage-v1",
+		"source_app":                     "productpage",
+		"destination_workload_namespace": "default",
+		"destination_workload":           "details-v1",
+		"destination_app":                "details",
+	}
+
+	// 10ms, 30ms in the last 5 minutes
+	latencies := []promModel.SamplePair{}
+	for t := start; !t.After(end); t = t.Add(time.Minute) {
+		value := promModel.SampleValue(0.01)
+		if t.After(end.Add(-5 * time.Minute)) {
+			value = 0.03
+		}
+		latencies = append(latencies, promModel.SamplePair{
+			Timestamp: promModel.TimeFromUnixNano(t.UnixNano()),
+			Value:     value,
+		})
+	}
+
+	fake := source.NewFake()
+	fake.Matrices[source.Query{
+		Namespace: "default",
+		Workload:  "productpage-v1",
+		Direction: source.Downstream,
+	}] = promModel.Matrix{
+		&promModel.SampleStream{Metric: metric, Values: latencies},
+	}
+	fake.Matrices[source.Query{
+		Namespace: "default",
+		Workload:  "productpage-v1",
+	}] = promModel.Matrix{
+		&promModel.SampleStream{Metric: promModel.Metric{}, Values: latencies},
+	}
+
+	getStatus := func(thresholds *Thresholds) *Workload {
+		workload, err := GetWorkloadStatusByName(
+			context.Background(),
+			fake,
+			"default",
+			"productpage-v1",
+			start.Add(15*time.Minute),
+			end,
+			start,
+			5*time.Minute,
+			StatusOptions{
+				Quantiles:         []float64{0.95},
+				LatencyThresholds: thresholds,
+			},
+		)
+		assert.NoError(t, err)
+		return workload
+	}
+
+	// Within the 500ms of the default threshold
+	workload := getStatus(nil)
+	details := workload.Destinations[0]
+	assert.Equal(t, "ok", details.Statuses[6].Status)
+	assert.Equal(t, &DefaultLatencyThreshold, details.Statuses[6].Threshold)
+	assert.Equal(t, "ok", workload.Statuses[6].Status)
+
+	relative := Threshold{Relative: 0.2, Absolute: 0.005}
+	workload = getStatus(&Thresholds{Default: &relative})
+	details = workload.Destinations[0]
+	assert.Equal(t, "high", details.Statuses[6].Status)
+	assert.Equal(t, &relative, details.Statuses[6].Threshold)
+	assert.Equal(t, "high", workload.Statuses[6].Status)
+
+	edge := Threshold{Absolute: 0.05}
+	workload = getStatus(&Thresholds{
+		Workloads: []WorkloadThreshold{
+			{Workload: "productpage-v1", Threshold: Threshold{Relative: 3}},
+		},
+		Edges: []EdgeThreshold{
+			{
+				Source:      "productpage-v1",
+				Destination: "details-v1",
+				Threshold:   edge,
+			},
+		},
+	})
+	details = workload.Destinations[0]
+	assert.Equal(t, "ok", details.Statuses[6].Status)
+	assert.Equal(t, &edge, details.Statuses[6].Threshold)
+	assert.Equal(t, "ok", workload.Statuses[6].Status)
+	assert.Equal(
+		t,
+		&Threshold{Relative: 3},
+		workload.Statuses[6].Threshold,
+	)
+}
+
+func TestGetWorkloadStatusByNameTCP(t *testing.T) {
+	start := time.Unix(0, 0)
+	end := start.Add(30 * time.Minute)
+	metric := promModel.Metric{
+		"request_protocol":               "tcp",
+		"source_workload_namespace":      "default",
+		"source_workload":                "ratings-v1",
+		"source_app":                     "ratings",
+		"destination_workload_namespace": "default",
+		"destination_workload":           "mongodb-v1",
+		"destination_app":                "mongodb",
+	}
+
+	// 1 connection per second, reconnecting in the last 5 minutes
+	connections := []promModel.SamplePair{}
+	throughput := []promModel.SamplePair{}
+	for t := start; !t.After(end); t = t.Add(time.Minute) {
+		value := promModel.SampleValue(1)
+		if t.After(end.Add(-5 * time.Minute)) {
+			value = 10
+		}
+		connections = append(connections, promModel.SamplePair{
+			Timestamp: promModel.TimeFromUnixNano(t.UnixNano()),
+			Value:     value,
+		})
+		throughput = append(throughput, promModel.SamplePair{
+			Timestamp: promModel.TimeFromUnixNano(t.UnixNano()),
+			Value:     64 * 1024,
+		})
+	}
+
+	fake := source.NewFake()
+	query := source.Query{
+		Namespace: "default",
+		Workload:  "ratings-v1",
+		Direction: source.Downstream,
+	}
+	query.Signal = source.ConnectionChurn
+	fake.Matrices[query] = promModel.Matrix{
+		&promModel.SampleStream{Metric: metric, Values: connections},
+	}
+	query.Signal = source.Throughput
+	fake.Matrices[query] = promModel.Matrix{
+		&promModel.SampleStream{Metric: metric, Values: throughput},
+	}
+
+	workload, err := GetWorkloadStatusByName(
+		context.Background(),
+		fake,
+		"default",
+		"ratings-v1",
+		start.Add(15*time.Minute),
+		end,
+		start,
+		5*time.Minute,
+		StatusOptions{Quantiles: []float64{0.95}},
+	)
+	assert.NoError(t, err)
+
+	// Connections and throughput are merged to the same TCP edge
+	assert.Len(t, workload.Destinations, 1)
+	mongodb := workload.Destinations[0]
+	assert.Equal(t, "mongodb-v1", mongodb.Name)
+	assert.Equal(t, "tcp", mongodb.Protocol)
+
+	statuses := make([]string, len(mongodb.Connections))
+	for i, status := range mongodb.Connections {
+		statuses[i] = status.Status
+	}
+	assert.Equal(t, []string{
+		"ok", "ok", "ok", "ok", "ok", "ok", "connections-spike",
+	}, statuses)
+
+	statuses = make([]string, len(mongodb.Throughput))
+	for i, status := range mongodb.Throughput {
+		statuses[i] = status.Status
+	}
+	assert.Equal(t, []string{
+		"ok", "ok", "ok", "ok", "ok", "ok", "ok",
+	}, statuses)
+}
+
+func TestGetWorkloadStatusByNameGRPC(t *testing.T) {
+	start := time.Unix(0, 0)
+	end := start.Add(30 * time.Minute)
+	metric := func(protocol string) promModel.Metric {
+		return promModel.Metric{
+			"request_protocol":               promModel.LabelValue(protocol),
+			"source_workload_namespace":      "default",
+			"source_workload":                "frontend-v1",
+			"source_app":                     "frontend",
+			"destination_workload_namespace": "default",
+			"destination_workload":           "checkout-v1",
+			"destination_app":                "checkout",
+		}
+	}
+
+	// No gRPC errors, all calls fail in the last 5 minutes
+	errorRates := []promModel.SamplePair{}
+	latencies := []promModel.SamplePair{}
+	for t := start; !t.After(end); t = t.Add(time.Minute) {
+		value := promModel.SampleValue(0)
+		if t.After(end.Add(-5 * time.Minute)) {
+			value = 1
+		}
+		errorRates = append(errorRates, promModel.SamplePair{
+			Timestamp: promModel.TimeFromUnixNano(t.UnixNano()),
+			Value:     value,
+		})
+		latencies = append(latencies, promModel.SamplePair{
+			Timestamp: promModel.TimeFromUnixNano(t.UnixNano()),
+			Value:     0.01,
+		})
+	}
+
+	fake := source.NewFake()
+	query := source.Query{
+		Namespace: "default",
+		Workload:  "frontend-v1",
+		Direction: source.Downstream,
+	}
+	// The same workloads are called over HTTP and gRPC
+	fake.Matrices[query] = promModel.Matrix{
+		&promModel.SampleStream{Metric: metric("http"), Values: latencies},
+		&promModel.SampleStream{Metric: metric("grpc"), Values: latencies},
+	}
+	query.Signal = source.GRPCErrorRate
+	fake.Matrices[query] = promModel.Matrix{
+		&promModel.SampleStream{Metric: metric("grpc"), Values: errorRates},
+	}
+
+	workload, err := GetWorkloadStatusByName(
+		context.Background(),
+		fake,
+		"default",
+		"frontend-v1",
+		start.Add(15*time.Minute),
+		end,
+		start,
+		5*time.Minute,
+		StatusOptions{Quantiles: []float64{0.95}},
+	)
+	assert.NoError(t, err)
+
+	// Edges are split by protocol
+	assert.Len(t, workload.Destinations, 2)
+	httpEdge := workload.Destinations[0]
+	assert.Equal(t, "http", httpEdge.Protocol)
+	assert.Empty(t, httpEdge.GRPCErrors)
+
+	grpcEdge := workload.Destinations[1]
+	assert.Equal(t, "grpc", grpcEdge.Protocol)
+	assert.Len(t, grpcEdge.Statuses, 7)
+
+	statuses := make([]string, len(grpcEdge.GRPCErrors))
+	for i, status := range grpcEdge.GRPCErrors {
+		statuses[i] = status.Status
+	}
+	assert.Equal(t, []string{
+		"ok", "ok", "ok", "ok", "ok", "ok", "grpc-errors",
+	}, statuses)
+}
+
+func TestGetWorkloadStatusByNameReporterGap(t *testing.T) {
+	start := time.Unix(0, 0)
+	end := start.Add(30 * time.Minute)
+	metric := promModel.Metric{
+		"request_protocol":               "http",
+		"source_workload_namespace":      "default",
+		"source_workload":                "productpage-v1",
+		"source_app":                     "productpage",
+		"destination_workload_namespace": "default",
+		"destination_workload":           "details-v1",
+		"destination_app":                "details",
+	}
+
+	// 2ms overhead, 50ms in the last 5 minutes
+	gaps := []promModel.SamplePair{}
+	for t := start; !t.After(end); t = t.Add(time.Minute) {
+		value := promModel.SampleValue(0.002)
+		if t.After(end.Add(-5 * time.Minute)) {
+			value = 0.05
+		}
+		gaps = append(gaps, promModel.SamplePair{
+			Timestamp: promModel.TimeFromUnixNano(t.UnixNano()),
+			Value:     value,
+		})
+	}
+
+	fake := source.NewFake()
+	fake.Matrices[source.Query{
+		Namespace: "default",
+		Workload:  "productpage-v1",
+		Direction: source.Downstream,
+		Signal:    source.ReporterGap,
+	}] = promModel.Matrix{
+		&promModel.SampleStream{Metric: metric, Values: gaps},
+	}
+
+	getStatus := func(options StatusOptions) *Workload {
+		workload, err := GetWorkloadStatusByName(
+			context.Background(),
+			fake,
+			"default",
+			"productpage-v1",
+			start.Add(15*time.Minute),
+			end,
+			start,
+			5*time.Minute,
+			options,
+		)
+		assert.NoError(t, err)
+		return workload
+	}
+
+	// Not requested
+	workload := getStatus(StatusOptions{Quantiles: []float64{0.95}})
+	assert.Empty(t, workload.Destinations)
+
+	workload = getStatus(StatusOptions{
+		Quantiles:   []float64{0.95},
+		ReporterGap: true,
+	})
+	assert.Len(t, workload.Destinations, 1)
+	details := workload.Destinations[0]
+
+	statuses := make([]string, len(details.ReporterGap))
+	for i, status := range details.ReporterGap {
+		statuses[i] = status.Status
+	}
+	assert.Equal(t, []string{
+		"ok", "ok", "ok", "ok", "ok", "ok", "high-gap",
+	}, statuses)
+}
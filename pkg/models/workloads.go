@@ -1,17 +1,34 @@
 package models
 
 import (
-	"github.com/hekike/outlier-istio/pkg/prometheus"
+	"context"
+	"math"
+
+	"github.com/hekike/outlier-istio/pkg/source"
 	promModel "github.com/prometheus/common/model"
 )
 
-// GetWorkloads returns workload with it's destination workloads
-func GetWorkloads(addr string) (map[string]Workload, error) {
+// GetWorkloads returns workload with it's destination workloads.
+// Only workloads of the given namespace are returned unless it's empty.
+// gRPC edges have the ratio of non-OK calls.
+func GetWorkloads(
+	ctx context.Context,
+	metricsSource source.MetricsSource,
+	namespace string,
+) (map[string]Workload, error) {
 	// Fetch data
-	matrix, err := prometheus.GetRequestsTotalByWorkloads(addr)
+	matrix, err := metricsSource.Topology(ctx, source.RequestRate)
+	if err != nil {
+		return nil, err
+	}
+	grpcErrorRates, err := metricsSource.Topology(ctx, source.GRPCErrorRate)
 	if err != nil {
 		return nil, err
 	}
+	grpcErrorRatesByEdge := make(map[string]*promModel.Sample)
+	for _, sample := range grpcErrorRates {
+		grpcErrorRatesByEdge[topologyEdgeID(sample.Metric)] = sample
+	}
 
 	workloads := make(map[string]Workload)
 
@@ -25,11 +42,14 @@ func GetWorkloads(addr string) (map[string]Workload, error) {
 		id, workload = getSourceWorkloadByMetric(metric, workloads)
 
 		// Add destination workload
-		name, app := getDestinationFromMetric(metric)
+		namespace, name, app := getDestinationFromMetric(metric)
 		destinationWorkload := Workload{
-			Name: name,
-			App:  app,
+			Namespace: namespace,
+			Name:      name,
+			App:       app,
 		}
+		setEdgeRate(&destinationWorkload, sample)
+		setEdgeGRPCErrorRate(&destinationWorkload, sample, grpcErrorRatesByEdge)
 		workload.AddDestination(destinationWorkload)
 
 		workloads[id] = workload
@@ -44,19 +64,75 @@ func GetWorkloads(addr string) (map[string]Workload, error) {
 		id, workload = getDestinationWorkloadByMetric(metric, workloads)
 
 		// Add source workload
-		name, app := getSourceFromMetric(metric)
+		namespace, name, app := getSourceFromMetric(metric)
 		sourceWorkload := Workload{
-			Name: name,
-			App:  app,
+			Namespace: namespace,
+			Name:      name,
+			App:       app,
 		}
+		setEdgeRate(&sourceWorkload, sample)
+		setEdgeGRPCErrorRate(&sourceWorkload, sample, grpcErrorRatesByEdge)
 		workload.AddSource(sourceWorkload)
 
 		workloads[id] = workload
 	}
 
+	// Filter by namespace
+	if namespace != "" {
+		for id, workload := range workloads {
+			if workload.Namespace != namespace {
+				delete(workloads, id)
+			}
+		}
+	}
+
 	return workloads, nil
 }
 
+// Sets the protocol and the requests or the opened TCP connections per
+// second of the edge
+func setEdgeRate(edge *Workload, sample *promModel.Sample) {
+	edge.Protocol = getProtocolFromMetric(sample.Metric)
+
+	rate := roundToDecimals(float64(sample.Value))
+	if math.IsNaN(rate) {
+		return
+	}
+	if edge.Protocol == protocolTCP {
+		edge.ConnectionRate = &rate
+	} else {
+		edge.RequestRate = &rate
+	}
+}
+
+// Sets the ratio of non-OK calls of gRPC edges
+func setEdgeGRPCErrorRate(
+	edge *Workload,
+	sample *promModel.Sample,
+	grpcErrorRatesByEdge map[string]*promModel.Sample,
+) {
+	if edge.Protocol != protocolGRPC {
+		return
+	}
+	grpcSample, found := grpcErrorRatesByEdge[topologyEdgeID(sample.Metric)]
+	if !found {
+		return
+	}
+	rate := roundToDecimals(float64(grpcSample.Value))
+	if !math.IsNaN(rate) {
+		edge.GRPCErrorRate = &rate
+	}
+}
+
+// Identifies the edge between the source and destination workloads
+func topologyEdgeID(metric promModel.Metric) string {
+	sourceNamespace, sourceName, sourceApp := getSourceFromMetric(metric)
+	namespace, name, app := getDestinationFromMetric(metric)
+	return sourceNamespace + "/" + sourceName + "-" + sourceApp + "->" +
+		namespace + "/" + name + "-" + app + "/" +
+		getProtocolFromMetric(metric)
+}
+
 func getSourceWorkloadByMetric(metric promModel.Metric, workloads map[string]Workload) (
 	id string,
 	workload Workload,
@@ -80,20 +156,21 @@ func getWorkloadByMetric(
 	workload Workload,
 ) {
 	// Extract data
-	var name, app string
+	var namespace, name, app string
 	if sourceType == "source" {
-		name, app = getSourceFromMetric(metric)
+		namespace, name, app = getSourceFromMetric(metric)
 	} else {
-		name, app = getDestinationFromMetric(metric)
+		namespace, name, app = getDestinationFromMetric(metric)
 	}
 
 	// Find or create workload
-	id = name + "-" + app
+	id = namespace + "/" + name + "-" + app
 
 	if v, found := workloads[id]; found {
 		workload = v
 	} else {
 		workload = Workload{
+			Namespace:    namespace,
 			Name:         name,
 			App:          app,
 			Sources:      make([]Workload, 0),
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hekike/outlier-istio/pkg/source"
+	promModel "github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetWorkloads(t *testing.T) {
+	fake := source.NewFake()
+	fake.Topologies[source.RequestRate] = promModel.Vector{
+		&promModel.Sample{
+			Metric: promModel.Metric{
+				"source_workload_namespace":      "default",
+				"source_workload":                "productpage-v1",
+				"source_app":                     "productpage",
+				"destination_workload_namespace": "default",
+				"destination_workload":           "reviews-v1",
+				"destination_app":                "reviews",
+			},
+			Value: 1.5,
+		},
+		// Same workload name in an other namespace
+		&promModel.Sample{
+			Metric: promModel.Metric{
+				"source_workload_namespace":      "staging",
+				"source_workload":                "productpage-v1",
+				"source_app":                     "productpage",
+				"destination_workload_namespace": "staging",
+				"destination_workload":           "reviews-v1",
+				"destination_app":                "reviews",
+			},
+		},
+	}
+
+	workloads, err := GetWorkloads(context.Background(), fake, "")
+	assert.NoError(t, err)
+	assert.Len(t, workloads, 4)
+
+	workloads, err = GetWorkloads(context.Background(), fake, "default")
+	assert.NoError(t, err)
+
+	requestRate := 1.5
+
+	assert.Equal(t, map[string]Workload{
+		"default/productpage-v1-productpage": Workload{
+			Namespace: "default",
+			Name:      "productpage-v1",
+			App:       "productpage",
+			Sources:   []Workload{},
+			Destinations: []Workload{
+				Workload{
+					Namespace:   "default",
+					Name:        "reviews-v1",
+					App:         "reviews",
+					RequestRate: &requestRate,
+				},
+			},
+		},
+		"default/reviews-v1-reviews": Workload{
+			Namespace: "default",
+			Name:      "reviews-v1",
+			App:       "reviews",
+			Sources: []Workload{
+				Workload{
+					Namespace:   "default",
+					Name:        "productpage-v1",
+					App:         "productpage",
+					RequestRate: &requestRate,
+				},
+			},
+			Destinations: []Workload{},
+		},
+	}, workloads)
+}
+
+func TestGetWorkloadsGRPC(t *testing.T) {
+	metric := promModel.Metric{
+		"request_protocol":               "grpc",
+		"source_workload_namespace":      "default",
+		"source_workload":                "frontend-v1",
+		"source_app":                     "frontend",
+		"destination_workload_namespace": "default",
+		"destination_workload":           "checkout-v1",
+		"destination_app":                "checkout",
+	}
+
+	fake := source.NewFake()
+	fake.Topologies[source.RequestRate] = promModel.Vector{
+		&promModel.Sample{Metric: metric, Value: 4},
+	}
+	fake.Topologies[source.GRPCErrorRate] = promModel.Vector{
+		&promModel.Sample{Metric: metric, Value: 0.25},
+	}
+
+	workloads, err := GetWorkloads(context.Background(), fake, "")
+	assert.NoError(t, err)
+
+	frontend := workloads["default/frontend-v1-frontend"]
+	assert.Len(t, frontend.Destinations, 1)
+	checkout := frontend.Destinations[0]
+	assert.Equal(t, "grpc", checkout.Protocol)
+	assert.Equal(t, 4.0, *checkout.RequestRate)
+	assert.Equal(t, 0.25, *checkout.GRPCErrorRate)
+
+	checkoutWorkload := workloads["default/checkout-v1-checkout"]
+	assert.Equal(t, 0.25, *checkoutWorkload.Sources[0].GRPCErrorRate)
+}
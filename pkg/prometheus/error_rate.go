@@ -0,0 +1,75 @@
+package prometheus
+
+import (
+	"time"
+
+	"github.com/hekike/outlier-istio/pkg/source"
+)
+
+// GetDownstreamErrorRatesQuery returns the error rate query of the workloads
+// called from the given workload.
+func GetDownstreamErrorRatesQuery(
+	p Profile,
+	q source.Query,
+	filters source.Filters,
+) string {
+	return errorRateQuery(p, "source", q, filters, p.edgeLabels())
+}
+
+// GetUpstreamErrorRatesQuery returns the error rate query of the requests
+// made to the given workload by its sources.
+func GetUpstreamErrorRatesQuery(
+	p Profile,
+	q source.Query,
+	filters source.Filters,
+) string {
+	return errorRateQuery(p, "destination", q, filters, p.edgeLabels())
+}
+
+// GetErrorRatesQuery returns the error rate query of the given workload.
+func GetErrorRatesQuery(
+	p Profile,
+	q source.Query,
+	filters source.Filters,
+) string {
+	return errorRateQuery(p, "destination", q, filters, p.statusLabels())
+}
+
+// Ratio of 5xx responses, zero when there are requests without errors
+func errorRateQuery(
+	p Profile,
+	sourceType string,
+	q source.Query,
+	filters source.Filters,
+	labels []string,
+) string {
+	matchers := requestMatchers(p, sourceType, q, filters)
+	return ratioExpr(
+		p,
+		p.RequestsTotal,
+		withMatchers(matchers, Regexp("response_code", "5..")),
+		matchers,
+		q.RateWindow,
+		labels,
+	).String()
+}
+
+// Rate of the matching series divided by the rate of all series, zero when
+// there are series without a match
+func ratioExpr(
+	p Profile,
+	metric string,
+	matching []Matcher,
+	all []Matcher,
+	window time.Duration,
+	labels []string,
+) Expr {
+	total := Sum(rateOf(p, metric, all, window)).GroupBy(labels...)
+	return Div(
+		Or(
+			Sum(rateOf(p, metric, matching, window)).GroupBy(labels...),
+			Mul(total, Number(0)),
+		),
+		total,
+	)
+}
@@ -0,0 +1,28 @@
+package prometheus
+
+import (
+	"github.com/hekike/outlier-istio/pkg/source"
+)
+
+// Compiles the filters to PromQL label matchers
+func filterMatchers(filters source.Filters) []Matcher {
+	matchers := make([]Matcher, 0, len(filters.Include)+len(filters.Exclude))
+	for _, matcher := range filters.Include {
+		matchers = append(matchers, labelMatcher(matcher, Equal, Regexp))
+	}
+	for _, matcher := range filters.Exclude {
+		matchers = append(matchers, labelMatcher(matcher, NotEqual, NotRegexp))
+	}
+	return matchers
+}
+
+func labelMatcher(
+	matcher source.LabelMatcher,
+	equality func(label string, value string) Matcher,
+	regex func(label string, regex string) Matcher,
+) Matcher {
+	if matcher.Regex != "" {
+		return regex(matcher.Label, matcher.Regex)
+	}
+	return equality(matcher.Label, matcher.Value)
+}
@@ -0,0 +1,44 @@
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/hekike/outlier-istio/pkg/source"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterMatchers(t *testing.T) {
+	matchers := filterMatchers(source.Filters{
+		Include: []source.LabelMatcher{
+			source.LabelMatcher{Label: "destination_workload_namespace", Value: "default"},
+			source.LabelMatcher{Label: "source_app", Regex: `istio-.*|productpage`},
+		},
+		Exclude: []source.LabelMatcher{
+			source.LabelMatcher{Label: "source_app", Value: "load-generator"},
+			source.LabelMatcher{Label: "source_workload", Regex: `health-\d+`},
+		},
+	})
+
+	rendered := make([]string, len(matchers))
+	for i, matcher := range matchers {
+		rendered[i] = matcher.String()
+	}
+
+	assert.Equal(t, []string{
+		`destination_workload_namespace = "default"`,
+		`source_app =~ "istio-.*|productpage"`,
+		`source_app != "load-generator"`,
+		`source_workload !~ "health-\\d+"`,
+	}, rendered)
+}
+
+func TestNewSourceInvalidFilters(t *testing.T) {
+	_, err := NewSource("http://localhost:9090", Options{
+		Filters: &source.Filters{
+			Exclude: []source.LabelMatcher{
+				source.LabelMatcher{Label: "source app", Value: "x"},
+			},
+		},
+	})
+	assert.EqualError(t, err, `invalid filter label: "source app"`)
+}
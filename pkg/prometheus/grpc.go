@@ -0,0 +1,89 @@
+package prometheus
+
+import (
+	"time"
+
+	"github.com/hekike/outlier-istio/pkg/source"
+)
+
+// GetDownstreamGRPCErrorRatesQuery returns the gRPC error rate query of the
+// workloads called from the given workload.
+func GetDownstreamGRPCErrorRatesQuery(
+	p Profile,
+	q source.Query,
+	filters source.Filters,
+) string {
+	return grpcErrorRateQuery(
+		p,
+		requestMatchers(p, "source", q, filters),
+		q.RateWindow,
+		p.edgeLabels(),
+	)
+}
+
+// GetUpstreamGRPCErrorRatesQuery returns the gRPC error rate query of the
+// calls made to the given workload by its sources.
+func GetUpstreamGRPCErrorRatesQuery(
+	p Profile,
+	q source.Query,
+	filters source.Filters,
+) string {
+	return grpcErrorRateQuery(
+		p,
+		requestMatchers(p, "destination", q, filters),
+		q.RateWindow,
+		p.edgeLabels(),
+	)
+}
+
+// GetGRPCErrorRatesQuery returns the gRPC error rate query of the given
+// workload.
+func GetGRPCErrorRatesQuery(
+	p Profile,
+	q source.Query,
+	filters source.Filters,
+) string {
+	return grpcErrorRateQuery(
+		p,
+		requestMatchers(p, "destination", q, filters),
+		q.RateWindow,
+		p.statusLabels(),
+	)
+}
+
+// GetGRPCErrorRatesByWorkloadsQuery returns the gRPC error rate query of
+// every edge
+func GetGRPCErrorRatesByWorkloadsQuery(
+	p Profile,
+	window time.Duration,
+	filters source.Filters,
+) string {
+	matchers := []Matcher{reporterMatcher(p)}
+	matchers = append(matchers, filterMatchers(filters)...)
+	return grpcErrorRateQuery(
+		p,
+		matchers,
+		window,
+		p.edgeLabels(),
+	)
+}
+
+// Ratio of gRPC calls with non-OK status, zero when there are calls without
+// errors. Istio reports HTTP 200 for failed gRPC calls, calls without a
+// grpc_response_status are not counted as failures.
+func grpcErrorRateQuery(
+	p Profile,
+	matchers []Matcher,
+	window time.Duration,
+	labels []string,
+) string {
+	grpcMatchers := withMatchers(matchers, Equal("request_protocol", "grpc"))
+	return ratioExpr(
+		p,
+		p.RequestsTotal,
+		withMatchers(grpcMatchers, NotRegexp("grpc_response_status", "0|")),
+		grpcMatchers,
+		window,
+		labels,
+	).String()
+}
@@ -0,0 +1,37 @@
+package prometheus
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hekike/outlier-istio/pkg/source"
+	"github.com/hekike/outlier-istio/test/fixtures"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGRPCErrorRatesQuery(t *testing.T) {
+	query := GetUpstreamGRPCErrorRatesQuery(IstioMixer,
+		source.Query{Namespace: "default", Workload: "ratings-v1"},
+		source.DefaultFilters,
+	)
+
+	assert.Contains(t, query, `grpc_response_status !~ "0|"`)
+	assert.Contains(t, query, `request_protocol = "grpc"`)
+	assert.Contains(t, query, `destination_workload = "ratings-v1"`)
+}
+
+func TestSourceTopologyGRPCErrorRate(t *testing.T) {
+	mockServer := fixtures.PrometheusResponseStub(t, map[string]string{
+		GetGRPCErrorRatesByWorkloadsQuery(IstioMixer, DefaultRateWindow, source.DefaultFilters): "../../test/mock/prom_empty_vector.json",
+	})
+	defer mockServer.Close()
+
+	s, err := NewSource(mockServer.URL, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := s.Topology(context.Background(), source.GRPCErrorRate)
+	assert.NoError(t, err)
+	assert.Empty(t, result)
+}
@@ -0,0 +1,129 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hekike/outlier-istio/pkg/source"
+	promModel "github.com/prometheus/common/model"
+)
+
+// Profile describes the metric schema of an Istio telemetry version.
+type Profile struct {
+	Name string
+	// Metric names
+	RequestsTotal         string
+	RequestDurationBucket string
+	TCPConnectionsOpened  string
+	TCPConnectionsClosed  string
+	TCPSentBytes          string
+	TCPReceivedBytes      string
+	// Request durations are divided by it to get seconds
+	DurationScale int
+	// Reporter of the analysed metrics
+	Reporter string
+	// Reporter of the client side metrics, compared to Reporter
+	SourceReporter string
+	// Labels of the edges and the workload statuses are grouped by
+	EdgeLabels   []string
+	StatusLabels []string
+	// Series hidden unless filters are configured
+	Filters source.Filters
+	// Rate window of the series recorded by RecordingRules, they are used
+	// instead of the raw metrics for queries over the same window. The raw
+	// metrics are queried when zero.
+	RecordedWindow time.Duration
+}
+
+var istioEdgeLabels = []string{
+	"request_protocol",
+	"source_workload_namespace",
+	"source_workload",
+	"source_app",
+	"destination_workload_namespace",
+	"destination_workload",
+	"destination_app",
+}
+
+var istioStatusLabels = []string{
+	"request_protocol",
+	"destination_workload_namespace",
+}
+
+// IstioMixer is the schema of the Mixer generated metrics (Istio 1.4 and
+// older). The control plane is reported as workloads too.
+var IstioMixer = Profile{
+	Name:                  "istio-mixer",
+	RequestsTotal:         "istio_requests_total",
+	RequestDurationBucket: "istio_request_duration_seconds_bucket",
+	TCPConnectionsOpened:  "istio_tcp_connections_opened_total",
+	TCPConnectionsClosed:  "istio_tcp_connections_closed_total",
+	TCPSentBytes:          "istio_tcp_sent_bytes_total",
+	TCPReceivedBytes:      "istio_tcp_received_bytes_total",
+	DurationScale:         1,
+	Reporter:              "destination",
+	SourceReporter:        "source",
+	EdgeLabels:            istioEdgeLabels,
+	StatusLabels:          istioStatusLabels,
+	Filters:               source.DefaultFilters,
+}
+
+// IstioTelemetryV2 is the schema of the metrics generated by the Envoy
+// proxies (Istio 1.5 and newer). Request durations are in milliseconds.
+var IstioTelemetryV2 = Profile{
+	Name:                  "istio-telemetry-v2",
+	RequestsTotal:         "istio_requests_total",
+	RequestDurationBucket: "istio_request_duration_milliseconds_bucket",
+	TCPConnectionsOpened:  "istio_tcp_connections_opened_total",
+	TCPConnectionsClosed:  "istio_tcp_connections_closed_total",
+	TCPSentBytes:          "istio_tcp_sent_bytes_total",
+	TCPReceivedBytes:      "istio_tcp_received_bytes_total",
+	DurationScale:         1000,
+	Reporter:              "destination",
+	SourceReporter:        "source",
+	EdgeLabels:            istioEdgeLabels,
+	StatusLabels:          istioStatusLabels,
+	Filters:               source.Filters{},
+}
+
+// Profiles by name
+var Profiles = map[string]Profile{
+	IstioMixer.Name:       IstioMixer,
+	IstioTelemetryV2.Name: IstioTelemetryV2,
+}
+
+// GetProfile returns the profile with the given name.
+func GetProfile(name string) (Profile, error) {
+	profile, found := Profiles[name]
+	if !found {
+		return Profile{}, fmt.Errorf("unknown metric schema profile: %s", name)
+	}
+	return profile, nil
+}
+
+// DetectProfile probes Prometheus for the series of the profiles.
+// The first profile with request duration series is returned,
+// IstioTelemetryV2 is probed first as Mixer era Prometheus setups can keep
+// their old series.
+func DetectProfile(ctx context.Context, s *Source) (Profile, error) {
+	for _, profile := range []Profile{IstioTelemetryV2, IstioMixer} {
+		query := Count(Select(profile.RequestDurationBucket)).String()
+		vector, err := s.executeQuery(ctx, query)
+		if err != nil {
+			return Profile{}, err
+		}
+		if len(vector) > 0 && vector[0].Value > promModel.SampleValue(0) {
+			return profile, nil
+		}
+	}
+	return Profile{}, fmt.Errorf("no Istio request duration series found")
+}
+
+func (p Profile) edgeLabels() []string {
+	return p.EdgeLabels
+}
+
+func (p Profile) statusLabels() []string {
+	return p.StatusLabels
+}
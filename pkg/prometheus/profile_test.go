@@ -0,0 +1,125 @@
+package prometheus
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hekike/outlier-istio/pkg/source"
+	"github.com/hekike/outlier-istio/test/fixtures"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update the golden queries")
+
+// Queries of every builder, compared to test/golden/<profile>/<name>.promql
+func goldenQueries(p Profile) map[string]string {
+	q := source.Query{
+		Namespace: "default",
+		Workload:  "productpage-v1",
+		Quantile:  0.99,
+	}
+	return map[string]string{
+		"requests_total":            GetRequestsTotalByWorkloadsQuery(p, DefaultRateWindow, p.Filters),
+		"downstream_durations":      GetDownstreamRequestDurationsQuery(p, q, p.Filters),
+		"upstream_durations":        GetUpstreamRequestDurationsQuery(p, q, p.Filters),
+		"statuses":                  GetStatusesQuery(p, q, p.Filters),
+		"downstream_error_rates":    GetDownstreamErrorRatesQuery(p, q, p.Filters),
+		"upstream_error_rates":      GetUpstreamErrorRatesQuery(p, q, p.Filters),
+		"error_rates":               GetErrorRatesQuery(p, q, p.Filters),
+		"downstream_request_rates":  GetDownstreamRequestRatesQuery(p, q, p.Filters),
+		"upstream_request_rates":    GetUpstreamRequestRatesQuery(p, q, p.Filters),
+		"request_rates":             GetRequestRatesQuery(p, q, p.Filters),
+		"downstream_connections":    GetDownstreamConnectionChurnQuery(p, q, p.Filters),
+		"upstream_connections":      GetUpstreamConnectionChurnQuery(p, q, p.Filters),
+		"connections":               GetConnectionChurnQuery(p, q, p.Filters),
+		"downstream_throughput":     GetDownstreamThroughputQuery(p, q, p.Filters),
+		"upstream_throughput":       GetUpstreamThroughputQuery(p, q, p.Filters),
+		"throughput":                GetThroughputQuery(p, q, p.Filters),
+		"grpc_error_rates_topology": GetGRPCErrorRatesByWorkloadsQuery(p, DefaultRateWindow, p.Filters),
+		"downstream_grpc_errors":    GetDownstreamGRPCErrorRatesQuery(p, q, p.Filters),
+		"upstream_grpc_errors":      GetUpstreamGRPCErrorRatesQuery(p, q, p.Filters),
+		"grpc_errors":               GetGRPCErrorRatesQuery(p, q, p.Filters),
+		"downstream_reporter_gap":   GetDownstreamReporterGapQuery(p, q, p.Filters),
+		"upstream_reporter_gap":     GetUpstreamReporterGapQuery(p, q, p.Filters),
+	}
+}
+
+func TestGoldenQueries(t *testing.T) {
+	for _, profile := range Profiles {
+		dir := filepath.Join("../../test/golden", profile.Name)
+		for name, query := range goldenQueries(profile) {
+			assertGolden(t, filepath.Join(dir, name+".promql"), query)
+		}
+
+		// Queries of the recorded series
+		profile.RecordedWindow = DefaultRateWindow
+		dir += "-recorded"
+		for name, query := range goldenQueries(profile) {
+			assertGolden(t, filepath.Join(dir, name+".promql"), query)
+		}
+	}
+}
+
+// Compares the content to the golden file, updates the file with -update
+func assertGolden(t *testing.T, file string, content string) {
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	golden, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, string(golden), content, file)
+}
+
+func TestGetProfile(t *testing.T) {
+	profile, err := GetProfile("istio-telemetry-v2")
+	assert.NoError(t, err)
+	assert.Equal(t, IstioTelemetryV2, profile)
+
+	_, err = GetProfile("istio-0.1")
+	assert.EqualError(t, err, "unknown metric schema profile: istio-0.1")
+}
+
+func TestDetectProfile(t *testing.T) {
+	mockServer := fixtures.PrometheusResponseStub(t, map[string]string{
+		"count(istio_request_duration_milliseconds_bucket)": "../../test/mock/prom_empty_vector.json",
+		"count(istio_request_duration_seconds_bucket)":      "../../test/mock/prom_count.json",
+	})
+	defer mockServer.Close()
+
+	s, err := NewSource(mockServer.URL, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err := DetectProfile(context.Background(), s)
+	assert.NoError(t, err)
+	assert.Equal(t, IstioMixer.Name, profile.Name)
+
+	// Telemetry v2
+	mockServer = fixtures.PrometheusResponseStub(t, map[string]string{
+		"count(istio_request_duration_milliseconds_bucket)": "../../test/mock/prom_count.json",
+	})
+	defer mockServer.Close()
+
+	s, err = NewSource(mockServer.URL, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err = DetectProfile(context.Background(), s)
+	assert.NoError(t, err)
+	assert.Equal(t, IstioTelemetryV2.Name, profile.Name)
+}
@@ -0,0 +1,87 @@
+package prometheus
+
+import (
+	"github.com/golang/protobuf/proto"
+)
+
+// Messages of the Prometheus remote read protocol (prompb/remote.proto and
+// prompb/types.proto), only the fields of sample responses are declared.
+
+type pbReadRequest struct {
+	Queries []*pbQuery `protobuf:"bytes,1,rep,name=queries,proto3"`
+}
+
+func (m *pbReadRequest) Reset()         { *m = pbReadRequest{} }
+func (m *pbReadRequest) String() string { return proto.CompactTextString(m) }
+func (*pbReadRequest) ProtoMessage()    {}
+
+type pbQuery struct {
+	StartTimestampMs int64             `protobuf:"varint,1,opt,name=start_timestamp_ms,proto3"`
+	EndTimestampMs   int64             `protobuf:"varint,2,opt,name=end_timestamp_ms,proto3"`
+	Matchers         []*pbLabelMatcher `protobuf:"bytes,3,rep,name=matchers,proto3"`
+}
+
+func (m *pbQuery) Reset()         { *m = pbQuery{} }
+func (m *pbQuery) String() string { return proto.CompactTextString(m) }
+func (*pbQuery) ProtoMessage()    {}
+
+// Label matcher types of the protocol
+const (
+	pbMatchEqual int32 = iota
+	pbMatchNotEqual
+	pbMatchRegexp
+	pbMatchNotRegexp
+)
+
+type pbLabelMatcher struct {
+	Type  int32  `protobuf:"varint,1,opt,name=type,proto3"`
+	Name  string `protobuf:"bytes,2,opt,name=name,proto3"`
+	Value string `protobuf:"bytes,3,opt,name=value,proto3"`
+}
+
+func (m *pbLabelMatcher) Reset()         { *m = pbLabelMatcher{} }
+func (m *pbLabelMatcher) String() string { return proto.CompactTextString(m) }
+func (*pbLabelMatcher) ProtoMessage()    {}
+
+type pbReadResponse struct {
+	Results []*pbQueryResult `protobuf:"bytes,1,rep,name=results,proto3"`
+}
+
+func (m *pbReadResponse) Reset()         { *m = pbReadResponse{} }
+func (m *pbReadResponse) String() string { return proto.CompactTextString(m) }
+func (*pbReadResponse) ProtoMessage()    {}
+
+type pbQueryResult struct {
+	Timeseries []*pbTimeSeries `protobuf:"bytes,1,rep,name=timeseries,proto3"`
+}
+
+func (m *pbQueryResult) Reset()         { *m = pbQueryResult{} }
+func (m *pbQueryResult) String() string { return proto.CompactTextString(m) }
+func (*pbQueryResult) ProtoMessage()    {}
+
+type pbTimeSeries struct {
+	Labels  []*pbLabel  `protobuf:"bytes,1,rep,name=labels,proto3"`
+	Samples []*pbSample `protobuf:"bytes,2,rep,name=samples,proto3"`
+}
+
+func (m *pbTimeSeries) Reset()         { *m = pbTimeSeries{} }
+func (m *pbTimeSeries) String() string { return proto.CompactTextString(m) }
+func (*pbTimeSeries) ProtoMessage()    {}
+
+type pbLabel struct {
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3"`
+	Value string `protobuf:"bytes,2,opt,name=value,proto3"`
+}
+
+func (m *pbLabel) Reset()         { *m = pbLabel{} }
+func (m *pbLabel) String() string { return proto.CompactTextString(m) }
+func (*pbLabel) ProtoMessage()    {}
+
+type pbSample struct {
+	Value     float64 `protobuf:"fixed64,1,opt,name=value,proto3"`
+	Timestamp int64   `protobuf:"varint,2,opt,name=timestamp,proto3"`
+}
+
+func (m *pbSample) Reset()         { *m = pbSample{} }
+func (m *pbSample) String() string { return proto.CompactTextString(m) }
+func (*pbSample) ProtoMessage()    {}
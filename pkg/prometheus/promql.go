@@ -0,0 +1,292 @@
+package prometheus
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Expr is a PromQL expression. Expressions are rendered one token group per
+// line, label values and string arguments are always escaped.
+type Expr interface {
+	fmt.Stringer
+	lines() []string
+}
+
+// MatchOp is the operator of a label matcher.
+type MatchOp string
+
+// Label matching operators
+const (
+	MatchEqual     MatchOp = "="
+	MatchNotEqual  MatchOp = "!="
+	MatchRegexp    MatchOp = "=~"
+	MatchNotRegexp MatchOp = "!~"
+)
+
+// Matcher is a label matcher of a selector.
+type Matcher struct {
+	Label string
+	Op    MatchOp
+	Value string
+}
+
+// Equal matches the label value.
+func Equal(label string, value string) Matcher {
+	return Matcher{Label: label, Op: MatchEqual, Value: value}
+}
+
+// NotEqual matches any other label value.
+func NotEqual(label string, value string) Matcher {
+	return Matcher{Label: label, Op: MatchNotEqual, Value: value}
+}
+
+// Regexp matches the label value against the regular expression.
+func Regexp(label string, regex string) Matcher {
+	return Matcher{Label: label, Op: MatchRegexp, Value: regex}
+}
+
+// NotRegexp matches label values not matching the regular expression.
+func NotRegexp(label string, regex string) Matcher {
+	return Matcher{Label: label, Op: MatchNotRegexp, Value: regex}
+}
+
+func (m Matcher) String() string {
+	return fmt.Sprintf("%s %s %s", m.Label, m.Op, strconv.Quote(m.Value))
+}
+
+// Selector selects series by metric name and label matchers, a range
+// vector selector when Range is set.
+type Selector struct {
+	// Series of any name when empty, the name can be matched on __name__
+	Metric   string
+	Matchers []Matcher
+	Range    time.Duration
+}
+
+// Select returns the instant vector selector of the metric.
+func Select(metric string, matchers ...Matcher) Selector {
+	return Selector{Metric: metric, Matchers: matchers}
+}
+
+// Over returns the range vector selector of the window.
+func (s Selector) Over(window time.Duration) Selector {
+	s.Range = window
+	return s
+}
+
+func (s Selector) String() string { return render(s) }
+
+func (s Selector) lines() []string {
+	var window string
+	if s.Range > 0 {
+		window = fmt.Sprintf("[%s]", formatRateWindow(s.Range))
+	}
+	if len(s.Matchers) == 0 {
+		return []string{s.Metric + window}
+	}
+
+	lines := []string{s.Metric + "{"}
+	for i, matcher := range s.Matchers {
+		line := "\t" + matcher.String()
+		if i < len(s.Matchers)-1 {
+			line += ","
+		}
+		lines = append(lines, line)
+	}
+	return append(lines, "}"+window)
+}
+
+// Call is a function call.
+type Call struct {
+	Func string
+	Args []Expr
+}
+
+// Rate returns the per second rate of the range vector.
+func Rate(e Expr) Call {
+	return Call{Func: "rate", Args: []Expr{e}}
+}
+
+// HistogramQuantile returns the quantile of the bucket rates.
+func HistogramQuantile(quantile float64, e Expr) Call {
+	return Call{Func: "histogram_quantile", Args: []Expr{Number(quantile), e}}
+}
+
+// LabelReplace sets the dst label to the replacement when the src label
+// matches the regex.
+func LabelReplace(
+	e Expr,
+	dst string,
+	replacement string,
+	src string,
+	regex string,
+) Call {
+	return Call{
+		Func: "label_replace",
+		Args: []Expr{
+			e,
+			String(dst),
+			String(replacement),
+			String(src),
+			String(regex),
+		},
+	}
+}
+
+func (c Call) String() string { return render(c) }
+
+// Consecutive single line arguments share a line, calls with only single
+// line arguments are rendered in one line
+func (c Call) lines() []string {
+	chunks := [][]string{}
+	inline := []string{}
+	for _, arg := range c.Args {
+		argLines := arg.lines()
+		if len(argLines) == 1 {
+			inline = append(inline, argLines[0])
+			continue
+		}
+		if len(inline) > 0 {
+			chunks = append(chunks, []string{strings.Join(inline, ", ")})
+			inline = []string{}
+		}
+		chunks = append(chunks, argLines)
+	}
+	if len(chunks) == 0 {
+		return []string{c.Func + "(" + strings.Join(inline, ", ") + ")"}
+	}
+	if len(inline) > 0 {
+		chunks = append(chunks, []string{strings.Join(inline, ", ")})
+	}
+
+	lines := []string{c.Func + "("}
+	for i, chunk := range chunks {
+		chunk = indent(chunk)
+		if i < len(chunks)-1 {
+			chunk[len(chunk)-1] += ","
+		}
+		lines = append(lines, chunk...)
+	}
+	return append(lines, ")")
+}
+
+// Aggregation aggregates the series, grouped by the labels when set.
+type Aggregation struct {
+	Op   string
+	Expr Expr
+	By   []string
+}
+
+// Sum returns the sum of the series.
+func Sum(e Expr) Aggregation {
+	return Aggregation{Op: "sum", Expr: e}
+}
+
+// Count returns the number of series.
+func Count(e Expr) Aggregation {
+	return Aggregation{Op: "count", Expr: e}
+}
+
+// GroupBy returns the aggregation grouped by the labels.
+func (a Aggregation) GroupBy(labels ...string) Aggregation {
+	a.By = labels
+	return a
+}
+
+func (a Aggregation) String() string { return render(a) }
+
+func (a Aggregation) lines() []string {
+	exprLines := a.Expr.lines()
+	if len(exprLines) == 1 && len(a.By) == 0 {
+		return []string{a.Op + "(" + exprLines[0] + ")"}
+	}
+
+	lines := []string{a.Op + "("}
+	lines = append(lines, indent(exprLines)...)
+	if len(a.By) == 0 {
+		return append(lines, ")")
+	}
+	return append(
+		lines,
+		") by (",
+		"\t"+strings.Join(a.By, ", "),
+		")",
+	)
+}
+
+// Binary is a binary operation, compound operands are parenthesized.
+type Binary struct {
+	Op  string
+	LHS Expr
+	RHS Expr
+}
+
+// Div divides the left hand side by the right hand side.
+func Div(lhs Expr, rhs Expr) Binary {
+	return Binary{Op: "/", LHS: lhs, RHS: rhs}
+}
+
+// Sub subtracts the right hand side from the left hand side.
+func Sub(lhs Expr, rhs Expr) Binary {
+	return Binary{Op: "-", LHS: lhs, RHS: rhs}
+}
+
+// Mul multiplies the operands.
+func Mul(lhs Expr, rhs Expr) Binary {
+	return Binary{Op: "*", LHS: lhs, RHS: rhs}
+}
+
+// Or returns the left hand side series and the right hand side series
+// without a match on the left.
+func Or(lhs Expr, rhs Expr) Binary {
+	return Binary{Op: "or", LHS: lhs, RHS: rhs}
+}
+
+func (b Binary) String() string { return render(b) }
+
+func (b Binary) lines() []string {
+	lines := operandLines(b.LHS)
+	lines = append(lines, b.Op)
+	return append(lines, operandLines(b.RHS)...)
+}
+
+func operandLines(e Expr) []string {
+	if _, ok := e.(Binary); !ok {
+		return e.lines()
+	}
+	lines := []string{"("}
+	lines = append(lines, indent(e.lines())...)
+	return append(lines, ")")
+}
+
+// Number is a float literal.
+type Number float64
+
+func (n Number) String() string { return render(n) }
+
+func (n Number) lines() []string {
+	return []string{strconv.FormatFloat(float64(n), 'f', -1, 64)}
+}
+
+// String is an escaped string literal.
+type String string
+
+func (s String) String() string { return render(s) }
+
+func (s String) lines() []string {
+	return []string{strconv.Quote(string(s))}
+}
+
+func indent(lines []string) []string {
+	indented := make([]string, len(lines))
+	for i, line := range lines {
+		indented[i] = "\t" + line
+	}
+	return indented
+}
+
+func render(e Expr) string {
+	return strings.Join(e.lines(), "\n")
+}
@@ -0,0 +1,77 @@
+package prometheus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hekike/outlier-istio/pkg/source"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatcherEscaping(t *testing.T) {
+	assert.Equal(
+		t,
+		`destination_workload = "reviews-v3\", source_workload=~\".*"`,
+		Equal("destination_workload", `reviews-v3", source_workload=~".*`).String(),
+	)
+	assert.Equal(
+		t,
+		`source_workload !~ "health-\\d+"`,
+		NotRegexp("source_workload", `health-\d+`).String(),
+	)
+}
+
+func TestExprRendering(t *testing.T) {
+	assert.Equal(
+		t,
+		"count(istio_requests_total)",
+		Count(Select("istio_requests_total")).String(),
+	)
+
+	total := Sum(Rate(
+		Select("istio_requests_total", Equal("reporter", "destination")).
+			Over(time.Minute),
+	)).GroupBy("destination_workload")
+	assert.Equal(t, `sum(
+	rate(
+		istio_requests_total{
+			reporter = "destination"
+		}[60s]
+	)
+) by (
+	destination_workload
+)`, total.String())
+
+	// Compound operands are parenthesized
+	assert.Equal(t, `(
+	a
+	or
+	b
+)
+/
+c`, Div(Or(Select("a"), Select("b")), Select("c")).String())
+
+	assert.Equal(t, `label_replace(
+	a{
+		b = "c"
+	},
+	"request_protocol", "tcp", "", ""
+)`, LabelReplace(
+		Select("a", Equal("b", "c")),
+		"request_protocol", "tcp", "", "",
+	).String())
+}
+
+func TestQueryEscapesWorkload(t *testing.T) {
+	query := GetUpstreamRequestRatesQuery(IstioMixer, source.Query{
+		Namespace: `default"}`,
+		Workload:  `reviews-v3"} or vector(1) #`,
+	}, source.Filters{})
+
+	assert.Contains(
+		t,
+		query,
+		`destination_workload = "reviews-v3\"} or vector(1) #"`,
+	)
+	assert.Contains(t, query, `destination_workload_namespace = "default\"}"`)
+}
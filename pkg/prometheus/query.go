@@ -2,52 +2,136 @@ package prometheus
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"time"
 
-	promApi "github.com/prometheus/client_golang/api"
+	"github.com/hekike/outlier-istio/pkg/source"
 	promApiV1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	promModel "github.com/prometheus/common/model"
 )
 
-func executeQuery(addr string, pq string) (promModel.Vector, error) {
-	client, err := promApi.NewClient(promApi.Config{Address: addr})
-	if err != nil {
-		return nil, err
-	}
-	api := promApiV1.NewAPI(client)
+func (s *Source) executeQuery(
+	ctx context.Context,
+	pq string,
+) (promModel.Vector, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
 
-	val, _, err := api.Query(context.Background(), pq, time.Now())
+	val, warnings, err := s.api.Query(ctx, pq, time.Now())
 	if err != nil {
-		return nil, err
+		return nil, s.queryError(ctx, pq, err)
+	}
+	source.AddWarnings(ctx, warnings...)
+	vector, ok := val.(promModel.Vector)
+	if !ok {
+		return nil, resultTypeError(pq, promModel.ValVector, val)
 	}
-	matrix := val.(promModel.Vector)
 
-	return matrix, nil
+	return vector, nil
 }
 
-func executeQueryRange(
-	addr string,
+func (s *Source) executeQueryRange(
+	ctx context.Context,
 	start time.Time,
 	end time.Time,
 	pq string,
 ) (promModel.Matrix, error) {
-	client, err := promApi.NewClient(promApi.Config{Address: addr})
-	if err != nil {
-		return nil, err
-	}
-	api := promApiV1.NewAPI(client)
+	step := queryStep(start, end, s.maxPoints)
+	ranges := splitRange(start, end, step, s.maxPointsPerQuery)
 
-	// Query range
-	queryRange := promApiV1.Range{
-		Start: start,
-		End:   end,
-		Step:  resolutionStep,
+	// Long ranges are queried in chunks, Prometheus rejects queries with
+	// too many points per series
+	matrices := make([]promModel.Matrix, 0, len(ranges))
+	for _, queryRange := range ranges {
+		matrix, err := s.executeQueryRangeChunk(ctx, queryRange, pq)
+		if err != nil {
+			return nil, err
+		}
+		matrices = append(matrices, matrix)
 	}
-	val, _, err := api.QueryRange(context.Background(), pq, queryRange)
+
+	return mergeMatrices(matrices), nil
+}
+
+func (s *Source) executeQueryRangeChunk(
+	ctx context.Context,
+	queryRange promApiV1.Range,
+	pq string,
+) (promModel.Matrix, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	val, warnings, err := s.api.QueryRange(ctx, pq, queryRange)
 	if err != nil {
-		return nil, err
+		return nil, s.queryError(ctx, pq, err)
+	}
+	source.AddWarnings(ctx, warnings...)
+	matrix, ok := val.(promModel.Matrix)
+	if !ok {
+		return nil, resultTypeError(pq, promModel.ValMatrix, val)
 	}
-	matrix := val.(promModel.Matrix)
 
 	return matrix, nil
 }
+
+// Converts the error of the client to the typed errors of the source,
+// cancellation of the caller is returned as it is
+func (s *Source) queryError(ctx context.Context, pq string, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &source.TimeoutError{
+			Query:   pq,
+			Timeout: s.timeout,
+			Err:     err,
+		}
+	}
+
+	var apiErr *promApiV1.Error
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	errorType, message := apiErr.Type, apiErr.Msg
+	// The client only reads the body of 400 and 422 responses, Prometheus
+	// responds with 503 to timeouts
+	body := prometheusErrorBody{}
+	if apiErr.Detail != "" &&
+		json.Unmarshal([]byte(apiErr.Detail), &body) == nil &&
+		body.ErrorType != "" {
+		errorType, message = body.ErrorType, body.Error
+	}
+	// Prometheus aborts queries exceeding its own query timeout
+	if errorType == promApiV1.ErrTimeout {
+		return &source.TimeoutError{
+			Query:   pq,
+			Timeout: s.timeout,
+			Err:     err,
+		}
+	}
+	return &source.QueryError{
+		Query:   pq,
+		Type:    string(errorType),
+		Message: message,
+		Err:     err,
+	}
+}
+
+type prometheusErrorBody struct {
+	ErrorType promApiV1.ErrorType `json:"errorType"`
+	Error     string              `json:"error"`
+}
+
+func resultTypeError(
+	pq string,
+	expected promModel.ValueType,
+	val promModel.Value,
+) error {
+	actual := "none"
+	if val != nil {
+		actual = val.Type().String()
+	}
+	return &source.ResultTypeError{
+		Query:    pq,
+		Expected: expected.String(),
+		Actual:   actual,
+	}
+}
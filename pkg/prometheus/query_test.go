@@ -0,0 +1,104 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hekike/outlier-istio/pkg/source"
+	"github.com/hekike/outlier-istio/test/fixtures"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSourceWarnings(t *testing.T) {
+	mockServer := fixtures.PrometheusResponseStub(t, map[string]string{
+		GetRequestsTotalByWorkloadsQuery(IstioMixer, DefaultRateWindow, source.DefaultFilters): "../../test/mock/prom_partial_vector.json",
+	})
+	defer mockServer.Close()
+
+	s, err := NewSource(mockServer.URL, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, warnings := source.WithWarnings(context.Background())
+	_, err = s.Topology(ctx, source.RequestRate)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		[]string{"partial response: store prometheus-1 unavailable"},
+		warnings.List(),
+	)
+}
+
+func TestSourceResultTypeError(t *testing.T) {
+	// Matrix response to the instant query
+	mockServer := fixtures.PrometheusResponseStub(t, map[string]string{
+		GetRequestsTotalByWorkloadsQuery(IstioMixer, DefaultRateWindow, source.DefaultFilters): "../../test/mock/prom_empty_matrix.json",
+	})
+	defer mockServer.Close()
+
+	s, err := NewSource(mockServer.URL, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Topology(context.Background(), source.RequestRate)
+	var resultTypeErr *source.ResultTypeError
+	assert.True(t, errors.As(err, &resultTypeErr), err)
+	assert.Equal(t, "vector", resultTypeErr.Expected)
+	assert.Equal(t, "matrix", resultTypeErr.Actual)
+}
+
+// Prometheus rejecting every query with the given status and error type
+func errorServer(status int, errorType string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(
+		w http.ResponseWriter,
+		r *http.Request,
+	) {
+		w.WriteHeader(status)
+		w.Write([]byte(`{
+			"status": "error",
+			"errorType": "` + errorType + `",
+			"error": "query failed"
+		}`))
+	}))
+}
+
+func TestSourceQueryError(t *testing.T) {
+	server := errorServer(http.StatusBadRequest, "bad_data")
+	defer server.Close()
+
+	s, err := NewSource(server.URL, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	end := time.Date(2018, 10, 27, 15, 0, 0, 0, time.UTC)
+	_, err = s.Statuses(context.Background(), source.Query{
+		Workload: "productpage-v1",
+		Start:    end.Add(-time.Hour),
+		End:      end,
+	})
+	var queryErr *source.QueryError
+	assert.True(t, errors.As(err, &queryErr), err)
+	assert.Equal(t, "bad_data", queryErr.Type)
+	assert.Equal(t, "query failed", queryErr.Message)
+}
+
+func TestSourcePrometheusTimeout(t *testing.T) {
+	server := errorServer(http.StatusServiceUnavailable, "timeout")
+	defer server.Close()
+
+	s, err := NewSource(server.URL, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Topology(context.Background(), source.RequestRate)
+	var timeoutErr *source.TimeoutError
+	assert.True(t, errors.As(err, &timeoutErr), err)
+}
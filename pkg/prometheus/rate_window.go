@@ -0,0 +1,87 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hekike/outlier-istio/pkg/source"
+	promModel "github.com/prometheus/common/model"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// DefaultRateWindow is the rate() window when the scrape interval is unknown
+const DefaultRateWindow = 60 * time.Second
+
+// Default scrape interval of Prometheus when the config omits it
+const defaultScrapeInterval = time.Minute
+
+// RateWindow returns the rate() window of the range queries between start
+// and end. It is at least the step of the range, so every sample is
+// counted.
+func (s *Source) RateWindow(start time.Time, end time.Time) time.Duration {
+	window := s.rateWindow
+	if step := queryStep(start, end, s.maxPoints); step > window {
+		window = step
+	}
+	return window
+}
+
+// Returns the base rate window of the options: the configured window or the
+// window of MinSamplesPerWindow scrapes, whichever is longer. Windows under
+// a second can't be queried.
+func baseRateWindow(options Options) (time.Duration, error) {
+	minWindow := time.Duration(options.MinSamplesPerWindow) *
+		options.ScrapeInterval
+	if options.RateWindow == 0 && minWindow == 0 {
+		return DefaultRateWindow, nil
+	}
+	window := minWindow
+	if options.RateWindow > minWindow {
+		window = options.RateWindow
+	}
+	if window < time.Second {
+		return 0, fmt.Errorf("rate window must be at least 1s, got: %s", window)
+	}
+	return window, nil
+}
+
+// Formats the rate window of the query, DefaultRateWindow when it's zero
+func formatRateWindow(window time.Duration) string {
+	if window == 0 {
+		window = DefaultRateWindow
+	}
+	return source.FormatRateWindow(window)
+}
+
+type prometheusConfig struct {
+	Global struct {
+		ScrapeInterval string `yaml:"scrape_interval"`
+	} `yaml:"global"`
+}
+
+// DetectScrapeInterval reads the global scrape interval from the
+// configuration of Prometheus. Jobs overriding it are not taken into
+// account.
+func DetectScrapeInterval(ctx context.Context, s *Source) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	result, err := s.api.Config(ctx)
+	if err != nil {
+		return 0, s.queryError(ctx, "", err)
+	}
+
+	config := prometheusConfig{}
+	if err := yaml.Unmarshal([]byte(result.YAML), &config); err != nil {
+		return 0, fmt.Errorf("invalid Prometheus config: %s", err)
+	}
+	if config.Global.ScrapeInterval == "" {
+		return defaultScrapeInterval, nil
+	}
+	interval, err := promModel.ParseDuration(config.Global.ScrapeInterval)
+	if err != nil {
+		return 0, fmt.Errorf("invalid Prometheus scrape interval: %s", err)
+	}
+	return time.Duration(interval), nil
+}
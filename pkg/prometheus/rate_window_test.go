@@ -0,0 +1,118 @@
+package prometheus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hekike/outlier-istio/pkg/source"
+	"github.com/hekike/outlier-istio/test/fixtures"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBaseRateWindow(t *testing.T) {
+	baseRateWindowOf := func(options Options) time.Duration {
+		window, err := baseRateWindow(options)
+		assert.NoError(t, err)
+		return window
+	}
+	assert.Equal(t, DefaultRateWindow, baseRateWindowOf(Options{
+		MinSamplesPerWindow: 4,
+	}))
+	// Four scrapes
+	assert.Equal(t, 2*time.Minute, baseRateWindowOf(Options{
+		ScrapeInterval:      30 * time.Second,
+		MinSamplesPerWindow: 4,
+	}))
+	assert.Equal(t, 20*time.Second, baseRateWindowOf(Options{
+		ScrapeInterval:      5 * time.Second,
+		MinSamplesPerWindow: 4,
+	}))
+	// Configured window raised to the minimum samples
+	assert.Equal(t, 30*time.Second, baseRateWindowOf(Options{
+		RateWindow: 30 * time.Second,
+	}))
+	assert.Equal(t, 2*time.Minute, baseRateWindowOf(Options{
+		RateWindow:          30 * time.Second,
+		ScrapeInterval:      30 * time.Second,
+		MinSamplesPerWindow: 4,
+	}))
+	// Fractional windows over a second are kept
+	assert.Equal(t, 1500*time.Millisecond, baseRateWindowOf(Options{
+		ScrapeInterval:      500 * time.Millisecond,
+		MinSamplesPerWindow: 3,
+	}))
+
+	// Windows under a second can't be queried
+	_, err := baseRateWindow(Options{
+		ScrapeInterval:      200 * time.Millisecond,
+		MinSamplesPerWindow: 2,
+	})
+	assert.EqualError(t, err, "rate window must be at least 1s, got: 400ms")
+	_, err = NewSource("http://localhost:9090", Options{
+		RateWindow: 500 * time.Millisecond,
+	})
+	assert.Error(t, err)
+}
+
+func TestSourceRateWindow(t *testing.T) {
+	s, err := NewSource("http://localhost:9090", Options{
+		ScrapeInterval: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	end := time.Date(2018, 10, 27, 15, 0, 0, 0, time.UTC)
+	assert.Equal(t, 20*time.Second, s.RateWindow(end.Add(-time.Hour), end))
+	// Not shorter than the step
+	assert.Equal(
+		t,
+		35*time.Second,
+		s.RateWindow(end.Add(-48*time.Hour), end),
+	)
+}
+
+func TestSourceRateWindowQuery(t *testing.T) {
+	end := time.Date(2018, 10, 27, 15, 0, 0, 0, time.UTC)
+	query := source.Query{
+		Workload: "productpage-v1",
+		Start:    end.Add(-time.Hour),
+		End:      end,
+	}
+	windowQuery := query
+	windowQuery.RateWindow = 2 * time.Minute
+
+	mockServer := fixtures.PrometheusResponseStub(t, map[string]string{
+		GetStatusesQuery(IstioMixer, windowQuery, source.DefaultFilters): "../../test/mock/prom_workload_destination_request_durations.json",
+	})
+	defer mockServer.Close()
+
+	s, err := NewSource(mockServer.URL, Options{
+		ScrapeInterval: 30 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := s.Statuses(context.Background(), query)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, result)
+}
+
+func TestDetectScrapeInterval(t *testing.T) {
+	// Config endpoint has no query parameter
+	mockServer := fixtures.PrometheusResponseStub(t, map[string]string{
+		"": "../../test/mock/prom_config.json",
+	})
+	defer mockServer.Close()
+
+	s, err := NewSource(mockServer.URL, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	interval, err := DetectScrapeInterval(context.Background(), s)
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, interval)
+}
@@ -0,0 +1,138 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	promModel "github.com/prometheus/common/model"
+)
+
+// RuleGroups is a Prometheus recording rules file.
+type RuleGroups struct {
+	Groups []RuleGroup `yaml:"groups"`
+}
+
+// RuleGroup is a group of recording rules evaluated together.
+type RuleGroup struct {
+	Name  string `yaml:"name"`
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule records the result of the expression as a new series.
+type Rule struct {
+	Record string `yaml:"record"`
+	Expr   string `yaml:"expr"`
+}
+
+// Labels the request rates are recorded by in addition to the edge labels
+var requestRecordedLabels = []string{
+	"reporter",
+	"response_code",
+	"grpc_response_status",
+}
+
+// RecordingRules returns the recording rules of the rates the queries of
+// the profile are built from. The rates are recorded by the edge labels, so
+// they can be aggregated further by the queries.
+func RecordingRules(p Profile, window time.Duration) RuleGroups {
+	metrics := []string{
+		p.RequestDurationBucket,
+		p.RequestsTotal,
+		p.TCPConnectionsOpened,
+		p.TCPConnectionsClosed,
+		p.TCPSentBytes,
+		p.TCPReceivedBytes,
+	}
+
+	rules := make([]Rule, 0, len(metrics))
+	for _, metric := range metrics {
+		rules = append(rules, Rule{
+			Record: recordedMetric(metric, window),
+			Expr: inline(
+				Sum(Rate(Select(metric).Over(window))).
+					GroupBy(p.recordedLabels(metric)...),
+			),
+		})
+	}
+
+	return RuleGroups{
+		Groups: []RuleGroup{
+			{
+				Name:  fmt.Sprintf("outlier-istio-%s", formatRateWindow(window)),
+				Rules: rules,
+			},
+		},
+	}
+}
+
+// Renders the selector free expression in one line, keeping the rules file
+// readable
+func inline(e Expr) string {
+	lines := e.lines()
+	for i, line := range lines {
+		lines[i] = strings.TrimLeft(line, "\t")
+	}
+	return strings.Join(lines, "")
+}
+
+// Name of the recorded rate of the metric
+func recordedMetric(metric string, window time.Duration) string {
+	return fmt.Sprintf("outlier_istio:%s:rate%s", metric, formatRateWindow(window))
+}
+
+// Labels the rate of the metric is recorded by
+func (p Profile) recordedLabels(metric string) []string {
+	labels := []string{}
+	switch metric {
+	case p.RequestDurationBucket:
+		labels = append(labels, "le", "reporter")
+	case p.RequestsTotal:
+		labels = append(labels, requestRecordedLabels...)
+	default:
+		labels = append(labels, "reporter")
+	}
+	return append(labels, p.EdgeLabels...)
+}
+
+// Recorded series are used when they are recorded over the window and
+// every matched label is recorded
+func (p Profile) useRecorded(
+	metric string,
+	matchers []Matcher,
+	window time.Duration,
+) bool {
+	if p.RecordedWindow == 0 || p.RecordedWindow != window {
+		return false
+	}
+
+	recorded := make(map[string]bool)
+	for _, label := range p.recordedLabels(metric) {
+		recorded[label] = true
+	}
+	for _, matcher := range matchers {
+		if matcher.Label != "__name__" && !recorded[matcher.Label] {
+			return false
+		}
+	}
+	return true
+}
+
+// DetectRecordingRules probes Prometheus for the recorded series of the
+// source's profile and rate window. The profile using the recorded series is
+// returned when they exist.
+func DetectRecordingRules(ctx context.Context, s *Source) (Profile, error) {
+	metric := recordedMetric(s.profile.RequestDurationBucket, s.rateWindow)
+	vector, err := s.executeQuery(ctx, Count(Select(metric)).String())
+	if err != nil {
+		return Profile{}, err
+	}
+	if len(vector) == 0 || vector[0].Value <= promModel.SampleValue(0) {
+		return Profile{}, fmt.Errorf("no recorded series found: %s", metric)
+	}
+
+	profile := s.profile
+	profile.RecordedWindow = s.rateWindow
+	return profile, nil
+}
@@ -0,0 +1,99 @@
+package prometheus
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hekike/outlier-istio/test/fixtures"
+	"github.com/stretchr/testify/assert"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestGoldenRecordingRules(t *testing.T) {
+	for _, profile := range Profiles {
+		rules, err := yaml.Marshal(RecordingRules(profile, DefaultRateWindow))
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := filepath.Join(
+			"../../test/golden",
+			profile.Name,
+			"recording_rules.yaml",
+		)
+		assertGolden(t, file, string(rules))
+	}
+}
+
+func TestRecordedMetric(t *testing.T) {
+	assert.Equal(
+		t,
+		"outlier_istio:istio_requests_total:rate120s",
+		recordedMetric("istio_requests_total", 2*time.Minute),
+	)
+}
+
+func TestUseRecorded(t *testing.T) {
+	p := IstioMixer
+	matchers := []Matcher{
+		Equal("reporter", "destination"),
+		Equal("destination_workload", "reviews-v3"),
+	}
+
+	// Not recorded
+	assert.False(t, p.useRecorded(p.RequestsTotal, matchers, DefaultRateWindow))
+
+	p.RecordedWindow = DefaultRateWindow
+	assert.True(t, p.useRecorded(p.RequestsTotal, matchers, DefaultRateWindow))
+	// Recorded over another window
+	assert.False(t, p.useRecorded(p.RequestsTotal, matchers, 2*time.Minute))
+	// Label dropped by the recording rule
+	assert.False(t, p.useRecorded(
+		p.TCPSentBytes,
+		append(matchers, Equal("response_code", "200")),
+		DefaultRateWindow,
+	))
+	assert.True(t, p.useRecorded(
+		p.RequestsTotal,
+		append(matchers, Equal("response_code", "200")),
+		DefaultRateWindow,
+	))
+}
+
+func TestDetectRecordingRules(t *testing.T) {
+	metric := recordedMetric(IstioMixer.RequestDurationBucket, DefaultRateWindow)
+	mockServer := fixtures.PrometheusResponseStub(t, map[string]string{
+		Count(Select(metric)).String(): "../../test/mock/prom_count.json",
+	})
+	defer mockServer.Close()
+
+	s, err := NewSource(mockServer.URL, Options{Profile: &IstioMixer})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err := DetectRecordingRules(context.Background(), s)
+	assert.NoError(t, err)
+	assert.Equal(t, IstioMixer.Name, profile.Name)
+	assert.Equal(t, DefaultRateWindow, profile.RecordedWindow)
+
+	// Not recorded
+	mockServer = fixtures.PrometheusResponseStub(t, map[string]string{
+		Count(Select(metric)).String(): "../../test/mock/prom_empty_vector.json",
+	})
+	defer mockServer.Close()
+
+	s, err = NewSource(mockServer.URL, Options{Profile: &IstioMixer})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = DetectRecordingRules(context.Background(), s)
+	assert.EqualError(
+		t,
+		err,
+		"no recorded series found: "+
+			"outlier_istio:istio_request_duration_seconds_bucket:rate60s",
+	)
+}
@@ -0,0 +1,498 @@
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/hekike/outlier-istio/pkg/source"
+	promModel "github.com/prometheus/common/model"
+)
+
+// RemoteReadSource is a MetricsSource backed by the Prometheus remote read
+// API of a long term storage. It fetches the raw Istio series and evaluates
+// the rates and quantiles in Go, so queries transfer every sample of the
+// range. Recorded series are not used.
+// It is safe to use from multiple goroutines.
+type RemoteReadSource struct {
+	client  *http.Client
+	url     string
+	timeout time.Duration
+	profile Profile
+	filters source.Filters
+	// Rate window of the topology and of the short ranges
+	rateWindow time.Duration
+	maxPoints  int
+}
+
+// NewRemoteReadSource creates a source for the remote read endpoint at the
+// given URL, like http://prometheus:9090/api/v1/read.
+func NewRemoteReadSource(url string, options Options) (*RemoteReadSource, error) {
+	options, profile, filters, err := withDefaults(options)
+	if err != nil {
+		return nil, err
+	}
+	roundTripper, err := newRoundTripper(options)
+	if err != nil {
+		return nil, err
+	}
+	rateWindow, err := baseRateWindow(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RemoteReadSource{
+		client:     &http.Client{Transport: roundTripper},
+		url:        url,
+		timeout:    options.Timeout,
+		profile:    profile,
+		filters:    filters,
+		rateWindow: rateWindow,
+		maxPoints:  options.MaxPoints,
+	}, nil
+}
+
+// Topology returns the signal by source and destination workloads at the
+// current time.
+func (s *RemoteReadSource) Topology(
+	ctx context.Context,
+	signal source.Signal,
+) (promModel.Vector, error) {
+	now := time.Now().Truncate(time.Millisecond)
+	r := evalRange{Start: now, End: now, Step: time.Second, Window: s.rateWindow}
+	matchers := []Matcher{reporterMatcher(s.profile)}
+	matchers = append(matchers, filterMatchers(s.filters)...)
+	labels := s.profile.edgeLabels()
+
+	var matrix promModel.Matrix
+	var err error
+	switch signal {
+	case source.GRPCErrorRate:
+		matrix, err = s.grpcErrorRates(ctx, matchers, labels, r)
+	default:
+		var requests, connections promModel.Matrix
+		requests, err = s.requestRates(ctx, matchers, labels, r)
+		if err != nil {
+			return nil, err
+		}
+		connections, err = s.tcpRates(
+			ctx,
+			[]string{s.profile.TCPConnectionsOpened},
+			matchers,
+			labels,
+			r,
+		)
+		matrix = orMatrix(requests, connections)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return vectorAt(matrix, promModel.TimeFromUnixNano(now.UnixNano())), nil
+}
+
+// Edges returns the signal of downstream or upstream workloads.
+func (s *RemoteReadSource) Edges(
+	ctx context.Context,
+	q source.Query,
+) (promModel.Matrix, error) {
+	q.RateWindow = s.RateWindow(q.Start, q.End)
+
+	sourceType := "destination"
+	if q.Direction == source.Downstream {
+		sourceType = "source"
+	}
+	if q.Signal == source.ReporterGap {
+		return s.reporterGap(ctx, sourceType, q)
+	}
+	return s.evaluate(ctx, sourceType, q, s.profile.edgeLabels())
+}
+
+// Statuses returns the signal of the given workload.
+func (s *RemoteReadSource) Statuses(
+	ctx context.Context,
+	q source.Query,
+) (promModel.Matrix, error) {
+	q.RateWindow = s.RateWindow(q.Start, q.End)
+	return s.evaluate(ctx, "destination", q, s.profile.statusLabels())
+}
+
+// RateWindow returns the rate window of the range queries between start
+// and end, at least the step of the range.
+func (s *RemoteReadSource) RateWindow(
+	start time.Time,
+	end time.Time,
+) time.Duration {
+	window := s.rateWindow
+	if step := queryStep(start, end, s.maxPoints); step > window {
+		window = step
+	}
+	return window
+}
+
+// Evaluates the signal of the query grouped by the labels
+func (s *RemoteReadSource) evaluate(
+	ctx context.Context,
+	sourceType string,
+	q source.Query,
+	labels []string,
+) (promModel.Matrix, error) {
+	r := evalRange{
+		Start:  q.Start,
+		End:    q.End,
+		Step:   queryStep(q.Start, q.End, s.maxPoints),
+		Window: q.RateWindow,
+	}
+	matchers := requestMatchers(s.profile, sourceType, q, s.filters)
+
+	switch q.Signal {
+	case source.ErrorRate:
+		return s.ratio(
+			ctx,
+			s.profile.RequestsTotal,
+			Regexp("response_code", "5.."),
+			matchers,
+			labels,
+			r,
+		)
+	case source.RequestRate:
+		return s.requestRates(ctx, matchers, labels, r)
+	case source.ConnectionChurn:
+		return s.tcpRates(ctx, connectionMetrics(s.profile), matchers, labels, r)
+	case source.Throughput:
+		return s.tcpRates(ctx, throughputMetrics(s.profile), matchers, labels, r)
+	case source.GRPCErrorRate:
+		return s.grpcErrorRates(ctx, matchers, labels, r)
+	default:
+		return s.requestDurations(ctx, quantile(q), matchers, labels, r)
+	}
+}
+
+// Request duration quantile in seconds, histogram_quantile() of the bucket
+// rates
+func (s *RemoteReadSource) requestDurations(
+	ctx context.Context,
+	q float64,
+	matchers []Matcher,
+	labels []string,
+	r evalRange,
+) (promModel.Matrix, error) {
+	buckets, err := s.rates(ctx, s.profile.RequestDurationBucket, matchers, r)
+	if err != nil {
+		return nil, err
+	}
+	quantiles := histogramQuantile(
+		q,
+		sumBy(buckets, append([]string{"le"}, labels...)),
+	)
+	if s.profile.DurationScale > 1 {
+		quantiles = scaleMatrix(quantiles, float64(s.profile.DurationScale))
+	}
+	return quantiles, nil
+}
+
+// Request duration reported by the source minus the request duration
+// reported by the destination
+func (s *RemoteReadSource) reporterGap(
+	ctx context.Context,
+	sourceType string,
+	q source.Query,
+) (promModel.Matrix, error) {
+	r := evalRange{
+		Start:  q.Start,
+		End:    q.End,
+		Step:   queryStep(q.Start, q.End, s.maxPoints),
+		Window: q.RateWindow,
+	}
+	sourceDurations, err := s.requestDurations(
+		ctx,
+		quantile(q),
+		reporterRequestMatchers(s.profile.SourceReporter, sourceType, q, s.filters),
+		s.profile.edgeLabels(),
+		r,
+	)
+	if err != nil {
+		return nil, err
+	}
+	destinationDurations, err := s.requestDurations(
+		ctx,
+		quantile(q),
+		reporterRequestMatchers(s.profile.Reporter, sourceType, q, s.filters),
+		s.profile.edgeLabels(),
+		r,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return subMatrix(sourceDurations, destinationDurations), nil
+}
+
+func (s *RemoteReadSource) requestRates(
+	ctx context.Context,
+	matchers []Matcher,
+	labels []string,
+	r evalRange,
+) (promModel.Matrix, error) {
+	rates, err := s.rates(ctx, s.profile.RequestsTotal, matchers, r)
+	if err != nil {
+		return nil, err
+	}
+	return sumBy(rates, labels), nil
+}
+
+// Ratio of gRPC calls with non-OK status
+func (s *RemoteReadSource) grpcErrorRates(
+	ctx context.Context,
+	matchers []Matcher,
+	labels []string,
+	r evalRange,
+) (promModel.Matrix, error) {
+	return s.ratio(
+		ctx,
+		s.profile.RequestsTotal,
+		NotRegexp("grpc_response_status", "0|"),
+		withMatchers(matchers, Equal("request_protocol", "grpc")),
+		labels,
+		r,
+	)
+}
+
+// Rate of the series matching the matcher divided by the rate of all
+// series. The series are fetched once and matched in Go.
+func (s *RemoteReadSource) ratio(
+	ctx context.Context,
+	metric string,
+	matcher Matcher,
+	matchers []Matcher,
+	labels []string,
+	r evalRange,
+) (promModel.Matrix, error) {
+	all, err := s.rates(ctx, metric, matchers, r)
+	if err != nil {
+		return nil, err
+	}
+	matching, err := selectSeries(all, matcher)
+	if err != nil {
+		return nil, err
+	}
+	return ratioMatrix(sumBy(matching, labels), sumBy(all, labels)), nil
+}
+
+// Per second rate of the TCP metrics, request_protocol is set to "tcp"
+func (s *RemoteReadSource) tcpRates(
+	ctx context.Context,
+	metrics []string,
+	matchers []Matcher,
+	labels []string,
+	r evalRange,
+) (promModel.Matrix, error) {
+	all := promModel.Matrix{}
+	for _, metric := range metrics {
+		rates, err := s.rates(ctx, metric, matchers, r)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, rates...)
+	}
+	return setLabel(sumBy(all, labels), "request_protocol", "tcp"), nil
+}
+
+// Rates of the raw series of the metric
+func (s *RemoteReadSource) rates(
+	ctx context.Context,
+	metric string,
+	matchers []Matcher,
+	r evalRange,
+) (promModel.Matrix, error) {
+	// Samples of the first window are before the start
+	series, err := s.read(ctx, metric, matchers, r.Start.Add(-r.Window), r.End)
+	if err != nil {
+		return nil, err
+	}
+	return rateMatrix(series, r), nil
+}
+
+// Fetches the raw series of the metric between start and end
+func (s *RemoteReadSource) read(
+	ctx context.Context,
+	metric string,
+	matchers []Matcher,
+	start time.Time,
+	end time.Time,
+) (promModel.Matrix, error) {
+	query := Select(metric, matchers...).String()
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	pbMatchers, err := remoteReadMatchers(
+		withMatchers([]Matcher{Equal(promModel.MetricNameLabel, metric)}, matchers...),
+	)
+	if err != nil {
+		return nil, err
+	}
+	data, err := proto.Marshal(&pbReadRequest{
+		Queries: []*pbQuery{
+			{
+				StartTimestampMs: timestampMs(start),
+				EndTimestampMs:   timestampMs(end),
+				Matchers:         pbMatchers,
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(
+		http.MethodPost,
+		s.url,
+		bytes.NewReader(snappy.Encode(nil, data)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Read-Version", "0.1.0")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, s.readError(ctx, query, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, s.readError(ctx, query, err)
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, &source.QueryError{
+			Query:   query,
+			Message: fmt.Sprintf("%s: %s", resp.Status, strings.TrimSpace(string(body))),
+		}
+	}
+
+	decoded, err := snappy.Decode(nil, body)
+	if err != nil {
+		return nil, &source.QueryError{
+			Query:   query,
+			Message: fmt.Sprintf("invalid response: %s", err),
+			Err:     err,
+		}
+	}
+	readResponse := pbReadResponse{}
+	if err := proto.Unmarshal(decoded, &readResponse); err != nil {
+		return nil, &source.QueryError{
+			Query:   query,
+			Message: fmt.Sprintf("invalid response: %s", err),
+			Err:     err,
+		}
+	}
+
+	matrix := promModel.Matrix{}
+	for _, result := range readResponse.Results {
+		for _, series := range result.Timeseries {
+			matrix = append(matrix, sampleStream(series))
+		}
+	}
+	return matrix, nil
+}
+
+// Converts the error of the client to the typed errors of the source,
+// cancellation of the caller is returned as it is
+func (s *RemoteReadSource) readError(
+	ctx context.Context,
+	query string,
+	err error,
+) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &source.TimeoutError{
+			Query:   query,
+			Timeout: s.timeout,
+			Err:     err,
+		}
+	}
+	return err
+}
+
+func remoteReadMatchers(matchers []Matcher) ([]*pbLabelMatcher, error) {
+	pbMatchers := make([]*pbLabelMatcher, 0, len(matchers))
+	for _, matcher := range matchers {
+		pbMatcher := &pbLabelMatcher{Name: matcher.Label, Value: matcher.Value}
+		switch matcher.Op {
+		case MatchEqual:
+			pbMatcher.Type = pbMatchEqual
+		case MatchNotEqual:
+			pbMatcher.Type = pbMatchNotEqual
+		case MatchRegexp:
+			pbMatcher.Type = pbMatchRegexp
+		case MatchNotRegexp:
+			pbMatcher.Type = pbMatchNotRegexp
+		default:
+			return nil, fmt.Errorf("unknown matcher operator: %s", matcher.Op)
+		}
+		pbMatchers = append(pbMatchers, pbMatcher)
+	}
+	return pbMatchers, nil
+}
+
+// Returns the series the matcher matches, anchored like in PromQL
+func selectSeries(
+	matrix promModel.Matrix,
+	matcher Matcher,
+) (promModel.Matrix, error) {
+	var re *regexp.Regexp
+	if matcher.Op == MatchRegexp || matcher.Op == MatchNotRegexp {
+		var err error
+		re, err = regexp.Compile("^(?:" + matcher.Value + ")$")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	selected := promModel.Matrix{}
+	for _, sampleStream := range matrix {
+		value := string(sampleStream.Metric[promModel.LabelName(matcher.Label)])
+		var matches bool
+		switch matcher.Op {
+		case MatchEqual:
+			matches = value == matcher.Value
+		case MatchNotEqual:
+			matches = value != matcher.Value
+		case MatchRegexp:
+			matches = re.MatchString(value)
+		case MatchNotRegexp:
+			matches = !re.MatchString(value)
+		}
+		if matches {
+			selected = append(selected, sampleStream)
+		}
+	}
+	return selected, nil
+}
+
+func sampleStream(series *pbTimeSeries) *promModel.SampleStream {
+	metric := make(promModel.Metric, len(series.Labels))
+	for _, l := range series.Labels {
+		metric[promModel.LabelName(l.Name)] = promModel.LabelValue(l.Value)
+	}
+	values := make([]promModel.SamplePair, 0, len(series.Samples))
+	for _, s := range series.Samples {
+		values = append(values, promModel.SamplePair{
+			Timestamp: promModel.Time(s.Timestamp),
+			Value:     promModel.SampleValue(s.Value),
+		})
+	}
+	return &promModel.SampleStream{Metric: metric, Values: values}
+}
+
+func timestampMs(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
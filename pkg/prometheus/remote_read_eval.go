@@ -0,0 +1,358 @@
+package prometheus
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	promModel "github.com/prometheus/common/model"
+)
+
+// Evaluation of the queries on raw series, the PromQL functions the
+// remote read source needs
+
+// Timestamps of a range query
+type evalRange struct {
+	Start  time.Time
+	End    time.Time
+	Step   time.Duration
+	Window time.Duration
+}
+
+func (r evalRange) timestamps() []promModel.Time {
+	timestamps := []promModel.Time{}
+	for t := r.Start; !t.After(r.End); t = t.Add(r.Step) {
+		timestamps = append(timestamps, promModel.TimeFromUnixNano(t.UnixNano()))
+	}
+	return timestamps
+}
+
+// Per second rate of the counters at every timestamp of the range, over the
+// samples of the window before the timestamp. Counter resets are handled
+// like rate() does, the increase is not extrapolated to the window
+// boundaries. Timestamps with less than two samples have no value.
+func rateMatrix(counters promModel.Matrix, r evalRange) promModel.Matrix {
+	timestamps := r.timestamps()
+
+	rates := promModel.Matrix{}
+	for _, counter := range counters {
+		samples := counter.Values
+		values := make([]promModel.SamplePair, 0, len(timestamps))
+		for _, t := range timestamps {
+			from := sort.Search(len(samples), func(i int) bool {
+				return samples[i].Timestamp > t.Add(-r.Window)
+			})
+			to := sort.Search(len(samples), func(i int) bool {
+				return samples[i].Timestamp > t
+			})
+			if to-from < 2 {
+				continue
+			}
+
+			var increase float64
+			for i := from + 1; i < to; i++ {
+				current := float64(samples[i].Value)
+				previous := float64(samples[i-1].Value)
+				if current < previous {
+					// Counter reset
+					previous = 0
+				}
+				increase += current - previous
+			}
+			elapsed := samples[to-1].Timestamp.Sub(samples[from].Timestamp)
+			values = append(values, promModel.SamplePair{
+				Timestamp: t,
+				Value:     promModel.SampleValue(increase / elapsed.Seconds()),
+			})
+		}
+		if len(values) == 0 {
+			continue
+		}
+		rates = append(rates, &promModel.SampleStream{
+			Metric: dropMetricName(counter.Metric),
+			Values: values,
+		})
+	}
+	return rates
+}
+
+// Sums the series with the same labels, like sum() by (labels)
+func sumBy(matrix promModel.Matrix, labels []string) promModel.Matrix {
+	groups := make(map[promModel.Fingerprint]*promModel.SampleStream)
+	sums := make(map[promModel.Fingerprint]map[promModel.Time]float64)
+	order := []promModel.Fingerprint{}
+	for _, sampleStream := range matrix {
+		metric := keepLabels(sampleStream.Metric, labels)
+		fingerprint := metric.Fingerprint()
+		if _, found := groups[fingerprint]; !found {
+			groups[fingerprint] = &promModel.SampleStream{Metric: metric}
+			sums[fingerprint] = make(map[promModel.Time]float64)
+			order = append(order, fingerprint)
+		}
+		for _, samplePair := range sampleStream.Values {
+			sums[fingerprint][samplePair.Timestamp] += float64(samplePair.Value)
+		}
+	}
+
+	summed := make(promModel.Matrix, 0, len(order))
+	for _, fingerprint := range order {
+		sampleStream := groups[fingerprint]
+		sampleStream.Values = sortedValues(sums[fingerprint])
+		summed = append(summed, sampleStream)
+	}
+	return summed
+}
+
+// Bucket of a histogram at a timestamp
+type bucket struct {
+	upperBound float64
+	count      float64
+}
+
+// Quantile of the bucket rates of every histogram at every timestamp, like
+// histogram_quantile(). The buckets are grouped by the labels except le.
+func histogramQuantile(q float64, buckets promModel.Matrix) promModel.Matrix {
+	histograms := make(map[promModel.Fingerprint]*promModel.SampleStream)
+	counts := make(map[promModel.Fingerprint]map[promModel.Time][]bucket)
+	order := []promModel.Fingerprint{}
+	for _, sampleStream := range buckets {
+		upperBound, err := strconv.ParseFloat(
+			string(sampleStream.Metric[promModel.BucketLabel]),
+			64,
+		)
+		if err != nil {
+			continue
+		}
+		metric := sampleStream.Metric.Clone()
+		delete(metric, promModel.BucketLabel)
+		fingerprint := metric.Fingerprint()
+		if _, found := histograms[fingerprint]; !found {
+			histograms[fingerprint] = &promModel.SampleStream{Metric: metric}
+			counts[fingerprint] = make(map[promModel.Time][]bucket)
+			order = append(order, fingerprint)
+		}
+		for _, samplePair := range sampleStream.Values {
+			counts[fingerprint][samplePair.Timestamp] = append(
+				counts[fingerprint][samplePair.Timestamp],
+				bucket{upperBound: upperBound, count: float64(samplePair.Value)},
+			)
+		}
+	}
+
+	quantiles := make(promModel.Matrix, 0, len(order))
+	for _, fingerprint := range order {
+		values := make(map[promModel.Time]float64)
+		for t, histogram := range counts[fingerprint] {
+			values[t] = bucketQuantile(q, histogram)
+		}
+		sampleStream := histograms[fingerprint]
+		sampleStream.Values = sortedValues(values)
+		quantiles = append(quantiles, sampleStream)
+	}
+	return quantiles
+}
+
+// Quantile of the cumulative buckets, linear interpolation within the
+// bucket of the rank like in Prometheus
+func bucketQuantile(q float64, buckets []bucket) float64 {
+	if q < 0 {
+		return math.Inf(-1)
+	}
+	if q > 1 {
+		return math.Inf(+1)
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].upperBound < buckets[j].upperBound
+	})
+	if len(buckets) < 2 || !math.IsInf(buckets[len(buckets)-1].upperBound, +1) {
+		return math.NaN()
+	}
+	// Counts of rates can decrease due to precision issues
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i].count < buckets[i-1].count {
+			buckets[i].count = buckets[i-1].count
+		}
+	}
+
+	observations := buckets[len(buckets)-1].count
+	if observations == 0 {
+		return math.NaN()
+	}
+	rank := q * observations
+	b := sort.Search(len(buckets)-1, func(i int) bool {
+		return buckets[i].count >= rank
+	})
+	if b == len(buckets)-1 {
+		return buckets[len(buckets)-2].upperBound
+	}
+	if b == 0 && buckets[0].upperBound <= 0 {
+		return buckets[0].upperBound
+	}
+
+	var bucketStart float64
+	bucketEnd := buckets[b].upperBound
+	count := buckets[b].count
+	if b > 0 {
+		bucketStart = buckets[b-1].upperBound
+		count -= buckets[b-1].count
+		rank -= buckets[b-1].count
+	}
+	return bucketStart + (bucketEnd-bucketStart)*(rank/count)
+}
+
+// Divides the matching series by the series with the same labels of all,
+// zero when there is no matching series: (matching or all * 0) / all
+func ratioMatrix(matching promModel.Matrix, all promModel.Matrix) promModel.Matrix {
+	return combine(all, matching, func(total float64, value *float64) *float64 {
+		ratio := 0 / total
+		if value != nil {
+			ratio = *value / total
+		}
+		return &ratio
+	})
+}
+
+// Subtracts the series with the same labels, points without a value on
+// both sides are dropped
+func subMatrix(lhs promModel.Matrix, rhs promModel.Matrix) promModel.Matrix {
+	return combine(lhs, rhs, func(left float64, right *float64) *float64 {
+		if right == nil {
+			return nil
+		}
+		diff := left - *right
+		return &diff
+	})
+}
+
+// Calculates the value of every point of the series, with the point of the
+// other series of the same labels at the same timestamp when it exists
+func combine(
+	matrix promModel.Matrix,
+	other promModel.Matrix,
+	op func(value float64, otherValue *float64) *float64,
+) promModel.Matrix {
+	others := make(map[promModel.Fingerprint]map[promModel.Time]float64)
+	for _, sampleStream := range other {
+		values := make(map[promModel.Time]float64, len(sampleStream.Values))
+		for _, samplePair := range sampleStream.Values {
+			values[samplePair.Timestamp] = float64(samplePair.Value)
+		}
+		others[sampleStream.Metric.Fingerprint()] = values
+	}
+
+	combined := make(promModel.Matrix, 0, len(matrix))
+	for _, sampleStream := range matrix {
+		otherValues := others[sampleStream.Metric.Fingerprint()]
+		values := make([]promModel.SamplePair, 0, len(sampleStream.Values))
+		for _, samplePair := range sampleStream.Values {
+			var otherValue *float64
+			if value, found := otherValues[samplePair.Timestamp]; found {
+				otherValue = &value
+			}
+			value := op(float64(samplePair.Value), otherValue)
+			if value == nil {
+				continue
+			}
+			values = append(values, promModel.SamplePair{
+				Timestamp: samplePair.Timestamp,
+				Value:     promModel.SampleValue(*value),
+			})
+		}
+		if len(values) == 0 {
+			continue
+		}
+		combined = append(combined, &promModel.SampleStream{
+			Metric: sampleStream.Metric,
+			Values: values,
+		})
+	}
+	return combined
+}
+
+// Returns the series of lhs and the series of rhs without the labels of
+// a series in lhs, like or
+func orMatrix(lhs promModel.Matrix, rhs promModel.Matrix) promModel.Matrix {
+	found := make(map[promModel.Fingerprint]bool, len(lhs))
+	for _, sampleStream := range lhs {
+		found[sampleStream.Metric.Fingerprint()] = true
+	}
+	union := append(promModel.Matrix{}, lhs...)
+	for _, sampleStream := range rhs {
+		if !found[sampleStream.Metric.Fingerprint()] {
+			union = append(union, sampleStream)
+		}
+	}
+	return union
+}
+
+// Divides every value by the divisor
+func scaleMatrix(matrix promModel.Matrix, divisor float64) promModel.Matrix {
+	for _, sampleStream := range matrix {
+		for i := range sampleStream.Values {
+			sampleStream.Values[i].Value /= promModel.SampleValue(divisor)
+		}
+	}
+	return matrix
+}
+
+// Sets the label of every series
+func setLabel(
+	matrix promModel.Matrix,
+	name promModel.LabelName,
+	value promModel.LabelValue,
+) promModel.Matrix {
+	for _, sampleStream := range matrix {
+		sampleStream.Metric = sampleStream.Metric.Clone()
+		sampleStream.Metric[name] = value
+	}
+	return matrix
+}
+
+// Last point of every series at the timestamp, the instant vector of a
+// single step range
+func vectorAt(matrix promModel.Matrix, t promModel.Time) promModel.Vector {
+	vector := promModel.Vector{}
+	for _, sampleStream := range matrix {
+		for _, samplePair := range sampleStream.Values {
+			if samplePair.Timestamp == t {
+				vector = append(vector, &promModel.Sample{
+					Metric:    sampleStream.Metric,
+					Value:     samplePair.Value,
+					Timestamp: t,
+				})
+			}
+		}
+	}
+	return vector
+}
+
+func keepLabels(metric promModel.Metric, labels []string) promModel.Metric {
+	kept := make(promModel.Metric, len(labels))
+	for _, name := range labels {
+		if value, found := metric[promModel.LabelName(name)]; found {
+			kept[promModel.LabelName(name)] = value
+		}
+	}
+	return kept
+}
+
+func dropMetricName(metric promModel.Metric) promModel.Metric {
+	dropped := metric.Clone()
+	delete(dropped, promModel.MetricNameLabel)
+	return dropped
+}
+
+func sortedValues(values map[promModel.Time]float64) []promModel.SamplePair {
+	pairs := make([]promModel.SamplePair, 0, len(values))
+	for t, value := range values {
+		pairs = append(pairs, promModel.SamplePair{
+			Timestamp: t,
+			Value:     promModel.SampleValue(value),
+		})
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].Timestamp < pairs[j].Timestamp
+	})
+	return pairs
+}
@@ -0,0 +1,110 @@
+package prometheus
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	promModel "github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateMatrix(t *testing.T) {
+	counter := &promModel.SampleStream{
+		Metric: promModel.Metric{"__name__": "istio_requests_total", "reporter": "destination"},
+		Values: []promModel.SamplePair{
+			{Timestamp: 0, Value: 10},
+			{Timestamp: 15000, Value: 25},
+			{Timestamp: 30000, Value: 40},
+			// Counter reset
+			{Timestamp: 45000, Value: 5},
+			{Timestamp: 60000, Value: 20},
+		},
+	}
+	r := evalRange{
+		Start:  time.Unix(30, 0),
+		End:    time.Unix(75, 0),
+		Step:   15 * time.Second,
+		Window: 30 * time.Second,
+	}
+
+	assert.Equal(t, promModel.Matrix{
+		&promModel.SampleStream{
+			Metric: promModel.Metric{"reporter": "destination"},
+			Values: []promModel.SamplePair{
+				{Timestamp: 30000, Value: 1},
+				{Timestamp: 45000, Value: 1 / 3.0},
+				{Timestamp: 60000, Value: 1},
+				// Single sample in the window
+			},
+		},
+	}, rateMatrix(promModel.Matrix{counter}, r))
+}
+
+func TestBucketQuantile(t *testing.T) {
+	buckets := []bucket{
+		{upperBound: math.Inf(+1), count: 1.25},
+		{upperBound: 0.1, count: 0.5},
+		{upperBound: 0.5, count: 1},
+	}
+	assert.InDelta(t, 0.0625, bucketQuantile(0.25, buckets), 1e-9)
+	assert.InDelta(t, 0.2, bucketQuantile(0.5, buckets), 1e-9)
+	// Rank in the +Inf bucket
+	assert.Equal(t, 0.5, bucketQuantile(0.95, buckets))
+
+	assert.True(t, math.IsNaN(bucketQuantile(0.5, []bucket{
+		{upperBound: math.Inf(+1), count: 0},
+		{upperBound: 0.1, count: 0},
+	})))
+	// Without +Inf bucket
+	assert.True(t, math.IsNaN(bucketQuantile(0.5, []bucket{
+		{upperBound: 0.1, count: 0.5},
+		{upperBound: 0.5, count: 1},
+	})))
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	series := func(le string, value float64) *promModel.SampleStream {
+		return &promModel.SampleStream{
+			Metric: promModel.Metric{"le": promModel.LabelValue(le), "app": "reviews"},
+			Values: []promModel.SamplePair{{Timestamp: 1000, Value: promModel.SampleValue(value)}},
+		}
+	}
+
+	assert.Equal(t, promModel.Matrix{
+		&promModel.SampleStream{
+			Metric: promModel.Metric{"app": "reviews"},
+			Values: []promModel.SamplePair{{Timestamp: 1000, Value: 0.2}},
+		},
+	}, histogramQuantile(0.5, promModel.Matrix{
+		series("0.1", 0.5),
+		series("0.5", 1),
+		series("+Inf", 1.25),
+	}))
+}
+
+func TestRatioMatrix(t *testing.T) {
+	stream := func(app string, values ...float64) *promModel.SampleStream {
+		pairs := []promModel.SamplePair{}
+		for i, value := range values {
+			pairs = append(pairs, promModel.SamplePair{
+				Timestamp: promModel.Time(i * 1000),
+				Value:     promModel.SampleValue(value),
+			})
+		}
+		return &promModel.SampleStream{
+			Metric: promModel.Metric{"app": promModel.LabelValue(app)},
+			Values: pairs,
+		}
+	}
+
+	ratios := ratioMatrix(
+		promModel.Matrix{stream("reviews", 1, 2)},
+		promModel.Matrix{stream("reviews", 4, 4), stream("details", 2, 0)},
+	)
+	assert.Len(t, ratios, 2)
+	assert.Equal(t, stream("reviews", 0.25, 0.5), ratios[0])
+	// No errors and no requests
+	assert.Equal(t, promModel.SampleValue(0), ratios[1].Values[0].Value)
+	assert.True(t, math.IsNaN(float64(ratios[1].Values[1].Value)))
+}
@@ -0,0 +1,278 @@
+package prometheus
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/hekike/outlier-istio/pkg/source"
+	promModel "github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// Serves the series matching the queries of the remote read requests
+func remoteReadStub(t *testing.T, series []*pbTimeSeries) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(
+		w http.ResponseWriter,
+		r *http.Request,
+	) {
+		assert.Equal(t, "snappy", r.Header.Get("Content-Encoding"))
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data, err := snappy.Decode(nil, body)
+		if err != nil {
+			t.Error(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		req := pbReadRequest{}
+		if err := proto.Unmarshal(data, &req); err != nil {
+			t.Error(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		resp := pbReadResponse{}
+		for _, query := range req.Queries {
+			result := &pbQueryResult{}
+			for _, s := range series {
+				if !stubMatches(s, query.Matchers) {
+					continue
+				}
+				matched := &pbTimeSeries{Labels: s.Labels}
+				for _, sample := range s.Samples {
+					if sample.Timestamp >= query.StartTimestampMs &&
+						sample.Timestamp <= query.EndTimestampMs {
+						matched.Samples = append(matched.Samples, sample)
+					}
+				}
+				result.Timeseries = append(result.Timeseries, matched)
+			}
+			resp.Results = append(resp.Results, result)
+		}
+
+		data, err = proto.Marshal(&resp)
+		if err != nil {
+			t.Error(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Encoding", "snappy")
+		w.Write(snappy.Encode(nil, data))
+	}))
+}
+
+func stubMatches(series *pbTimeSeries, matchers []*pbLabelMatcher) bool {
+	labels := make(map[string]string)
+	for _, l := range series.Labels {
+		labels[l.Name] = l.Value
+	}
+	for _, matcher := range matchers {
+		value := labels[matcher.Name]
+		re := regexp.MustCompile("^(?:" + matcher.Value + ")$")
+		switch {
+		case matcher.Type == pbMatchEqual && value != matcher.Value,
+			matcher.Type == pbMatchNotEqual && value == matcher.Value,
+			matcher.Type == pbMatchRegexp && !re.MatchString(value),
+			matcher.Type == pbMatchNotRegexp && re.MatchString(value):
+			return false
+		}
+	}
+	return true
+}
+
+// Counter of the productpage-v1 -> reviews-v3 edge increasing by rate,
+// scraped every 15s between start and end
+func stubCounter(
+	name string,
+	labels map[string]string,
+	rate float64,
+	start time.Time,
+	end time.Time,
+) *pbTimeSeries {
+	series := &pbTimeSeries{
+		Labels: []*pbLabel{
+			{Name: "__name__", Value: name},
+			{Name: "reporter", Value: "destination"},
+			{Name: "request_protocol", Value: "http"},
+			{Name: "source_workload_namespace", Value: "default"},
+			{Name: "source_workload", Value: "productpage-v1"},
+			{Name: "source_app", Value: "productpage"},
+			{Name: "destination_workload_namespace", Value: "default"},
+			{Name: "destination_workload", Value: "reviews-v3"},
+			{Name: "destination_app", Value: "reviews"},
+		},
+	}
+	for name, value := range labels {
+		series.Labels = append(series.Labels, &pbLabel{Name: name, Value: value})
+	}
+	for t := start; !t.After(end); t = t.Add(15 * time.Second) {
+		series.Samples = append(series.Samples, &pbSample{
+			Value:     rate * t.Sub(start).Seconds(),
+			Timestamp: timestampMs(t),
+		})
+	}
+	return series
+}
+
+func stubSeries(start time.Time, end time.Time) []*pbTimeSeries {
+	p := IstioMixer
+	return []*pbTimeSeries{
+		stubCounter(p.RequestsTotal, map[string]string{"response_code": "200"}, 1, start, end),
+		stubCounter(p.RequestsTotal, map[string]string{"response_code": "503"}, 0.25, start, end),
+		stubCounter(p.RequestDurationBucket, map[string]string{"le": "0.1"}, 0.5, start, end),
+		stubCounter(p.RequestDurationBucket, map[string]string{"le": "0.5"}, 1, start, end),
+		stubCounter(p.RequestDurationBucket, map[string]string{"le": "+Inf"}, 1.25, start, end),
+	}
+}
+
+func TestRemoteReadSource(t *testing.T) {
+	end := time.Date(2018, 10, 27, 15, 0, 0, 0, time.UTC)
+	start := end.Add(-time.Hour)
+	mockServer := remoteReadStub(t, stubSeries(start.Add(-time.Hour), end))
+	defer mockServer.Close()
+
+	s, err := NewRemoteReadSource(mockServer.URL, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := source.Query{
+		Namespace: "default",
+		Workload:  "reviews-v3",
+		Direction: source.Upstream,
+		Quantile:  0.5,
+		Start:     start,
+		End:       end,
+	}
+	expected := promModel.Metric{
+		"request_protocol":               "http",
+		"source_workload_namespace":      "default",
+		"source_workload":                "productpage-v1",
+		"source_app":                     "productpage",
+		"destination_workload_namespace": "default",
+		"destination_workload":           "reviews-v3",
+		"destination_app":                "reviews",
+	}
+
+	for signal, value := range map[source.Signal]float64{
+		source.Latency:     0.2,
+		source.ErrorRate:   0.2,
+		source.RequestRate: 1.25,
+	} {
+		query.Signal = signal
+		matrix, err := s.Edges(context.Background(), query)
+		assert.NoError(t, err)
+		if !assert.Len(t, matrix, 1, signal) {
+			continue
+		}
+		assert.Equal(t, expected, matrix[0].Metric, signal)
+		// Every 5s step of the range
+		assert.Len(t, matrix[0].Values, 721, signal)
+		for _, samplePair := range matrix[0].Values {
+			assert.InDelta(t, value, float64(samplePair.Value), 1e-9, signal)
+		}
+	}
+
+	// Without gRPC calls
+	query.Signal = source.GRPCErrorRate
+	matrix, err := s.Edges(context.Background(), query)
+	assert.NoError(t, err)
+	assert.Empty(t, matrix)
+
+	// Downstream edges of the source workload
+	query.Signal = source.RequestRate
+	query.Direction = source.Downstream
+	matrix, err = s.Edges(context.Background(), query)
+	assert.NoError(t, err)
+	assert.Empty(t, matrix)
+
+	query.Signal = source.Latency
+	matrix, err = s.Statuses(context.Background(), query)
+	assert.NoError(t, err)
+	assert.Len(t, matrix, 1)
+	assert.Equal(t, promModel.Metric{
+		"request_protocol":               "http",
+		"destination_workload_namespace": "default",
+	}, matrix[0].Metric)
+}
+
+func TestRemoteReadSourceTopology(t *testing.T) {
+	end := time.Now()
+	mockServer := remoteReadStub(t, stubSeries(end.Add(-5*time.Minute), end))
+	defer mockServer.Close()
+
+	s, err := NewRemoteReadSource(mockServer.URL, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vector, err := s.Topology(context.Background(), source.RequestRate)
+	assert.NoError(t, err)
+	assert.Len(t, vector, 1)
+	assert.InDelta(t, 1.25, float64(vector[0].Value), 1e-9)
+}
+
+func TestRemoteReadSourceErrors(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(
+		w http.ResponseWriter,
+		r *http.Request,
+	) {
+		if r.Header.Get("X-Test-Timeout") != "" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		http.Error(w, "remote read is disabled", http.StatusBadRequest)
+	}))
+	defer mockServer.Close()
+
+	s, err := NewRemoteReadSource(mockServer.URL, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := source.Query{Workload: "reviews-v3", End: time.Now()}
+	query.Start = query.End.Add(-time.Hour)
+
+	_, err = s.Statuses(context.Background(), query)
+	assert.EqualError(
+		t,
+		err,
+		"query failed: 400 Bad Request: remote read is disabled",
+	)
+	assert.IsType(t, &source.QueryError{}, err)
+
+	s, err = NewRemoteReadSource(mockServer.URL, Options{
+		Timeout: 10 * time.Millisecond,
+		Headers: map[string]string{"X-Test-Timeout": "true"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Statuses(context.Background(), query)
+	assert.IsType(t, &source.TimeoutError{}, err)
+}
+
+func TestRemoteReadRequestEncoding(t *testing.T) {
+	data, err := proto.Marshal(&pbQuery{
+		StartTimestampMs: 1,
+		EndTimestampMs:   2,
+		Matchers: []*pbLabelMatcher{
+			{Type: pbMatchNotEqual, Name: "a", Value: "b"},
+		},
+	})
+	assert.NoError(t, err)
+	// Wire format of prompb.Query
+	assert.Equal(t, []byte{
+		0x08, 0x01, 0x10, 0x02,
+		0x1a, 0x08, 0x08, 0x01, 0x12, 0x01, 'a', 0x1a, 0x01, 'b',
+	}, data)
+}
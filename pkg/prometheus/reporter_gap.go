@@ -0,0 +1,49 @@
+package prometheus
+
+import (
+	"github.com/hekike/outlier-istio/pkg/source"
+)
+
+// GetDownstreamReporterGapQuery returns the reporter gap query of the
+// workloads called from the given workload.
+func GetDownstreamReporterGapQuery(
+	p Profile,
+	q source.Query,
+	filters source.Filters,
+) string {
+	return reporterGapQuery(p, "source", q, filters)
+}
+
+// GetUpstreamReporterGapQuery returns the reporter gap query of the requests
+// made to the given workload by its sources.
+func GetUpstreamReporterGapQuery(
+	p Profile,
+	q source.Query,
+	filters source.Filters,
+) string {
+	return reporterGapQuery(p, "destination", q, filters)
+}
+
+// Request duration reported by the source minus the request duration
+// reported by the destination: the network and sidecar overhead
+func reporterGapQuery(
+	p Profile,
+	sourceType string,
+	q source.Query,
+	filters source.Filters,
+) string {
+	return Sub(
+		requestDurationsExpr(
+			p,
+			q,
+			reporterRequestMatchers(p.SourceReporter, sourceType, q, filters),
+			p.edgeLabels(),
+		),
+		requestDurationsExpr(
+			p,
+			q,
+			reporterRequestMatchers(p.Reporter, sourceType, q, filters),
+			p.edgeLabels(),
+		),
+	).String()
+}
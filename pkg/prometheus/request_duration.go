@@ -1,99 +1,154 @@
 package prometheus
 
 import (
-	"fmt"
 	"time"
 
-	"github.com/prometheus/common/model"
+	"github.com/hekike/outlier-istio/pkg/source"
 )
 
-const workloadRequestDurationPercentilesTemplate = `
-	histogram_quantile(
-		0.95,
-		sum(
-			rate(
-				istio_request_duration_seconds_bucket {
-					reporter = "destination",
-					%s_workload = "%s",
-					destination_app != "mixer",
-					destination_app != "telemetry",
-					destination_app != "policy"
-				}[%s]
-			)
-		) by (
-			le,
-			%s
-		)
-	)
-`
-
-// data resolution in Prometheus (Istio default is 5s)
+// data resolution in Prometheus (Istio default is 5s), the minimum step of
+// range queries
 const resolutionStep = 5 * time.Second
 
-// GetDownstreamRequestDurations returns request durations for workloads called
-// from the given workload.
-func GetDownstreamRequestDurations(
-	addr string,
-	start time.Time,
-	end time.Time,
-	workload string,
-) (model.Matrix, error) {
-	query := GetDownstreamRequestDurationsQuery(workload)
-	return executeQueryRange(addr, start, end, query)
+// GetDownstreamRequestDurationsQuery returns a Prometheus query
+func GetDownstreamRequestDurationsQuery(
+	p Profile,
+	q source.Query,
+	filters source.Filters,
+) string {
+	return requestDurationsQuery(p, "source", q, filters, p.edgeLabels())
 }
 
-// GetDownstreamRequestDurationsQuery returns a Prometheus query
-func GetDownstreamRequestDurationsQuery(workload string) string {
-	return fmt.Sprintf(
-		workloadRequestDurationPercentilesTemplate,
-		"source",
-		workload,
-		"60s",
-		"request_protocol, source_workload, source_app, destination_workload, destination_app",
+// GetUpstreamRequestDurationsQuery returns a Prometheus query
+func GetUpstreamRequestDurationsQuery(
+	p Profile,
+	q source.Query,
+	filters source.Filters,
+) string {
+	return requestDurationsQuery(p, "destination", q, filters, p.edgeLabels())
+}
+
+// GetStatusesQuery returns statuses query for given workload
+func GetStatusesQuery(
+	p Profile,
+	q source.Query,
+	filters source.Filters,
+) string {
+	return requestDurationsQuery(
+		p,
+		"destination",
+		q,
+		filters,
+		p.statusLabels(),
 	)
 }
 
-// GetUpstreamRequestDurations returns request durations for requests made to
-// given workload from sources.
-func GetUpstreamRequestDurations(
-	addr string,
-	start time.Time,
-	end time.Time,
-	workload string,
-) (model.Matrix, error) {
-	query := GetUpstreamRequestDurationsQuery(workload)
-	return executeQueryRange(addr, start, end, query)
+func requestDurationsQuery(
+	p Profile,
+	sourceType string,
+	q source.Query,
+	filters source.Filters,
+	labels []string,
+) string {
+	return requestDurationsExpr(
+		p,
+		q,
+		requestMatchers(p, sourceType, q, filters),
+		labels,
+	).String()
 }
 
-// GetUpstreamRequestDurationsQuery returns a Prometheus query
-func GetUpstreamRequestDurationsQuery(workload string) string {
-	return fmt.Sprintf(
-		workloadRequestDurationPercentilesTemplate,
-		"destination",
-		workload,
-		"60s",
-		"request_protocol, source_workload, source_app, destination_workload, destination_app",
+// Request duration quantile in seconds
+func requestDurationsExpr(
+	p Profile,
+	q source.Query,
+	matchers []Matcher,
+	labels []string,
+) Expr {
+	var expr Expr = HistogramQuantile(
+		quantile(q),
+		Sum(rateOf(p, p.RequestDurationBucket, matchers, q.RateWindow)).
+			GroupBy(append([]string{"le"}, labels...)...),
 	)
+	if p.DurationScale > 1 {
+		expr = Div(expr, Number(p.DurationScale))
+	}
+	return expr
 }
 
-// GetStatuses returns statuses for given workload
-func GetStatuses(
-	addr string,
-	start time.Time,
-	end time.Time,
-	workload string,
-) (model.Matrix, error) {
-	query := GetStatusesQuery(workload)
-	return executeQueryRange(addr, start, end, query)
+// Label matchers of the Istio request metrics
+func requestMatchers(
+	p Profile,
+	sourceType string,
+	q source.Query,
+	filters source.Filters,
+) []Matcher {
+	return reporterRequestMatchers(p.Reporter, sourceType, q, filters)
 }
 
-// GetStatusesQuery returns statuses query for given workload
-func GetStatusesQuery(workload string) string {
-	return fmt.Sprintf(
-		workloadRequestDurationPercentilesTemplate,
-		"destination",
-		workload,
-		"60s",
-		"request_protocol",
+// Label matchers of the Istio request metrics of the given reporter
+func reporterRequestMatchers(
+	reporter string,
+	sourceType string,
+	q source.Query,
+	filters source.Filters,
+) []Matcher {
+	matchers := []Matcher{Equal("reporter", reporter)}
+	matchers = append(
+		matchers,
+		workloadSelector(sourceType, q.Namespace, q.Workload)...,
 	)
+	return append(matchers, filterMatchers(filters)...)
+}
+
+func reporterMatcher(p Profile) Matcher {
+	return Equal("reporter", p.Reporter)
+}
+
+// Selects the workload on the source or destination side, in any namespace
+// when namespace is empty.
+func workloadSelector(
+	sourceType string,
+	namespace string,
+	workload string,
+) []Matcher {
+	selector := []Matcher{Equal(sourceType+"_workload", workload)}
+	if namespace != "" {
+		selector = append(
+			selector,
+			Equal(sourceType+"_workload_namespace", namespace),
+		)
+	}
+	return selector
+}
+
+// Per second rate of the metric over the window, DefaultRateWindow when
+// zero. The recorded rate is selected when it is available.
+func rateOf(
+	p Profile,
+	metric string,
+	matchers []Matcher,
+	window time.Duration,
+) Expr {
+	if window == 0 {
+		window = DefaultRateWindow
+	}
+	if p.useRecorded(metric, matchers, window) {
+		return Select(recordedMetric(metric, window), matchers...)
+	}
+	return Rate(Select(metric, matchers...).Over(window))
+}
+
+// Returns the matchers extended with the extra matchers
+func withMatchers(matchers []Matcher, extra ...Matcher) []Matcher {
+	extended := make([]Matcher, 0, len(matchers)+len(extra))
+	extended = append(extended, matchers...)
+	return append(extended, extra...)
+}
+
+func quantile(q source.Query) float64 {
+	if q.Quantile == 0 {
+		return source.DefaultQuantile
+	}
+	return q.Quantile
 }
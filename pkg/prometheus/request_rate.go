@@ -0,0 +1,49 @@
+package prometheus
+
+import (
+	"github.com/hekike/outlier-istio/pkg/source"
+)
+
+// GetDownstreamRequestRatesQuery returns the request rate query of the
+// workloads called from the given workload.
+func GetDownstreamRequestRatesQuery(
+	p Profile,
+	q source.Query,
+	filters source.Filters,
+) string {
+	return requestRateQuery(p, "source", q, filters, p.edgeLabels())
+}
+
+// GetUpstreamRequestRatesQuery returns the request rate query of the requests
+// made to the given workload by its sources.
+func GetUpstreamRequestRatesQuery(
+	p Profile,
+	q source.Query,
+	filters source.Filters,
+) string {
+	return requestRateQuery(p, "destination", q, filters, p.edgeLabels())
+}
+
+// GetRequestRatesQuery returns the request rate query of the given workload.
+func GetRequestRatesQuery(
+	p Profile,
+	q source.Query,
+	filters source.Filters,
+) string {
+	return requestRateQuery(p, "destination", q, filters, p.statusLabels())
+}
+
+func requestRateQuery(
+	p Profile,
+	sourceType string,
+	q source.Query,
+	filters source.Filters,
+	labels []string,
+) string {
+	return Sum(rateOf(
+		p,
+		p.RequestsTotal,
+		requestMatchers(p, sourceType, q, filters),
+		q.RateWindow,
+	)).GroupBy(labels...).String()
+}
@@ -0,0 +1,41 @@
+package prometheus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hekike/outlier-istio/pkg/source"
+	"github.com/hekike/outlier-istio/test/fixtures"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSourceEdgesRequestRate(t *testing.T) {
+	query := source.Query{
+		Namespace: "default",
+		Workload:  "productpage-v1",
+		Direction: source.Downstream,
+		Signal:    source.RequestRate,
+		Start:     time.Unix(1540678767, 0),
+		End:       time.Unix(1540683267, 0),
+	}
+
+	mockServer := fixtures.PrometheusResponseStub(t, map[string]string{
+		GetDownstreamRequestRatesQuery(IstioMixer, query, source.DefaultFilters): "../../test/mock/prom_workload_source_request_rates.json",
+	})
+	defer mockServer.Close()
+
+	s, err := NewSource(mockServer.URL, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matrix, err := s.Edges(context.Background(), query)
+	assert.NoError(t, err)
+	assert.Len(t, matrix, 2)
+	assert.Equal(
+		t,
+		"details-v1",
+		string(matrix[0].Metric["destination_workload"]),
+	)
+}
@@ -1,40 +1,30 @@
 package prometheus
 
 import (
-	"fmt"
+	"time"
 
-	promModel "github.com/prometheus/common/model"
+	"github.com/hekike/outlier-istio/pkg/source"
 )
 
-const workloadsQueryTemplate = `
-	sum(
-		rate(
-			istio_requests_total {
-				reporter = "destination",
-				source_app != "istio-ingressgateway",
-				source_app != "telemetry",
-				destination_app != "telemetry",
-				source_app != "policy",
-				destination_app != "policy",
-				source_app != "mixer",
-				destination_app != "mixer"
-			}[%s]
-		)
-	) by (
-		source_workload,
-		destination_workload,
-		source_app,
-		destination_app
-	)
-`
-
-// GetRequestsTotalByWorkloads returns request totals by workloads
-func GetRequestsTotalByWorkloads(addr string) (promModel.Vector, error) {
-	query := GetRequestsTotalByWorkloadsQuery()
-	return executeQuery(addr, query)
-}
-
-// GetRequestsTotalByWorkloadsQuery returns request totals by workloads query
-func GetRequestsTotalByWorkloadsQuery() string {
-	return fmt.Sprintf(workloadsQueryTemplate, "60s")
+// GetRequestsTotalByWorkloadsQuery returns request totals by workloads query.
+// HTTP and gRPC edges are measured by requests per second, TCP edges by
+// opened connections per second.
+func GetRequestsTotalByWorkloadsQuery(
+	p Profile,
+	window time.Duration,
+	filters source.Filters,
+) string {
+	matchers := []Matcher{reporterMatcher(p)}
+	matchers = append(matchers, filterMatchers(filters)...)
+	return Or(
+		Sum(rateOf(p, p.RequestsTotal, matchers, window)).
+			GroupBy(p.edgeLabels()...),
+		tcpRateExpr(
+			p,
+			[]string{p.TCPConnectionsOpened},
+			matchers,
+			window,
+			p.edgeLabels(),
+		),
+	).String()
 }
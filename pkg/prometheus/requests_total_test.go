@@ -1,8 +1,10 @@
 package prometheus
 
 import (
+	"context"
 	"testing"
 
+	"github.com/hekike/outlier-istio/pkg/source"
 	"github.com/hekike/outlier-istio/test/fixtures"
 	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/assert"
@@ -10,11 +12,15 @@ import (
 
 func TestGetRequestsTotalByWorkloads(t *testing.T) {
 	mockServer := fixtures.PrometheusResponseStub(t, map[string]string{
-		GetRequestsTotalByWorkloadsQuery(): "../../test/mock/prom_workload_request_totals.json",
+		GetRequestsTotalByWorkloadsQuery(IstioMixer, DefaultRateWindow, source.DefaultFilters): "../../test/mock/prom_workload_request_totals.json",
 	})
 	defer mockServer.Close()
 
-	result, err := GetRequestsTotalByWorkloads(mockServer.URL)
+	s, err := NewSource(mockServer.URL, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := s.Topology(context.Background(), source.RequestRate)
 	if err != nil {
 		t.Error(err)
 	}
@@ -22,36 +28,55 @@ func TestGetRequestsTotalByWorkloads(t *testing.T) {
 	expected := model.Vector{
 		&model.Sample{
 			Metric: model.Metric{
-				"destination_app":      "reviews",
-				"destination_workload": "reviews-v3",
-				"request_protocol":     "http",
-				"source_app":           "productpage",
-				"source_workload":      "productpage-v1",
+				"destination_app":                "reviews",
+				"destination_workload":           "reviews-v3",
+				"destination_workload_namespace": "default",
+				"request_protocol":               "http",
+				"source_app":                     "productpage",
+				"source_workload":                "productpage-v1",
+				"source_workload_namespace":      "default",
+			},
+			Timestamp: 1539917345608,
+			Value:     1.2,
+		},
+		&model.Sample{
+			Metric: model.Metric{
+				"destination_app":                "productpage",
+				"destination_workload":           "productpage-v1",
+				"destination_workload_namespace": "default",
+				"request_protocol":               "http",
+				"source_app":                     "unknown",
+				"source_workload":                "unknown",
+				"source_workload_namespace":      "unknown",
 			},
 			Timestamp: 1539917345608,
-			Value:     0,
+			Value:     2.5,
 		},
 		&model.Sample{
 			Metric: model.Metric{
-				"destination_app":      "productpage",
-				"destination_workload": "productpage-v1",
-				"request_protocol":     "http",
-				"source_app":           "unknown",
-				"source_workload":      "unknown",
+				"destination_app":                "ratings",
+				"destination_workload":           "ratings-v1",
+				"destination_workload_namespace": "default",
+				"request_protocol":               "http",
+				"source_app":                     "reviews",
+				"source_workload":                "reviews-v3",
+				"source_workload_namespace":      "default",
 			},
 			Timestamp: 1539917345608,
-			Value:     0,
+			Value:     1.1,
 		},
 		&model.Sample{
 			Metric: model.Metric{
-				"destination_app":      "ratings",
-				"destination_workload": "ratings-v1",
-				"request_protocol":     "http",
-				"source_app":           "reviews",
-				"source_workload":      "reviews-v3",
+				"destination_app":                "mongodb",
+				"destination_workload":           "mongodb-v1",
+				"destination_workload_namespace": "default",
+				"request_protocol":               "tcp",
+				"source_app":                     "ratings",
+				"source_workload":                "ratings-v1",
+				"source_workload_namespace":      "default",
 			},
 			Timestamp: 1539917345608,
-			Value:     0,
+			Value:     0.3,
 		},
 	}
 	assert.Equal(t, expected, result)
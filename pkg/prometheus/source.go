@@ -0,0 +1,236 @@
+package prometheus
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/hekike/outlier-istio/pkg/source"
+	promApi "github.com/prometheus/client_golang/api"
+	promApiV1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	promModel "github.com/prometheus/common/model"
+)
+
+// DefaultOptions are used for zero option values.
+var DefaultOptions = Options{
+	Timeout:             30 * time.Second,
+	MaxIdleConnsPerHost: 32,
+	MaxPoints:           5000,
+	MaxPointsPerQuery:   1000,
+	MinSamplesPerWindow: 4,
+}
+
+// Options configures the Prometheus client.
+type Options struct {
+	// Timeout of a single query
+	Timeout time.Duration
+	// Idle connections kept open to Prometheus
+	MaxIdleConnsPerHost int
+	// Authentication, at most one of them can be set
+	BearerToken     string
+	BearerTokenFile string
+	BasicAuth       *BasicAuth
+	// Headers added to every request
+	Headers map[string]string
+	TLS     TLSOptions
+	// Metric schema, IstioMixer when nil
+	Profile *Profile
+	// Series selected for the analysis, the filters of the profile when nil
+	Filters *source.Filters
+	// Points per series of a range, the step is increased above it
+	MaxPoints int
+	// Points per series of a single range query, longer ranges are split
+	// into multiple queries
+	MaxPointsPerQuery int
+	// Window of rate(), raised to MinSamplesPerWindow scrapes
+	RateWindow time.Duration
+	// Scrape interval of the Istio metrics, DefaultRateWindow is used when
+	// neither the window nor the interval is set
+	ScrapeInterval time.Duration
+	// Samples required in a rate window
+	MinSamplesPerWindow int
+}
+
+// Source is a MetricsSource backed by the Prometheus HTTP API.
+// It is safe to use from multiple goroutines.
+type Source struct {
+	api     promApiV1.API
+	timeout time.Duration
+	profile Profile
+	filters source.Filters
+	// Rate window of the topology and of the short ranges
+	rateWindow time.Duration
+
+	maxPoints         int
+	maxPointsPerQuery int
+}
+
+// NewSource creates a source for the Prometheus at the given address.
+func NewSource(addr string, options Options) (*Source, error) {
+	return newSource(addr, options, nil)
+}
+
+func newSource(
+	addr string,
+	options Options,
+	wrap func(http.RoundTripper) http.RoundTripper,
+) (*Source, error) {
+	options, profile, filters, err := withDefaults(options)
+	if err != nil {
+		return nil, err
+	}
+	roundTripper, err := newRoundTripper(options)
+	if err != nil {
+		return nil, err
+	}
+	if wrap != nil {
+		roundTripper = wrap(roundTripper)
+	}
+
+	client, err := promApi.NewClient(promApi.Config{
+		Address:      addr,
+		RoundTripper: roundTripper,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rateWindow, err := baseRateWindow(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Source{
+		api:     promApiV1.NewAPI(client),
+		timeout: options.Timeout,
+		profile: profile,
+		filters: filters,
+
+		rateWindow:        rateWindow,
+		maxPoints:         options.MaxPoints,
+		maxPointsPerQuery: options.MaxPointsPerQuery,
+	}, nil
+}
+
+// Fills the zero options with DefaultOptions, returns the profile and the
+// validated filters of the options
+func withDefaults(options Options) (Options, Profile, source.Filters, error) {
+	if options.Timeout == 0 {
+		options.Timeout = DefaultOptions.Timeout
+	}
+	if options.MaxIdleConnsPerHost == 0 {
+		options.MaxIdleConnsPerHost = DefaultOptions.MaxIdleConnsPerHost
+	}
+	if options.MaxPoints == 0 {
+		options.MaxPoints = DefaultOptions.MaxPoints
+	}
+	if options.MaxPointsPerQuery == 0 {
+		options.MaxPointsPerQuery = DefaultOptions.MaxPointsPerQuery
+	}
+	if options.MinSamplesPerWindow == 0 {
+		options.MinSamplesPerWindow = DefaultOptions.MinSamplesPerWindow
+	}
+	profile := IstioMixer
+	if options.Profile != nil {
+		profile = *options.Profile
+	}
+	filters := profile.Filters
+	if options.Filters != nil {
+		filters = *options.Filters
+	}
+	if err := filters.Validate(); err != nil {
+		return options, profile, filters, err
+	}
+	return options, profile, filters, nil
+}
+
+// Topology returns the signal by source and destination workloads.
+func (s *Source) Topology(
+	ctx context.Context,
+	signal source.Signal,
+) (promModel.Vector, error) {
+	var query string
+	switch signal {
+	case source.GRPCErrorRate:
+		query = GetGRPCErrorRatesByWorkloadsQuery(
+			s.profile,
+			s.rateWindow,
+			s.filters,
+		)
+	default:
+		query = GetRequestsTotalByWorkloadsQuery(
+			s.profile,
+			s.rateWindow,
+			s.filters,
+		)
+	}
+	return s.executeQuery(ctx, query)
+}
+
+// Edges returns the signal of downstream or upstream workloads.
+func (s *Source) Edges(
+	ctx context.Context,
+	q source.Query,
+) (promModel.Matrix, error) {
+	q.RateWindow = s.RateWindow(q.Start, q.End)
+
+	var query string
+	switch {
+	case q.Signal == source.ErrorRate && q.Direction == source.Downstream:
+		query = GetDownstreamErrorRatesQuery(s.profile, q, s.filters)
+	case q.Signal == source.ErrorRate:
+		query = GetUpstreamErrorRatesQuery(s.profile, q, s.filters)
+	case q.Signal == source.RequestRate && q.Direction == source.Downstream:
+		query = GetDownstreamRequestRatesQuery(s.profile, q, s.filters)
+	case q.Signal == source.RequestRate:
+		query = GetUpstreamRequestRatesQuery(s.profile, q, s.filters)
+	case q.Signal == source.ConnectionChurn &&
+		q.Direction == source.Downstream:
+		query = GetDownstreamConnectionChurnQuery(s.profile, q, s.filters)
+	case q.Signal == source.ConnectionChurn:
+		query = GetUpstreamConnectionChurnQuery(s.profile, q, s.filters)
+	case q.Signal == source.Throughput && q.Direction == source.Downstream:
+		query = GetDownstreamThroughputQuery(s.profile, q, s.filters)
+	case q.Signal == source.Throughput:
+		query = GetUpstreamThroughputQuery(s.profile, q, s.filters)
+	case q.Signal == source.GRPCErrorRate &&
+		q.Direction == source.Downstream:
+		query = GetDownstreamGRPCErrorRatesQuery(s.profile, q, s.filters)
+	case q.Signal == source.GRPCErrorRate:
+		query = GetUpstreamGRPCErrorRatesQuery(s.profile, q, s.filters)
+	case q.Signal == source.ReporterGap && q.Direction == source.Downstream:
+		query = GetDownstreamReporterGapQuery(s.profile, q, s.filters)
+	case q.Signal == source.ReporterGap:
+		query = GetUpstreamReporterGapQuery(s.profile, q, s.filters)
+	case q.Direction == source.Downstream:
+		query = GetDownstreamRequestDurationsQuery(s.profile, q, s.filters)
+	default:
+		query = GetUpstreamRequestDurationsQuery(s.profile, q, s.filters)
+	}
+	return s.executeQueryRange(ctx, q.Start, q.End, query)
+}
+
+// Statuses returns the signal of the given workload.
+func (s *Source) Statuses(
+	ctx context.Context,
+	q source.Query,
+) (promModel.Matrix, error) {
+	q.RateWindow = s.RateWindow(q.Start, q.End)
+
+	var query string
+	switch q.Signal {
+	case source.ErrorRate:
+		query = GetErrorRatesQuery(s.profile, q, s.filters)
+	case source.RequestRate:
+		query = GetRequestRatesQuery(s.profile, q, s.filters)
+	case source.ConnectionChurn:
+		query = GetConnectionChurnQuery(s.profile, q, s.filters)
+	case source.Throughput:
+		query = GetThroughputQuery(s.profile, q, s.filters)
+	case source.GRPCErrorRate:
+		query = GetGRPCErrorRatesQuery(s.profile, q, s.filters)
+	default:
+		query = GetStatusesQuery(s.profile, q, s.filters)
+	}
+	return s.executeQueryRange(ctx, q.Start, q.End, query)
+}
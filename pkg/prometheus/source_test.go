@@ -0,0 +1,67 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hekike/outlier-istio/pkg/source"
+	"github.com/stretchr/testify/assert"
+)
+
+// Prometheus that never responds
+func blockingServer() (*httptest.Server, chan struct{}) {
+	aborted := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(
+		w http.ResponseWriter,
+		r *http.Request,
+	) {
+		// Read the query like Prometheus does so the server notices
+		// when the client goes away
+		r.ParseForm()
+		<-r.Context().Done()
+		aborted <- struct{}{}
+	}))
+	return server, aborted
+}
+
+func TestSourceCancel(t *testing.T) {
+	server, aborted := blockingServer()
+	defer server.Close()
+
+	s, err := NewSource(server.URL, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	_, err = s.Topology(ctx, source.RequestRate)
+	assert.True(t, errors.Is(err, context.Canceled), err)
+
+	select {
+	case <-aborted:
+	case <-time.After(time.Second):
+		t.Error("in-flight query was not aborted")
+	}
+}
+
+func TestSourceTimeout(t *testing.T) {
+	server, _ := blockingServer()
+	defer server.Close()
+
+	s, err := NewSource(server.URL, Options{Timeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Topology(context.Background(), source.RequestRate)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), err)
+	var timeoutErr *source.TimeoutError
+	assert.True(t, errors.As(err, &timeoutErr), err)
+	assert.Equal(t, 50*time.Millisecond, timeoutErr.Timeout)
+}
@@ -0,0 +1,88 @@
+package prometheus
+
+import (
+	"time"
+
+	promApiV1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	promModel "github.com/prometheus/common/model"
+)
+
+// QueryStep returns the step of the range queries between start and end.
+func (s *Source) QueryStep(start time.Time, end time.Time) time.Duration {
+	return queryStep(start, end, s.maxPoints)
+}
+
+// QueryStep returns the step of the range queries between start and end.
+func (s *RemoteReadSource) QueryStep(
+	start time.Time,
+	end time.Time,
+) time.Duration {
+	return queryStep(start, end, s.maxPoints)
+}
+
+// Returns the step of a range query, the resolution step or the multiple of
+// it that keeps the range within maxPoints points per series
+func queryStep(start time.Time, end time.Time, maxPoints int) time.Duration {
+	step := resolutionStep
+	if maxPoints <= 0 {
+		return step
+	}
+	minStep := end.Sub(start) / time.Duration(maxPoints)
+	if minStep > step {
+		// Round up to the resolution step
+		step = (minStep + resolutionStep - 1) / resolutionStep * resolutionStep
+	}
+	return step
+}
+
+// Splits the range into consecutive ranges of at most maxPointsPerQuery
+// points. The ranges evaluate the same timestamps as the whole range.
+func splitRange(
+	start time.Time,
+	end time.Time,
+	step time.Duration,
+	maxPointsPerQuery int,
+) []promApiV1.Range {
+	if maxPointsPerQuery <= 0 {
+		return []promApiV1.Range{{Start: start, End: end, Step: step}}
+	}
+
+	chunk := time.Duration(maxPointsPerQuery) * step
+	ranges := []promApiV1.Range{}
+	for chunkStart := start; !chunkStart.After(end); chunkStart = chunkStart.Add(chunk) {
+		chunkEnd := chunkStart.Add(chunk - step)
+		if chunkEnd.After(end) {
+			chunkEnd = end
+		}
+		ranges = append(ranges, promApiV1.Range{
+			Start: chunkStart,
+			End:   chunkEnd,
+			Step:  step,
+		})
+	}
+	return ranges
+}
+
+// Stitches the series of the chunk results together, the matrices are
+// ordered by time
+func mergeMatrices(matrices []promModel.Matrix) promModel.Matrix {
+	if len(matrices) == 1 {
+		return matrices[0]
+	}
+
+	merged := promModel.Matrix{}
+	streams := make(map[promModel.Fingerprint]*promModel.SampleStream)
+	for _, matrix := range matrices {
+		for _, stream := range matrix {
+			fingerprint := stream.Metric.Fingerprint()
+			mergedStream, found := streams[fingerprint]
+			if !found {
+				mergedStream = &promModel.SampleStream{Metric: stream.Metric}
+				streams[fingerprint] = mergedStream
+				merged = append(merged, mergedStream)
+			}
+			mergedStream.Values = append(mergedStream.Values, stream.Values...)
+		}
+	}
+	return merged
+}
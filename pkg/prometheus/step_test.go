@@ -0,0 +1,157 @@
+package prometheus
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hekike/outlier-istio/pkg/source"
+	promApiV1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	promModel "github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryStep(t *testing.T) {
+	start := time.Date(2018, 10, 27, 14, 0, 0, 0, time.UTC)
+
+	// One hour with 15 minutes historical data fits
+	assert.Equal(
+		t,
+		5*time.Second,
+		queryStep(start, start.Add(75*time.Minute), 5000),
+	)
+	// One day with 15 minutes historical data, rounded up to 5s
+	assert.Equal(
+		t,
+		20*time.Second,
+		queryStep(start, start.Add(24*time.Hour+15*time.Minute), 5000),
+	)
+	assert.Equal(
+		t,
+		5*time.Second,
+		queryStep(start, start.Add(24*time.Hour), 0),
+	)
+}
+
+func TestSplitRange(t *testing.T) {
+	start := time.Date(2018, 10, 27, 14, 0, 0, 0, time.UTC)
+	step := 5 * time.Second
+
+	assert.Equal(t, []promApiV1.Range{
+		{Start: start, End: start.Add(45 * time.Second), Step: step},
+		{
+			Start: start.Add(50 * time.Second),
+			End:   start.Add(95 * time.Second),
+			Step:  step,
+		},
+		{
+			Start: start.Add(100 * time.Second),
+			End:   start.Add(102 * time.Second),
+			Step:  step,
+		},
+	}, splitRange(start, start.Add(102*time.Second), step, 10))
+
+	assert.Equal(t, []promApiV1.Range{
+		{Start: start, End: start.Add(time.Hour), Step: step},
+	}, splitRange(start, start.Add(time.Hour), step, 0))
+}
+
+func TestMergeMatrices(t *testing.T) {
+	reviews := promModel.Metric{"destination_workload": "reviews-v3"}
+	ratings := promModel.Metric{"destination_workload": "ratings-v1"}
+
+	merged := mergeMatrices([]promModel.Matrix{
+		{
+			{Metric: reviews, Values: []promModel.SamplePair{{Timestamp: 1, Value: 1}}},
+		},
+		{
+			{Metric: ratings, Values: []promModel.SamplePair{{Timestamp: 2, Value: 3}}},
+			{Metric: reviews, Values: []promModel.SamplePair{{Timestamp: 2, Value: 2}}},
+		},
+	})
+
+	assert.Equal(t, promModel.Matrix{
+		{
+			Metric: reviews,
+			Values: []promModel.SamplePair{
+				{Timestamp: 1, Value: 1},
+				{Timestamp: 2, Value: 2},
+			},
+		},
+		{
+			Metric: ratings,
+			Values: []promModel.SamplePair{{Timestamp: 2, Value: 3}},
+		},
+	}, merged)
+}
+
+// Prometheus responding with a single series, one sample per step
+func rangeServer(t *testing.T, calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(
+		w http.ResponseWriter,
+		r *http.Request,
+	) {
+		atomic.AddInt32(calls, 1)
+		start, _ := strconv.ParseFloat(r.FormValue("start"), 64)
+		end, _ := strconv.ParseFloat(r.FormValue("end"), 64)
+		step, _ := strconv.ParseFloat(r.FormValue("step"), 64)
+
+		values := [][]interface{}{}
+		for ts := start; ts <= end; ts += step {
+			values = append(values, []interface{}{ts, "1"})
+		}
+		err := json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "success",
+			"data": map[string]interface{}{
+				"resultType": "matrix",
+				"result": []interface{}{
+					map[string]interface{}{
+						"metric": map[string]string{
+							"destination_workload": "reviews-v3",
+						},
+						"values": values,
+					},
+				},
+			},
+		})
+		if err != nil {
+			t.Error(err)
+		}
+	}))
+}
+
+func TestSourceChunkedRange(t *testing.T) {
+	var calls int32
+	server := rangeServer(t, &calls)
+	defer server.Close()
+
+	s, err := NewSource(server.URL, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	end := time.Date(2018, 10, 27, 15, 0, 0, 0, time.UTC)
+	matrix, err := s.Statuses(context.Background(), source.Query{
+		Workload: "reviews-v3",
+		Start:    end.Add(-24*time.Hour - 15*time.Minute),
+		End:      end,
+	})
+	assert.NoError(t, err)
+
+	// 20s step: 4366 points in 5 queries of at most 1000 points
+	assert.Equal(t, int32(5), atomic.LoadInt32(&calls))
+	assert.Len(t, matrix, 1)
+	assert.Len(t, matrix[0].Values, 4366)
+	for i := 1; i < len(matrix[0].Values); i++ {
+		assert.Equal(
+			t,
+			20*time.Second,
+			matrix[0].Values[i].Timestamp.Sub(matrix[0].Values[i-1].Timestamp),
+		)
+	}
+}
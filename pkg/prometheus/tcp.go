@@ -0,0 +1,162 @@
+package prometheus
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hekike/outlier-istio/pkg/source"
+)
+
+// Opened and closed connections
+func connectionMetrics(p Profile) []string {
+	return []string{p.TCPConnectionsOpened, p.TCPConnectionsClosed}
+}
+
+// Sent and received bytes
+func throughputMetrics(p Profile) []string {
+	return []string{p.TCPSentBytes, p.TCPReceivedBytes}
+}
+
+// GetDownstreamConnectionChurnQuery returns the opened and closed TCP
+// connections per second query of the workloads called from the given
+// workload.
+func GetDownstreamConnectionChurnQuery(
+	p Profile,
+	q source.Query,
+	filters source.Filters,
+) string {
+	return tcpRateQuery(p, connectionMetrics(p), "source", q, filters, p.edgeLabels())
+}
+
+// GetUpstreamConnectionChurnQuery returns the opened and closed TCP
+// connections per second query of the connections made to the given
+// workload by its sources.
+func GetUpstreamConnectionChurnQuery(
+	p Profile,
+	q source.Query,
+	filters source.Filters,
+) string {
+	return tcpRateQuery(
+		p,
+		connectionMetrics(p),
+		"destination",
+		q,
+		filters,
+		p.edgeLabels(),
+	)
+}
+
+// GetConnectionChurnQuery returns the opened and closed TCP connections per
+// second query of the given workload.
+func GetConnectionChurnQuery(
+	p Profile,
+	q source.Query,
+	filters source.Filters,
+) string {
+	return tcpRateQuery(
+		p,
+		connectionMetrics(p),
+		"destination",
+		q,
+		filters,
+		p.statusLabels(),
+	)
+}
+
+// GetDownstreamThroughputQuery returns the sent and received TCP bytes per
+// second query of the workloads called from the given workload.
+func GetDownstreamThroughputQuery(
+	p Profile,
+	q source.Query,
+	filters source.Filters,
+) string {
+	return tcpRateQuery(p, throughputMetrics(p), "source", q, filters, p.edgeLabels())
+}
+
+// GetUpstreamThroughputQuery returns the sent and received TCP bytes per
+// second query of the connections made to the given workload by its sources.
+func GetUpstreamThroughputQuery(
+	p Profile,
+	q source.Query,
+	filters source.Filters,
+) string {
+	return tcpRateQuery(
+		p,
+		throughputMetrics(p),
+		"destination",
+		q,
+		filters,
+		p.edgeLabels(),
+	)
+}
+
+// GetThroughputQuery returns the sent and received TCP bytes per second
+// query of the given workload.
+func GetThroughputQuery(
+	p Profile,
+	q source.Query,
+	filters source.Filters,
+) string {
+	return tcpRateQuery(
+		p,
+		throughputMetrics(p),
+		"destination",
+		q,
+		filters,
+		p.statusLabels(),
+	)
+}
+
+// Per second rate of the matching TCP metrics, request_protocol is set
+// to "tcp" as older Istio versions don't label TCP metrics with it
+func tcpRateQuery(
+	p Profile,
+	metrics []string,
+	sourceType string,
+	q source.Query,
+	filters source.Filters,
+	labels []string,
+) string {
+	return tcpRateExpr(
+		p,
+		metrics,
+		requestMatchers(p, sourceType, q, filters),
+		q.RateWindow,
+		labels,
+	).String()
+}
+
+func tcpRateExpr(
+	p Profile,
+	metrics []string,
+	matchers []Matcher,
+	window time.Duration,
+	labels []string,
+) Expr {
+	if window == 0 {
+		window = DefaultRateWindow
+	}
+	recorded := p.useRecorded(metrics[0], matchers, window)
+
+	names := make([]string, len(metrics))
+	for i, metric := range metrics {
+		if recorded {
+			metric = recordedMetric(metric, window)
+		}
+		names[i] = regexp.QuoteMeta(metric)
+	}
+	selector := Select("", withMatchers(
+		[]Matcher{Regexp("__name__", strings.Join(names, "|"))},
+		matchers...,
+	)...)
+
+	var rate Expr = Rate(selector.Over(window))
+	if recorded {
+		rate = selector
+	}
+	return LabelReplace(
+		Sum(rate).GroupBy(labels...),
+		"request_protocol", "tcp", "", "",
+	)
+}
@@ -0,0 +1,62 @@
+package prometheus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hekike/outlier-istio/pkg/source"
+	"github.com/hekike/outlier-istio/test/fixtures"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSourceEdgesConnectionChurn(t *testing.T) {
+	query := source.Query{
+		Namespace: "default",
+		Workload:  "ratings-v1",
+		Direction: source.Downstream,
+		Signal:    source.ConnectionChurn,
+		Start:     time.Unix(1540678767, 0),
+		End:       time.Unix(1540683267, 0),
+	}
+
+	mockServer := fixtures.PrometheusResponseStub(t, map[string]string{
+		GetDownstreamConnectionChurnQuery(IstioMixer, query, source.DefaultFilters): "../../test/mock/prom_workload_source_tcp_connections.json",
+	})
+	defer mockServer.Close()
+
+	s, err := NewSource(mockServer.URL, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matrix, err := s.Edges(context.Background(), query)
+	assert.NoError(t, err)
+	assert.Len(t, matrix, 1)
+	assert.Equal(t, "tcp", string(matrix[0].Metric["request_protocol"]))
+	assert.Equal(
+		t,
+		"mongodb-v1",
+		string(matrix[0].Metric["destination_workload"]),
+	)
+}
+
+func TestTCPQueries(t *testing.T) {
+	query := source.Query{Namespace: "default", Workload: "ratings-v1"}
+
+	connections := GetConnectionChurnQuery(IstioMixer, query, source.DefaultFilters)
+	assert.Contains(
+		t,
+		connections,
+		`__name__ =~ "istio_tcp_connections_opened_total|istio_tcp_connections_closed_total"`,
+	)
+	assert.Contains(t, connections, `"request_protocol", "tcp", "", ""`)
+
+	throughput := GetDownstreamThroughputQuery(IstioMixer, query, source.DefaultFilters)
+	assert.Contains(
+		t,
+		throughput,
+		`__name__ =~ "istio_tcp_sent_bytes_total|istio_tcp_received_bytes_total"`,
+	)
+	assert.Contains(t, throughput, `source_workload = "ratings-v1"`)
+}
@@ -0,0 +1,49 @@
+package prometheus
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// ThanosOptions are the Thanos specific query parameters.
+type ThanosOptions struct {
+	// Deduplicate series of replicated Prometheus instances
+	Dedup bool
+	// Accept results when some of the store APIs are unavailable
+	PartialResponse bool
+}
+
+// NewThanosSource creates a source for the Thanos Querier at the given
+// address. Thanos implements the Prometheus HTTP API, so queries are the same.
+func NewThanosSource(
+	addr string,
+	options Options,
+	thanosOptions ThanosOptions,
+) (*Source, error) {
+	return newSource(addr, options, func(
+		next http.RoundTripper,
+	) http.RoundTripper {
+		return &thanosRoundTripper{
+			options: thanosOptions,
+			next:    next,
+		}
+	})
+}
+
+// thanosRoundTripper adds the Thanos query parameters to every request.
+type thanosRoundTripper struct {
+	options ThanosOptions
+	next    http.RoundTripper
+}
+
+func (rt *thanosRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the original request
+	req = req.Clone(req.Context())
+
+	query := req.URL.Query()
+	query.Set("dedup", strconv.FormatBool(rt.options.Dedup))
+	query.Set("partial_response", strconv.FormatBool(rt.options.PartialResponse))
+	req.URL.RawQuery = query.Encode()
+
+	return rt.next.RoundTrip(req)
+}
@@ -0,0 +1,47 @@
+package prometheus
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hekike/outlier-istio/pkg/source"
+	"github.com/hekike/outlier-istio/test/fixtures"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThanosSource(t *testing.T) {
+	mockServer := fixtures.PrometheusResponseStub(t, map[string]string{
+		GetRequestsTotalByWorkloadsQuery(IstioMixer, DefaultRateWindow, source.DefaultFilters): "../../test/mock/prom_workload_request_totals.json",
+	})
+	defer mockServer.Close()
+
+	var dedup, partialResponse string
+	proxy := httptest.NewServer(http.HandlerFunc(func(
+		w http.ResponseWriter,
+		r *http.Request,
+	) {
+		dedup = r.URL.Query().Get("dedup")
+		partialResponse = r.URL.Query().Get("partial_response")
+		mockServer.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+
+	s, err := NewThanosSource(
+		proxy.URL,
+		Options{},
+		ThanosOptions{Dedup: true},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := s.Topology(context.Background(), source.RequestRate)
+	if err != nil {
+		t.Error(err)
+	}
+
+	assert.Equal(t, "true", dedup)
+	assert.Equal(t, "false", partialResponse)
+	assert.Len(t, result, 4)
+}
@@ -0,0 +1,178 @@
+package prometheus
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// BasicAuth credentials.
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+// TLSOptions configures the TLS connection to Prometheus.
+type TLSOptions struct {
+	// PEM encoded CA bundle to verify the server with
+	CAFile string
+	// PEM encoded client certificate and key for mutual TLS
+	CertFile string
+	KeyFile  string
+	// Overrides the server name used to verify the certificate
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// Returns the round tripper of the options: the transport with the
+// authentication
+func newRoundTripper(options Options) (http.RoundTripper, error) {
+	transport, err := newTransport(options)
+	if err != nil {
+		return nil, err
+	}
+	return newAuthRoundTripper(options, transport)
+}
+
+// Pooled transport shared by all queries of the source
+func newTransport(options Options) (*http.Transport, error) {
+	tlsConfig, err := newTLSConfig(options.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConns:        options.MaxIdleConnsPerHost,
+		MaxIdleConnsPerHost: options.MaxIdleConnsPerHost,
+		IdleConnTimeout:     90 * time.Second,
+	}, nil
+}
+
+func newTLSConfig(options TLSOptions) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         options.ServerName,
+		InsecureSkipVerify: options.InsecureSkipVerify,
+	}
+
+	if options.CAFile != "" {
+		caPEM, err := ioutil.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA file: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf(
+				"no certificates found in CA file: %s",
+				options.CAFile,
+			)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if options.CertFile != "" || options.KeyFile != "" {
+		if options.CertFile == "" || options.KeyFile == "" {
+			return nil, fmt.Errorf(
+				"client certificate and key must be set together",
+			)
+		}
+		// Check the files early, they are loaded on every handshake
+		// to pick up rotated certificates
+		_, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %s", err)
+		}
+		tlsConfig.GetClientCertificate = func(
+			*tls.CertificateRequestInfo,
+		) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+			if err != nil {
+				return nil, err
+			}
+			return &cert, nil
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// authRoundTripper sets the authentication and custom headers.
+type authRoundTripper struct {
+	bearerToken     string
+	bearerTokenFile string
+	basicAuth       *BasicAuth
+	headers         map[string]string
+	next            http.RoundTripper
+}
+
+func newAuthRoundTripper(
+	options Options,
+	next http.RoundTripper,
+) (http.RoundTripper, error) {
+	authMethods := 0
+	if options.BearerToken != "" {
+		authMethods++
+	}
+	if options.BearerTokenFile != "" {
+		authMethods++
+	}
+	if options.BasicAuth != nil {
+		authMethods++
+	}
+	if authMethods > 1 {
+		return nil, fmt.Errorf(
+			"only one of bearer token, bearer token file and basic auth can be set",
+		)
+	}
+
+	if authMethods == 0 && len(options.Headers) == 0 {
+		return next, nil
+	}
+
+	return &authRoundTripper{
+		bearerToken:     options.BearerToken,
+		bearerTokenFile: options.BearerTokenFile,
+		basicAuth:       options.BasicAuth,
+		headers:         options.Headers,
+		next:            next,
+	}, nil
+}
+
+func (rt *authRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the original request
+	req = req.Clone(req.Context())
+
+	for key, value := range rt.headers {
+		req.Header.Set(key, value)
+	}
+
+	switch {
+	case rt.bearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+rt.bearerToken)
+	case rt.bearerTokenFile != "":
+		// Read on every request, projected tokens are rotated on disk
+		token, err := ioutil.ReadFile(rt.bearerTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read bearer token file: %s", err)
+		}
+		req.Header.Set(
+			"Authorization",
+			"Bearer "+strings.TrimSpace(string(token)),
+		)
+	case rt.basicAuth != nil:
+		req.SetBasicAuth(rt.basicAuth.Username, rt.basicAuth.Password)
+	}
+
+	return rt.next.RoundTrip(req)
+}
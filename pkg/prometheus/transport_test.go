@@ -0,0 +1,216 @@
+package prometheus
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hekike/outlier-istio/pkg/source"
+	"github.com/stretchr/testify/assert"
+)
+
+// Writes a CA and a client certificate signed by it to dir
+func writeClientCertificates(t *testing.T, dir string) (
+	caPool *x509.CertPool,
+	certFile string,
+	keyFile string,
+) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(
+		rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPool = x509.NewCertPool()
+	caPool.AddCert(caCert)
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "outlier-istio"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	clientDER, err := x509.CreateCertificate(
+		rand.Reader, clientTemplate, caCert, &clientKey.PublicKey, caKey,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientKeyDER, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, "client.crt")
+	keyFile = filepath.Join(dir, "client.key")
+	writePEM(t, certFile, "CERTIFICATE", clientDER)
+	writePEM(t, keyFile, "EC PRIVATE KEY", clientKeyDER)
+
+	return caPool, certFile, keyFile
+}
+
+func writePEM(t *testing.T, file string, blockType string, bytes []byte) {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: bytes})
+	if err := ioutil.WriteFile(file, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSourceTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outlier-istio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	clientCAs, certFile, keyFile := writeClientCertificates(t, dir)
+
+	var authorization, tenant string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(
+		w http.ResponseWriter,
+		r *http.Request,
+	) {
+		authorization = r.Header.Get("Authorization")
+		tenant = r.Header.Get("X-Scope-OrgID")
+		json, err := ioutil.ReadFile(
+			"../../test/mock/prom_workload_request_totals.json",
+		)
+		if err != nil {
+			t.Error(err)
+		}
+		w.Write(json)
+	}))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	// CA bundle of the server
+	caFile := filepath.Join(dir, "ca.crt")
+	writePEM(t, caFile, "CERTIFICATE", server.Certificate().Raw)
+
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("token-1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewSource(server.URL, Options{
+		BearerTokenFile: tokenFile,
+		Headers:         map[string]string{"X-Scope-OrgID": "mesh"},
+		TLS: TLSOptions{
+			CAFile:   caFile,
+			CertFile: certFile,
+			KeyFile:  keyFile,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := s.Topology(context.Background(), source.RequestRate)
+	assert.NoError(t, err)
+	assert.Len(t, result, 4)
+	assert.Equal(t, "Bearer token-1", authorization)
+	assert.Equal(t, "mesh", tenant)
+
+	// Token is reloaded from disk
+	if err := ioutil.WriteFile(tokenFile, []byte("token-2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Topology(context.Background(), source.RequestRate)
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer token-2", authorization)
+
+	// Without client certificate
+	s, err = NewSource(server.URL, Options{
+		TLS: TLSOptions{CAFile: caFile},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Topology(context.Background(), source.RequestRate)
+	assert.Error(t, err)
+}
+
+func TestSourceBasicAuth(t *testing.T) {
+	var username, password string
+	server := httptest.NewServer(http.HandlerFunc(func(
+		w http.ResponseWriter,
+		r *http.Request,
+	) {
+		username, password, _ = r.BasicAuth()
+		w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+	}))
+	defer server.Close()
+
+	s, err := NewSource(server.URL, Options{
+		BasicAuth: &BasicAuth{Username: "admin", Password: "secret"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Topology(context.Background(), source.RequestRate)
+	assert.NoError(t, err)
+	assert.Equal(t, "admin", username)
+	assert.Equal(t, "secret", password)
+}
+
+func TestSourceInvalidAuth(t *testing.T) {
+	_, err := NewSource("http://localhost:9090", Options{
+		BearerToken: "token",
+		BasicAuth:   &BasicAuth{Username: "admin", Password: "secret"},
+	})
+	assert.EqualError(
+		t,
+		err,
+		"only one of bearer token, bearer token file and basic auth can be set",
+	)
+
+	_, err = NewSource("http://localhost:9090", Options{
+		TLS: TLSOptions{CertFile: "client.crt"},
+	})
+	assert.EqualError(
+		t,
+		err,
+		"client certificate and key must be set together",
+	)
+}
@@ -21,12 +21,33 @@ import (
 
 	"github.com/gin-contrib/static"
 	"github.com/gin-gonic/gin"
+	"github.com/hekike/outlier-istio/pkg/cache"
+	"github.com/hekike/outlier-istio/pkg/models"
+	"github.com/hekike/outlier-istio/pkg/source"
 )
 
+// Options configures the API defaults.
+type Options struct {
+	// Detector of the workload statuses when the request doesn't select
+	// one, models.DefaultDetector when empty
+	Detector string
+	// Latency thresholds by workload and edge,
+	// models.DefaultLatencyThreshold when nil
+	LatencyThresholds *models.Thresholds
+}
+
 // Setup router
-func Setup(promAddr string, webDistPath string) *gin.Engine {
+func Setup(
+	metricsSource source.MetricsSource,
+	webDistPath string,
+	options Options,
+) *gin.Engine {
 	router := gin.Default()
 	apiRouter := router.Group("/api/v1")
+	apiRouter.Use(CacheBypass(), CollectWarnings())
+	// Graded statuses with anomaly scores
+	apiV2Router := router.Group("/api/v2")
+	apiV2Router.Use(CacheBypass(), CollectWarnings())
 
 	router.Use(static.Serve("/", static.LocalFile(webDistPath, false)))
 
@@ -34,8 +55,13 @@ func Setup(promAddr string, webDistPath string) *gin.Engine {
 	RegisterRouteGroupPing(router)
 
 	// API routes
-	RegisterRouteGroupWorkload(promAddr, apiRouter)
-	RegisterRouteGroupWorkloadStatus(promAddr, apiRouter)
+	RegisterRouteGroupWorkload(metricsSource, apiRouter)
+	RegisterRouteGroupWorkloadStatus(metricsSource, options, apiRouter)
+	if metricsCache, ok := metricsSource.(*cache.Cache); ok {
+		RegisterRouteGroupCache(metricsCache, apiRouter)
+	}
+	RegisterRouteGroupWorkload(metricsSource, apiV2Router)
+	RegisterRouteGroupWorkloadStatusV2(metricsSource, options, apiV2Router)
 
 	router.Use(func(c *gin.Context) {
 		c.Redirect(http.StatusMovedPermanently, "/")
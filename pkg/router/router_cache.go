@@ -0,0 +1,61 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hekike/outlier-istio/pkg/cache"
+)
+
+// CacheBypass skips the cache of the request on ?cache=false or on the
+// Cache-Control: no-cache header
+func CacheBypass() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bypass := strings.Contains(
+			strings.ToLower(c.GetHeader("Cache-Control")),
+			"no-cache",
+		)
+		if value, found := c.GetQuery("cache"); found {
+			enabled, err := strconv.ParseBool(value)
+			if err == nil && !enabled {
+				bypass = true
+			}
+		}
+		if bypass {
+			c.Request = c.Request.WithContext(
+				cache.WithBypass(c.Request.Context()),
+			)
+		}
+		c.Next()
+	}
+}
+
+// APIResponseCacheStats struct.
+type APIResponseCacheStats struct {
+	cache.Stats
+	Warnings []string `json:"warnings"`
+}
+
+// RegisterRouteGroupCache register route
+func RegisterRouteGroupCache(metricsCache *cache.Cache, r *gin.RouterGroup) {
+	// swagger:route GET /api/v1/cache/stats cache getCacheStats
+	// ---
+	// summary: Returns with the cache statistics
+	// description: Returns with the hit, miss and coalesced request counters.
+	// produces:
+	// 	- application/json
+	// schemes:
+	// 	- http
+	// responses:
+	// 	200:
+	//		type: string
+	//		description: TODO
+	r.GET("/cache/stats", func(c *gin.Context) {
+		c.JSON(http.StatusOK, APIResponseCacheStats{
+			Stats:    metricsCache.Stats(),
+			Warnings: getWarnings(c),
+		})
+	})
+}
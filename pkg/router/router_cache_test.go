@@ -0,0 +1,61 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hekike/outlier-istio/pkg/cache"
+	"github.com/hekike/outlier-istio/pkg/prometheus"
+	"github.com/hekike/outlier-istio/pkg/source"
+	"github.com/hekike/outlier-istio/test/fixtures"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApiGetCacheStats(t *testing.T) {
+	mockServer := fixtures.PrometheusResponseStub(t, map[string]string{
+		prometheus.GetRequestsTotalByWorkloadsQuery(prometheus.IstioMixer, prometheus.DefaultRateWindow, source.DefaultFilters):  "../../test/mock/prom_workload_request_totals.json",
+		prometheus.GetGRPCErrorRatesByWorkloadsQuery(prometheus.IstioMixer, prometheus.DefaultRateWindow, source.DefaultFilters): "../../test/mock/prom_empty_vector.json",
+	})
+	defer mockServer.Close()
+
+	// router
+	metricsSource, err := prometheus.NewSource(
+		mockServer.URL,
+		prometheus.Options{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testRouter := Setup(cache.New(metricsSource, cache.Options{}), "./web-dist", Options{})
+	server := httptest.NewServer(testRouter)
+
+	// call api
+	for _, path := range []string{
+		"/api/v1/workloads",
+		"/api/v1/workloads",
+		"/api/v1/workloads?cache=false",
+	} {
+		res, _ := fixtures.HTTPRequest(t, server.URL+path)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	}
+
+	res, body := fixtures.HTTPRequest(t, server.URL+"/api/v1/cache/stats")
+
+	stats := cache.Stats{}
+	jsonErr := json.Unmarshal(body, &stats)
+	if jsonErr != nil {
+		panic(jsonErr)
+	}
+
+	// Topology of requests and gRPC errors per API call, the bypassed
+	// requests aren't misses
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, cache.Stats{
+		Hits:     2,
+		Misses:   2,
+		Bypassed: 2,
+		Entries:  2,
+	}, stats)
+}
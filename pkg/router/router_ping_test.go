@@ -5,13 +5,14 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/hekike/outlier-istio/pkg/source"
 	"github.com/hekike/outlier-istio/test/fixtures"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestApiGetPing(t *testing.T) {
 	// router
-	testRouter := Setup("http://localhost", "./web-dist")
+	testRouter := Setup(source.NewFake(), "./web-dist", Options{})
 	server := httptest.NewServer(testRouter)
 
 	// test ping
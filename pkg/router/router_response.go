@@ -0,0 +1,74 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/hekike/outlier-istio/pkg/source"
+)
+
+// Key of the warnings collector in the gin context
+const warningsKey = "warnings"
+
+// CollectWarnings collects the warnings of the metrics queries made by the
+// request, they are returned in the warnings field of the response
+func CollectWarnings() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, warnings := source.WithWarnings(c.Request.Context())
+		c.Request = c.Request.WithContext(ctx)
+		c.Set(warningsKey, warnings)
+		c.Next()
+	}
+}
+
+// Returns the warnings of the request, never nil so the field is always an
+// array
+func getWarnings(c *gin.Context) []string {
+	value, found := c.Get(warningsKey)
+	if !found {
+		return []string{}
+	}
+	return value.(*source.Warnings).List()
+}
+
+// Responds with the error and the warnings, the status is derived from the
+// error of the metrics source
+func abortWithError(c *gin.Context, err error) {
+	c.AbortWithStatusJSON(errorStatus(err), gin.H{
+		"error":    err.Error(),
+		"warnings": getWarnings(c),
+	})
+}
+
+// Responds with a validation error and the warnings
+func abortWithBadRequest(c *gin.Context, message string) {
+	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+		"error":    message,
+		"warnings": getWarnings(c),
+	})
+}
+
+// Maps the errors of the metrics source to gateway statuses, the first
+// source error of combined errors decides
+func errorStatus(err error) int {
+	errs := []error{err}
+	var combined *multierror.Error
+	if errors.As(err, &combined) {
+		errs = combined.Errors
+	}
+
+	for _, err := range errs {
+		var timeoutErr *source.TimeoutError
+		var queryErr *source.QueryError
+		var resultTypeErr *source.ResultTypeError
+		switch {
+		case errors.As(err, &timeoutErr):
+			return http.StatusGatewayTimeout
+		case errors.As(err, &queryErr), errors.As(err, &resultTypeErr):
+			return http.StatusBadGateway
+		}
+	}
+	return http.StatusInternalServerError
+}
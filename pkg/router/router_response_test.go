@@ -0,0 +1,124 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/hekike/outlier-istio/pkg/prometheus"
+	"github.com/hekike/outlier-istio/pkg/source"
+	"github.com/hekike/outlier-istio/test/fixtures"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorStatus(t *testing.T) {
+	timeoutErr := &source.TimeoutError{}
+	queryErr := &source.QueryError{Type: "bad_data"}
+
+	assert.Equal(t, http.StatusGatewayTimeout, errorStatus(timeoutErr))
+	assert.Equal(
+		t,
+		http.StatusBadGateway,
+		errorStatus(fmt.Errorf("edges: %w", queryErr)),
+	)
+	assert.Equal(
+		t,
+		http.StatusBadGateway,
+		errorStatus(&source.ResultTypeError{}),
+	)
+	assert.Equal(
+		t,
+		http.StatusGatewayTimeout,
+		errorStatus(multierror.Append(errors.New("failed"), timeoutErr)),
+	)
+	assert.Equal(
+		t,
+		http.StatusInternalServerError,
+		errorStatus(errors.New("failed")),
+	)
+}
+
+func TestApiWarnings(t *testing.T) {
+	mockServer := fixtures.PrometheusResponseStub(t, map[string]string{
+		prometheus.GetRequestsTotalByWorkloadsQuery(prometheus.IstioMixer, prometheus.DefaultRateWindow, source.DefaultFilters):  "../../test/mock/prom_workload_request_totals.json",
+		prometheus.GetGRPCErrorRatesByWorkloadsQuery(prometheus.IstioMixer, prometheus.DefaultRateWindow, source.DefaultFilters): "../../test/mock/prom_partial_vector.json",
+	})
+	defer mockServer.Close()
+
+	// router
+	metricsSource, err := prometheus.NewSource(
+		mockServer.URL,
+		prometheus.Options{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testRouter := Setup(metricsSource, "./web-dist", Options{})
+	server := httptest.NewServer(testRouter)
+
+	// call api
+	res, body := fixtures.HTTPRequest(t, server.URL+"/api/v1/workloads")
+
+	workloadsResponse := APIResponseWorkloads{}
+	jsonErr := json.Unmarshal(body, &workloadsResponse)
+	if jsonErr != nil {
+		panic(jsonErr)
+	}
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Len(t, workloadsResponse.Workloads, 5)
+	assert.Equal(
+		t,
+		[]string{"partial response: store prometheus-1 unavailable"},
+		workloadsResponse.Warnings,
+	)
+}
+
+func TestApiSourceError(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(
+		w http.ResponseWriter,
+		r *http.Request,
+	) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{
+			"status": "error",
+			"errorType": "bad_data",
+			"error": "parse error"
+		}`))
+	}))
+	defer mockServer.Close()
+
+	// router
+	metricsSource, err := prometheus.NewSource(
+		mockServer.URL,
+		prometheus.Options{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testRouter := Setup(metricsSource, "./web-dist", Options{})
+	server := httptest.NewServer(testRouter)
+
+	// call api
+	res, body := fixtures.HTTPRequest(
+		t,
+		server.URL+"/api/v1/workloads/productpage-v1/status",
+	)
+
+	response := struct {
+		Error    string   `json:"error"`
+		Warnings []string `json:"warnings"`
+	}{}
+	jsonErr := json.Unmarshal(body, &response)
+	if jsonErr != nil {
+		panic(jsonErr)
+	}
+
+	assert.Equal(t, http.StatusBadGateway, res.StatusCode)
+	assert.Contains(t, response.Error, "query failed: bad_data: parse error")
+	assert.Equal(t, []string{}, response.Warnings)
+}
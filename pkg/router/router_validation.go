@@ -0,0 +1,28 @@
+package router
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Kubernetes object names: DNS-1123 subdomains
+var namePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$`)
+
+const maxNameLength = 253
+
+// Validates a workload or namespace name, they are selected by label values
+// in the metrics queries
+func validateName(kind string, name string) error {
+	if len(name) > maxNameLength || !namePattern.MatchString(name) {
+		return fmt.Errorf("Invalid %s name: %q", kind, name)
+	}
+	return nil
+}
+
+// Validates the namespace, empty selects every namespace
+func validateNamespace(namespace string) error {
+	if namespace == "" {
+		return nil
+	}
+	return validateName("namespace", namespace)
+}
@@ -0,0 +1,56 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/hekike/outlier-istio/pkg/source"
+	"github.com/hekike/outlier-istio/test/fixtures"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateName(t *testing.T) {
+	for _, name := range []string{"productpage-v1", "unknown", "a", "web.v2"} {
+		assert.NoError(t, validateName("workload", name), name)
+	}
+	for _, name := range []string{
+		`productpage-v1"`,
+		`reviews-v3", source_workload=~".*`,
+		"Productpage",
+		"-productpage",
+		"productpage-",
+		"product page",
+	} {
+		assert.Error(t, validateName("workload", name), name)
+	}
+	assert.NoError(t, validateNamespace(""))
+}
+
+func TestApiInvalidWorkloadName(t *testing.T) {
+	// Queries must not reach the source
+	testRouter := Setup(source.NewFake(), "./web-dist", Options{})
+	server := httptest.NewServer(testRouter)
+
+	for _, path := range []string{
+		"/api/v1/workloads/" + url.PathEscape(`productpage-v1"`) + "/status",
+		"/api/v1/namespaces/" + url.PathEscape(`default"} or vector(1) #`) +
+			"/workloads/productpage-v1/status",
+		"/api/v1/workloads?namespace=" + url.QueryEscape(`default"`),
+	} {
+		res, body := fixtures.HTTPRequest(t, server.URL+path)
+
+		response := struct {
+			Error string `json:"error"`
+		}{}
+		jsonErr := json.Unmarshal(body, &response)
+		if jsonErr != nil {
+			panic(jsonErr)
+		}
+
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, path)
+		assert.Contains(t, response.Error, "Invalid", path)
+	}
+}
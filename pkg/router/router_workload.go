@@ -6,19 +6,28 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/hekike/outlier-istio/pkg/models"
+	"github.com/hekike/outlier-istio/pkg/source"
 )
 
 // APIResponseWorkloads struct.
 type APIResponseWorkloads struct {
 	Workloads []models.Workload `json:"workloads"`
+	// Warnings of the metrics source, like partial responses
+	Warnings []string `json:"warnings"`
 }
 
 // RegisterRouteGroupWorkload register route
-func RegisterRouteGroupWorkload(promAddr string, r *gin.RouterGroup) {
+func RegisterRouteGroupWorkload(metricsSource source.MetricsSource, r *gin.RouterGroup) {
 	// swagger:route GET /api/v1/workloads workload getWorkloads
 	// ---
 	// summary: Returns with destination workloads
 	// description: Returns with an array of services.
+	// parameters:
+	// 	- name: namespace
+	// 	  in: query
+	// 	  schema:
+	// 	    type: string
+	//	  description: Only returns workloads of the namespace
 	// produces:
 	// 	- application/json
 	// schemes:
@@ -29,13 +38,88 @@ func RegisterRouteGroupWorkload(promAddr string, r *gin.RouterGroup) {
 	// 	200:
 	//		type: string
 	//		description: TODO
-	r.GET("/workloads", func(c *gin.Context) {
+
+	// swagger:route GET /api/v1/namespaces/{namespace}/workloads workload getWorkloadsByNamespace
+	// ---
+	// summary: Returns with destination workloads of a namespace
+	// description: Returns with an array of services.
+	// parameters:
+	// 	- name: namespace
+	// 	  in: path
+	// 	  schema:
+	// 	    type: string
+	//	  description: Namespace of the workloads
+	// produces:
+	// 	- application/json
+	// schemes:
+	// 	- http
+	// responses:
+	// 	default:
+	//		description: Unexpected error
+	// 	200:
+	//		type: string
+	//		description: TODO
+
+	// swagger:route GET /api/v2/workloads workload getWorkloadsV2
+	// ---
+	// summary: Returns with destination workloads
+	// description: Returns with an array of services.
+	// parameters:
+	// 	- name: namespace
+	// 	  in: query
+	// 	  schema:
+	// 	    type: string
+	//	  description: Only returns workloads of the namespace
+	// produces:
+	// 	- application/json
+	// schemes:
+	// 	- http
+	// responses:
+	// 	default:
+	//		description: Unexpected error
+	// 	200:
+	//		type: string
+	//		description: TODO
+
+	// swagger:route GET /api/v2/namespaces/{namespace}/workloads workload getWorkloadsByNamespaceV2
+	// ---
+	// summary: Returns with destination workloads of a namespace
+	// description: Returns with an array of services.
+	// parameters:
+	// 	- name: namespace
+	// 	  in: path
+	// 	  schema:
+	// 	    type: string
+	//	  description: Namespace of the workloads
+	// produces:
+	// 	- application/json
+	// schemes:
+	// 	- http
+	// responses:
+	// 	default:
+	//		description: Unexpected error
+	// 	200:
+	//		type: string
+	//		description: TODO
+	handler := func(c *gin.Context) {
+		// Path parameter takes precedence over the query string filter
+		namespace := c.Param("namespace")
+		if namespace == "" {
+			namespace = c.Query("namespace")
+		}
+		if err := validateNamespace(namespace); err != nil {
+			abortWithBadRequest(c, err.Error())
+			return
+		}
+
 		// Get data
-		workloadsMap, err := models.GetWorkloads(promAddr)
+		workloadsMap, err := models.GetWorkloads(
+			c.Request.Context(),
+			metricsSource,
+			namespace,
+		)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
-				"error": err,
-			})
+			abortWithError(c, err)
 			return
 		}
 
@@ -53,7 +137,13 @@ func RegisterRouteGroupWorkload(promAddr string, r *gin.RouterGroup) {
 		}
 
 		// Response
-		response := APIResponseWorkloads{Workloads: workloads}
+		response := APIResponseWorkloads{
+			Workloads: workloads,
+			Warnings:  getWarnings(c),
+		}
 		c.JSON(http.StatusOK, response)
-	})
+	}
+
+	r.GET("/workloads", handler)
+	r.GET("/namespaces/:namespace/workloads", handler)
 }
@@ -1,15 +1,30 @@
 package router
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/hekike/outlier-istio/pkg/models"
+	"github.com/hekike/outlier-istio/pkg/source"
 )
 
+// APIResponseWorkloadStatus struct.
+type APIResponseWorkloadStatus struct {
+	*models.Workload
+	// Warnings of the metrics source, like partial responses
+	Warnings []string `json:"warnings"`
+}
+
 // RegisterRouteGroupWorkloadStatus register route
-func RegisterRouteGroupWorkloadStatus(promAddr string, r *gin.RouterGroup) {
+func RegisterRouteGroupWorkloadStatus(
+	metricsSource source.MetricsSource,
+	options Options,
+	r *gin.RouterGroup,
+) {
 	// swagger:route GET /api/v1/workloads/{name}/status workload getWorkloadStatusByName
 	// ---
 	// summary: Returns with destination workloads
@@ -42,6 +57,28 @@ func RegisterRouteGroupWorkloadStatus(promAddr string, r *gin.RouterGroup) {
 	// 	  schema:
 	// 	    type: int
 	// 	  description: Status steps in minutes
+	// 	- name: quantile
+	// 	  in: query
+	// 	  schema:
+	// 	    type: string
+	// 	  description: Comma separated request duration quantiles, like 0.5,0.95,0.99
+	// 	- name: reporterGap
+	// 	  in: query
+	// 	  schema:
+	// 	    type: boolean
+	// 	  description: Compare the request durations reported by the source and the destination of the edges
+	// 	- name: detector
+	// 	  in: query
+	// 	  schema:
+	// 	    type: string
+	// 	    enum: [median, mad, zscore, ewma]
+	// 	  description: Outlier detector of the statuses, the configured one by default
+	// 	- name: baseline
+	// 	  in: query
+	// 	  schema:
+	// 	    type: string
+	// 	    enum: [previous, daily, weekly, blend]
+	// 	  description: Baseline of the detector, the historical minutes (previous), the same range 1 day (daily) or 7 days (weekly) earlier or all of them (blend)
 	// produces:
 	// 	- application/json
 	// schemes:
@@ -52,28 +89,273 @@ func RegisterRouteGroupWorkloadStatus(promAddr string, r *gin.RouterGroup) {
 	// 	200:
 	//		type: string
 	//		description: TODO
-	type Status struct {
-		Start      time.Time `form:"start" time_format:"2006-01-02T15:04:05Z07:00"`
-		End        time.Time `form:"end" time_format:"2006-01-02T15:04:05Z07:00"`
-		Historical int       `form:"historical"`
-		StatusStep int       `form:"statusStep"`
-	}
 
-	r.GET("/workloads/:name/status", func(c *gin.Context) {
+	// swagger:route GET /api/v1/namespaces/{namespace}/workloads/{name}/status workload getNamespacedWorkloadStatusByName
+	// ---
+	// summary: Returns with destination workloads
+	// description: Returns with an array of services.
+	// parameters:
+	// 	- name: namespace
+	// 	  in: path
+	// 	  schema:
+	// 	    type: string
+	//	  description: Namespace of the workload
+	// 	- name: name
+	// 	  in: path
+	// 	  schema:
+	// 	    type: string
+	//	  description: Name of the workload
+	// 	- name: start
+	// 	  in: query
+	// 	  schema:
+	// 	    type: string
+	// 	    format: date
+	// 	  description: The start date for the report.
+	// 	- name: end
+	// 	  in: query
+	// 	  schema:
+	// 	    type: string
+	// 	    format: date
+	// 	  description: The end date for the report.
+	// 	- name: historical
+	// 	  in: query
+	// 	  schema:
+	// 	    type: int
+	// 	  description: Historical data in minutes
+	// 	- name: statusStep
+	// 	  in: query
+	// 	  schema:
+	// 	    type: int
+	// 	  description: Status steps in minutes
+	// 	- name: quantile
+	// 	  in: query
+	// 	  schema:
+	// 	    type: string
+	// 	  description: Comma separated request duration quantiles, like 0.5,0.95,0.99
+	// 	- name: reporterGap
+	// 	  in: query
+	// 	  schema:
+	// 	    type: boolean
+	// 	  description: Compare the request durations reported by the source and the destination of the edges
+	// 	- name: detector
+	// 	  in: query
+	// 	  schema:
+	// 	    type: string
+	// 	    enum: [median, mad, zscore, ewma]
+	// 	  description: Outlier detector of the statuses, the configured one by default
+	// 	- name: baseline
+	// 	  in: query
+	// 	  schema:
+	// 	    type: string
+	// 	    enum: [previous, daily, weekly, blend]
+	// 	  description: Baseline of the detector, the historical minutes (previous), the same range 1 day (daily) or 7 days (weekly) earlier or all of them (blend)
+	// produces:
+	// 	- application/json
+	// schemes:
+	// 	- http
+	// responses:
+	// 	default:
+	//		description: Unexpected error
+	// 	200:
+	//		type: string
+	//		description: TODO
+
+	handler := workloadStatusHandler(metricsSource, options, false)
+	r.GET("/workloads/:name/status", handler)
+	r.GET("/namespaces/:namespace/workloads/:name/status", handler)
+}
+
+// RegisterRouteGroupWorkloadStatusV2 registers the routes of the graded
+// statuses
+func RegisterRouteGroupWorkloadStatusV2(
+	metricsSource source.MetricsSource,
+	options Options,
+	r *gin.RouterGroup,
+) {
+	// swagger:route GET /api/v2/workloads/{name}/status workload getWorkloadStatusByNameV2
+	// ---
+	// summary: Returns the workload with graded statuses
+	// description: Statuses are ok, warning, high, critical, low or no-data with an anomaly score.
+	// parameters:
+	// 	- name: name
+	// 	  in: path
+	// 	  schema:
+	// 	    type: string
+	//	  description: Name of the workload
+	// 	- name: start
+	// 	  in: query
+	// 	  schema:
+	// 	    type: string
+	// 	    format: date
+	// 	  description: The start date for the report.
+	// 	- name: end
+	// 	  in: query
+	// 	  schema:
+	// 	    type: string
+	// 	    format: date
+	// 	  description: The end date for the report.
+	// 	- name: historical
+	// 	  in: query
+	// 	  schema:
+	// 	    type: int
+	// 	  description: Historical data in minutes
+	// 	- name: statusStep
+	// 	  in: query
+	// 	  schema:
+	// 	    type: int
+	// 	  description: Status steps in minutes
+	// 	- name: quantile
+	// 	  in: query
+	// 	  schema:
+	// 	    type: string
+	// 	  description: Comma separated request duration quantiles, like 0.5,0.95,0.99
+	// 	- name: reporterGap
+	// 	  in: query
+	// 	  schema:
+	// 	    type: boolean
+	// 	  description: Compare the request durations reported by the source and the destination of the edges
+	// 	- name: detector
+	// 	  in: query
+	// 	  schema:
+	// 	    type: string
+	// 	    enum: [median, mad, zscore, ewma]
+	// 	  description: Outlier detector of the statuses, the configured one by default
+	// 	- name: baseline
+	// 	  in: query
+	// 	  schema:
+	// 	    type: string
+	// 	    enum: [previous, daily, weekly, blend]
+	// 	  description: Baseline of the detector, the historical minutes (previous), the same range 1 day (daily) or 7 days (weekly) earlier or all of them (blend)
+	// produces:
+	// 	- application/json
+	// schemes:
+	// 	- http
+	// responses:
+	// 	default:
+	//		description: Unexpected error
+	// 	200:
+	//		type: string
+	//		description: TODO
+
+	// swagger:route GET /api/v2/namespaces/{namespace}/workloads/{name}/status workload getNamespacedWorkloadStatusByNameV2
+	// ---
+	// summary: Returns the workload with graded statuses
+	// description: Statuses are ok, warning, high, critical, low or no-data with an anomaly score.
+	// parameters:
+	// 	- name: namespace
+	// 	  in: path
+	// 	  schema:
+	// 	    type: string
+	//	  description: Namespace of the workload
+	// 	- name: name
+	// 	  in: path
+	// 	  schema:
+	// 	    type: string
+	//	  description: Name of the workload
+	// 	- name: start
+	// 	  in: query
+	// 	  schema:
+	// 	    type: string
+	// 	    format: date
+	// 	  description: The start date for the report.
+	// 	- name: end
+	// 	  in: query
+	// 	  schema:
+	// 	    type: string
+	// 	    format: date
+	// 	  description: The end date for the report.
+	// 	- name: historical
+	// 	  in: query
+	// 	  schema:
+	// 	    type: int
+	// 	  description: Historical data in minutes
+	// 	- name: statusStep
+	// 	  in: query
+	// 	  schema:
+	// 	    type: int
+	// 	  description: Status steps in minutes
+	// 	- name: quantile
+	// 	  in: query
+	// 	  schema:
+	// 	    type: string
+	// 	  description: Comma separated request duration quantiles, like 0.5,0.95,0.99
+	// 	- name: reporterGap
+	// 	  in: query
+	// 	  schema:
+	// 	    type: boolean
+	// 	  description: Compare the request durations reported by the source and the destination of the edges
+	// 	- name: detector
+	// 	  in: query
+	// 	  schema:
+	// 	    type: string
+	// 	    enum: [median, mad, zscore, ewma]
+	// 	  description: Outlier detector of the statuses, the configured one by default
+	// 	- name: baseline
+	// 	  in: query
+	// 	  schema:
+	// 	    type: string
+	// 	    enum: [previous, daily, weekly, blend]
+	// 	  description: Baseline of the detector, the historical minutes (previous), the same range 1 day (daily) or 7 days (weekly) earlier or all of them (blend)
+	// produces:
+	// 	- application/json
+	// schemes:
+	// 	- http
+	// responses:
+	// 	default:
+	//		description: Unexpected error
+	// 	200:
+	//		type: string
+	//		description: TODO
+
+	handler := workloadStatusHandler(metricsSource, options, true)
+	r.GET("/workloads/:name/status", handler)
+	r.GET("/namespaces/:namespace/workloads/:name/status", handler)
+}
+
+// Query string parameters of the status routes
+type statusQuery struct {
+	Start      time.Time `form:"start" time_format:"2006-01-02T15:04:05Z07:00"`
+	End        time.Time `form:"end" time_format:"2006-01-02T15:04:05Z07:00"`
+	Historical int       `form:"historical"`
+	StatusStep int       `form:"statusStep"`
+	Quantile   string    `form:"quantile"`
+	// Network and sidecar overhead of the edges
+	ReporterGap bool   `form:"reporterGap"`
+	Detector    string `form:"detector"`
+	Baseline    string `form:"baseline"`
+}
+
+// Returns the status of the workload, graded statuses have a Severity and
+// a score
+func workloadStatusHandler(
+	metricsSource source.MetricsSource,
+	options Options,
+	graded bool,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Empty on the route without namespace: any namespace
+		namespace := c.Param("namespace")
 		name := c.Param("name")
 
 		// Validation
 		if name == "" {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "Workload name cannot be empty",
-			})
+			abortWithBadRequest(c, "Workload name cannot be empty")
+			return
+		}
+		if err := validateName("workload", name); err != nil {
+			abortWithBadRequest(c, err.Error())
+			return
+		}
+		if err := validateNamespace(namespace); err != nil {
+			abortWithBadRequest(c, err.Error())
+			return
 		}
 
 		// Bind query string parameters
-		var status Status
+		var status statusQuery
 		err := c.ShouldBindQuery(&status)
 		if err != nil {
-			c.AbortWithError(http.StatusInternalServerError, err)
+			abortWithError(c, err)
 			return
 		}
 
@@ -90,6 +372,26 @@ func RegisterRouteGroupWorkloadStatus(promAddr string, r *gin.RouterGroup) {
 		if status.StatusStep == 0 {
 			status.StatusStep = 5
 		}
+		if status.Detector == "" {
+			status.Detector = options.Detector
+		}
+		if err := models.ValidateDetector(status.Detector); err != nil {
+			abortWithBadRequest(c, err.Error())
+			return
+		}
+		if status.Baseline == "" {
+			status.Baseline = models.DefaultBaseline
+		}
+		if err := models.ValidateBaseline(status.Baseline); err != nil {
+			abortWithBadRequest(c, err.Error())
+			return
+		}
+
+		quantiles, err := parseQuantiles(status.Quantile)
+		if err != nil {
+			abortWithBadRequest(c, err.Error())
+			return
+		}
 
 		historical := time.Duration(status.Historical) * time.Minute
 		historicalStart := status.Start.Add(-historical)
@@ -97,19 +399,68 @@ func RegisterRouteGroupWorkloadStatus(promAddr string, r *gin.RouterGroup) {
 
 		// Get data
 		workload, err := models.GetWorkloadStatusByName(
-			promAddr,
+			c.Request.Context(),
+			metricsSource,
+			namespace,
 			name,
 			status.Start,
 			status.End,
 			historicalStart,
 			statusStep,
+			models.StatusOptions{
+				Quantiles:         quantiles,
+				ReporterGap:       status.ReporterGap,
+				Detector:          status.Detector,
+				LatencyThresholds: options.LatencyThresholds,
+				Graded:            graded,
+				Baseline:          status.Baseline,
+			},
 		)
 		if err != nil {
-			c.AbortWithError(http.StatusInternalServerError, err)
+			abortWithError(c, err)
 			return
 		}
 
 		// Response
-		c.JSON(http.StatusOK, workload)
-	})
+		c.JSON(http.StatusOK, APIResponseWorkloadStatus{
+			Workload: workload,
+			Warnings: getWarnings(c),
+		})
+	}
+}
+
+// Maximum number of quantiles in a single request, every quantile is a
+// separate set of queries
+const maxQuantiles = 5
+
+// Parses comma separated quantiles, defaults to source.DefaultQuantile
+func parseQuantiles(value string) ([]float64, error) {
+	if value == "" {
+		return []float64{source.DefaultQuantile}, nil
+	}
+
+	quantiles := []float64{}
+	seen := make(map[float64]bool)
+	for _, part := range strings.Split(value, ",") {
+		quantile, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || quantile <= 0 || quantile >= 1 {
+			return nil, fmt.Errorf(
+				"Quantile must be between 0 and 1, got: %s",
+				part,
+			)
+		}
+		if seen[quantile] {
+			continue
+		}
+		seen[quantile] = true
+		quantiles = append(quantiles, quantile)
+	}
+
+	if len(quantiles) > maxQuantiles {
+		return nil, fmt.Errorf(
+			"At most %d quantiles can be requested",
+			maxQuantiles,
+		)
+	}
+	return quantiles, nil
 }
@@ -5,25 +5,38 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/hekike/outlier-istio/pkg/dump"
 	"github.com/hekike/outlier-istio/pkg/models"
 	"github.com/hekike/outlier-istio/pkg/prometheus"
+	"github.com/hekike/outlier-istio/pkg/source"
 	"github.com/hekike/outlier-istio/test/fixtures"
+	promModel "github.com/prometheus/common/model"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestApiGetWorkloadStatus(t *testing.T) {
 	workloadName := "productpage-v1"
 
-	mockServer := fixtures.PrometheusResponseStub(t, map[string]string{
-		prometheus.GetDownstreamRequestDurationsQuery(workloadName): "../../test/mock/prom_workload_source_request_durations.json",
-		prometheus.GetUpstreamRequestDurationsQuery(workloadName):   "../../test/mock/prom_workload_destination_request_durations.json",
-		prometheus.GetStatusesQuery(workloadName):                   "../../test/mock/prom_workload_destination_request_durations.json",
-	})
+	files := map[string]string{
+		prometheus.GetDownstreamRequestDurationsQuery(prometheus.IstioMixer, source.Query{Workload: workloadName}, source.DefaultFilters): "../../test/mock/prom_workload_source_request_durations.json",
+		prometheus.GetUpstreamRequestDurationsQuery(prometheus.IstioMixer, source.Query{Workload: workloadName}, source.DefaultFilters):   "../../test/mock/prom_workload_destination_request_durations.json",
+		prometheus.GetStatusesQuery(prometheus.IstioMixer, source.Query{Workload: workloadName}, source.DefaultFilters):                   "../../test/mock/prom_workload_destination_request_durations.json",
+	}
+	addSignalMocks(files, source.Query{Workload: workloadName})
+	mockServer := fixtures.PrometheusResponseStub(t, files)
 	defer mockServer.Close()
 
 	// router
-	testRouter := Setup(mockServer.URL, "./web-dist")
+	metricsSource, err := prometheus.NewSource(
+		mockServer.URL,
+		prometheus.Options{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testRouter := Setup(metricsSource, "./web-dist", Options{})
 	server := httptest.NewServer(testRouter)
 
 	// call api
@@ -41,6 +54,7 @@ func TestApiGetWorkloadStatus(t *testing.T) {
 	expected.Name = workloadName
 
 	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "60s", workloadsResponse.RateWindow)
 
 	// Destination expectations
 	detailsV1 := workloadsResponse.Destinations[0]
@@ -59,6 +73,65 @@ func TestApiGetWorkloadStatus(t *testing.T) {
 		"ok", "ok", "ok", "ok",
 		"ok", "ok", "ok", "ok",
 	}, statuses)
+	assert.Equal(
+		t,
+		&models.DefaultLatencyThreshold,
+		detailsV1.Statuses[13].Threshold,
+	)
+
+	statuses = make([]string, len(detailsV1.Errors))
+
+	for i, status := range detailsV1.Errors {
+		statuses[i] = status.Status
+	}
+
+	assert.Equal(t, []string{
+		"ok", "ok", "ok", "ok",
+		"ok", "ok", "ok", "ok",
+		"ok", "ok", "ok", "ok",
+		"ok", "ok", "errors", "ok",
+	}, statuses)
+
+	statuses = make([]string, len(detailsV1.Traffic))
+
+	for i, status := range detailsV1.Traffic {
+		statuses[i] = status.Status
+	}
+
+	// Steps of the requested range without requests are filled with zeros,
+	// the mocked samples are after the requested range
+	assert.Equal(t, []string{
+		"ok", "ok", "ok", "ok", "ok",
+		"ok", "ok", "ok", "ok", "ok",
+		"ok", "ok", "ok", "ok", "ok",
+		"ok", "ok", "ok", "ok",
+		"ok", "ok", "ok", "ok",
+		"ok", "ok", "ok", "ok",
+		"ok", "ok", "traffic-drop", "traffic-drop",
+	}, statuses)
+
+	var reviewsV3 models.Workload
+	for _, destination := range workloadsResponse.Destinations {
+		if destination.Name == "reviews-v3" {
+			reviewsV3 = destination
+		}
+	}
+
+	statuses = make([]string, len(reviewsV3.Traffic))
+
+	for i, status := range reviewsV3.Traffic {
+		statuses[i] = status.Status
+	}
+
+	assert.Equal(t, []string{
+		"ok", "ok", "ok", "ok", "ok",
+		"ok", "ok", "ok", "ok", "ok",
+		"ok", "ok", "ok", "ok", "ok",
+		"ok", "ok", "ok", "ok",
+		"ok", "ok", "ok", "ok",
+		"ok", "ok", "ok", "ok",
+		"ok", "ok", "traffic-spike", "ok",
+	}, statuses)
 
 	// Source expectations
 	ingressgateway := workloadsResponse.Sources[0]
@@ -92,3 +165,404 @@ func TestApiGetWorkloadStatus(t *testing.T) {
 		"ok", "high", "ok", "ok",
 	}, statuses)
 }
+
+func TestApiGetWorkloadStatusV2(t *testing.T) {
+	workloadName := "productpage-v1"
+
+	files := map[string]string{
+		prometheus.GetDownstreamRequestDurationsQuery(prometheus.IstioMixer, source.Query{Workload: workloadName}, source.DefaultFilters): "../../test/mock/prom_workload_source_request_durations.json",
+		prometheus.GetUpstreamRequestDurationsQuery(prometheus.IstioMixer, source.Query{Workload: workloadName}, source.DefaultFilters):   "../../test/mock/prom_workload_destination_request_durations.json",
+		prometheus.GetStatusesQuery(prometheus.IstioMixer, source.Query{Workload: workloadName}, source.DefaultFilters):                   "../../test/mock/prom_workload_destination_request_durations.json",
+	}
+	addSignalMocks(files, source.Query{Workload: workloadName})
+	mockServer := fixtures.PrometheusResponseStub(t, files)
+	defer mockServer.Close()
+
+	metricsSource, err := prometheus.NewSource(
+		mockServer.URL,
+		prometheus.Options{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 20% over the baseline, at least 5ms
+	testRouter := Setup(metricsSource, "./web-dist", Options{
+		LatencyThresholds: &models.Thresholds{
+			Default: &models.Threshold{Relative: 0.2, Absolute: 0.005},
+		},
+	})
+	server := httptest.NewServer(testRouter)
+
+	res, body := fixtures.HTTPRequest(
+		t,
+		server.URL+"/api/v2/workloads/"+workloadName+
+			"/status?end=2018-10-27T23:34:27.627Z",
+	)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	workloadsResponse := models.Workload{}
+	if err := json.Unmarshal(body, &workloadsResponse); err != nil {
+		t.Fatal(err)
+	}
+
+	detailsV1 := workloadsResponse.Destinations[0]
+	assert.Equal(t, "details-v1", detailsV1.Name)
+	statuses := make([]string, len(detailsV1.Statuses))
+	for i, status := range detailsV1.Statuses {
+		statuses[i] = status.Status
+		assert.NotNil(t, status.Score)
+	}
+	// Steps up to 5ms over the baseline are warnings, 452ms is critical
+	assert.Equal(t, []string{
+		"ok", "ok", "ok", "ok",
+		"ok", "warning", "ok", "warning",
+		"ok", "warning", "ok", "ok",
+		"warning", "critical", "ok", "ok",
+	}, statuses)
+	assert.Equal(t, 88.5192, *detailsV1.Statuses[13].Score)
+
+	traffic := detailsV1.Traffic
+	assert.Equal(t, "low", traffic[len(traffic)-1].Status)
+
+	// Scores are only in the API v2
+	res, body = fixtures.HTTPRequest(
+		t,
+		server.URL+"/api/v1/workloads/"+workloadName+
+			"/status?end=2018-10-27T15:00:00Z",
+	)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.NotContains(t, string(body), `"score"`)
+}
+
+func TestApiGetWorkloadStatusV2NoData(t *testing.T) {
+	workloadName := "productpage-v1"
+	end := time.Date(2018, 10, 27, 15, 0, 0, 0, time.UTC)
+
+	// 10ms every minute without samples between 14:16 and 14:35
+	latencies := []promModel.SamplePair{}
+	for t := end.Add(-75 * time.Minute); !t.After(end); t = t.Add(time.Minute) {
+		if t.After(end.Add(-45*time.Minute)) && !t.After(end.Add(-25*time.Minute)) {
+			continue
+		}
+		latencies = append(latencies, promModel.SamplePair{
+			Timestamp: promModel.TimeFromUnixNano(t.UnixNano()),
+			Value:     0.01,
+		})
+	}
+	metricsSource := source.NewFake()
+	metricsSource.Matrices[source.Query{Workload: workloadName}] =
+		promModel.Matrix{
+			&promModel.SampleStream{Metric: promModel.Metric{}, Values: latencies},
+		}
+	testRouter := Setup(metricsSource, "./web-dist", Options{})
+	server := httptest.NewServer(testRouter)
+
+	getStatuses := func(version string) []string {
+		res, body := fixtures.HTTPRequest(
+			t,
+			server.URL+"/api/"+version+"/workloads/"+workloadName+
+				"/status?end=2018-10-27T15:00:00Z",
+		)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+
+		workloadsResponse := models.Workload{}
+		if err := json.Unmarshal(body, &workloadsResponse); err != nil {
+			t.Fatal(err)
+		}
+		statuses := make([]string, len(workloadsResponse.Statuses))
+		for i, status := range workloadsResponse.Statuses {
+			statuses[i] = status.Status
+		}
+		return statuses
+	}
+
+	assert.Equal(t, []string{
+		"ok", "ok", "ok", "ok", "ok", "ok", "ok",
+		"no-data", "no-data", "no-data",
+		"ok", "ok", "ok", "ok", "ok", "ok",
+	}, getStatuses("v2"))
+	// The API v1 leaves the steps without samples out
+	assert.Len(t, getStatuses("v1"), 13)
+}
+
+func TestApiGetNamespacedWorkloadStatus(t *testing.T) {
+	namespace := "default"
+	workloadName := "productpage-v1"
+	query := source.Query{Namespace: namespace, Workload: workloadName}
+
+	files := map[string]string{
+		prometheus.GetDownstreamRequestDurationsQuery(prometheus.IstioMixer, query, source.DefaultFilters): "../../test/mock/prom_workload_source_request_durations.json",
+		prometheus.GetUpstreamRequestDurationsQuery(prometheus.IstioMixer, query, source.DefaultFilters):   "../../test/mock/prom_workload_destination_request_durations.json",
+		prometheus.GetStatusesQuery(prometheus.IstioMixer, query, source.DefaultFilters):                   "../../test/mock/prom_workload_destination_request_durations.json",
+	}
+	addSignalMocks(files, query)
+	mockServer := fixtures.PrometheusResponseStub(t, files)
+	defer mockServer.Close()
+
+	// router
+	metricsSource, err := prometheus.NewSource(
+		mockServer.URL,
+		prometheus.Options{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testRouter := Setup(metricsSource, "./web-dist", Options{})
+	server := httptest.NewServer(testRouter)
+
+	// call api
+	workloadsURL := server.URL + "/api/v1/namespaces/" + namespace +
+		"/workloads/" + workloadName + "/status?end=2018-10-27T15:00:00Z"
+	res, body := fixtures.HTTPRequest(t, workloadsURL)
+
+	workloadsResponse := models.Workload{}
+	jsonErr := json.Unmarshal(body, &workloadsResponse)
+	if jsonErr != nil {
+		panic(jsonErr)
+	}
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, namespace, workloadsResponse.Namespace)
+	assert.Equal(t, workloadName, workloadsResponse.Name)
+
+	detailsV1 := workloadsResponse.Destinations[0]
+	assert.Equal(t, "default", detailsV1.Namespace)
+	assert.Equal(t, "details-v1", detailsV1.Name)
+
+	ingressgateway := workloadsResponse.Sources[0]
+	assert.Equal(t, "istio-system", ingressgateway.Namespace)
+	assert.Equal(t, "istio-ingressgateway", ingressgateway.Name)
+}
+
+func TestApiGetWorkloadStatusFromDump(t *testing.T) {
+	metricsSource, err := dump.NewSource("../../test/dump", dump.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testRouter := Setup(metricsSource, "./web-dist", Options{})
+	server := httptest.NewServer(testRouter)
+
+	// call api
+	workloadsURL := server.URL + "/api/v1/namespaces/default/workloads/" +
+		"productpage-v1/status?end=2018-10-27T23:00:00Z"
+	res, body := fixtures.HTTPRequest(t, workloadsURL)
+
+	workloadsResponse := models.Workload{}
+	jsonErr := json.Unmarshal(body, &workloadsResponse)
+	if jsonErr != nil {
+		panic(jsonErr)
+	}
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "productpage-v1", workloadsResponse.Name)
+	assert.Len(t, workloadsResponse.Destinations, 4)
+	assert.Len(t, workloadsResponse.Sources, 1)
+	// The dumped samples start 40 minutes before the end
+	assert.Len(t, workloadsResponse.Statuses, 9)
+}
+
+func TestApiGetWorkloadStatusDetector(t *testing.T) {
+	metricsSource, err := dump.NewSource("../../test/dump", dump.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testRouter := Setup(metricsSource, "./web-dist", Options{
+		Detector: models.DetectorZScore,
+	})
+	server := httptest.NewServer(testRouter)
+	workloadsURL := server.URL + "/api/v1/namespaces/default/workloads/" +
+		"productpage-v1/status?end=2018-10-27T23:00:00Z"
+
+	for _, detector := range append(models.Detectors, "") {
+		res, body := fixtures.HTTPRequest(t, workloadsURL+"&detector="+detector)
+		assert.Equal(t, http.StatusOK, res.StatusCode, detector)
+
+		workloadsResponse := models.Workload{}
+		assert.NoError(t, json.Unmarshal(body, &workloadsResponse))
+		assert.Len(t, workloadsResponse.Statuses, 9, detector)
+	}
+
+	res, body := fixtures.HTTPRequest(t, workloadsURL+"&detector=iforest")
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	assert.Contains(t, string(body), "Detector must be one of")
+}
+
+func TestApiGetWorkloadStatusBaseline(t *testing.T) {
+	metricsSource, err := dump.NewSource("../../test/dump", dump.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testRouter := Setup(metricsSource, "./web-dist", Options{})
+	server := httptest.NewServer(testRouter)
+	workloadsURL := server.URL + "/api/v1/namespaces/default/workloads/" +
+		"productpage-v1/status?end=2018-10-27T23:00:00Z"
+
+	// The dump has no samples a day or a week earlier, the seasonal
+	// baselines fall back to the steps
+	for _, baseline := range append(models.Baselines, "") {
+		res, body := fixtures.HTTPRequest(t, workloadsURL+"&baseline="+baseline)
+		assert.Equal(t, http.StatusOK, res.StatusCode, baseline)
+
+		workloadsResponse := models.Workload{}
+		assert.NoError(t, json.Unmarshal(body, &workloadsResponse))
+		assert.Len(t, workloadsResponse.Statuses, 9, baseline)
+	}
+
+	res, body := fixtures.HTTPRequest(t, workloadsURL+"&baseline=monthly")
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	assert.Contains(t, string(body), "Baseline must be one of")
+}
+
+func TestApiGetWorkloadStatusQuantiles(t *testing.T) {
+	workloadName := "productpage-v1"
+
+	files := map[string]string{}
+	for _, quantile := range []float64{0.5, 0.99} {
+		query := source.Query{Workload: workloadName, Quantile: quantile}
+		files[prometheus.GetDownstreamRequestDurationsQuery(prometheus.IstioMixer, query, source.DefaultFilters)] = "../../test/mock/prom_workload_source_request_durations.json"
+		files[prometheus.GetUpstreamRequestDurationsQuery(prometheus.IstioMixer, query, source.DefaultFilters)] = "../../test/mock/prom_workload_destination_request_durations.json"
+		files[prometheus.GetStatusesQuery(prometheus.IstioMixer, query, source.DefaultFilters)] = "../../test/mock/prom_workload_destination_request_durations.json"
+	}
+	addSignalMocks(files, source.Query{Workload: workloadName})
+	mockServer := fixtures.PrometheusResponseStub(t, files)
+	defer mockServer.Close()
+
+	// router
+	metricsSource, err := prometheus.NewSource(
+		mockServer.URL,
+		prometheus.Options{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testRouter := Setup(metricsSource, "./web-dist", Options{})
+	server := httptest.NewServer(testRouter)
+
+	// call api
+	workloadsURL := server.URL + "/api/v1/workloads/" + workloadName +
+		"/status?end=2018-10-27T15:00:00Z&quantile=0.5,0.99"
+	res, body := fixtures.HTTPRequest(t, workloadsURL)
+
+	workloadsResponse := models.Workload{}
+	jsonErr := json.Unmarshal(body, &workloadsResponse)
+	if jsonErr != nil {
+		panic(jsonErr)
+	}
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Len(t, workloadsResponse.Quantiles, 2)
+	assert.Equal(t, 0.5, workloadsResponse.Quantiles[0].Quantile)
+	assert.Equal(t, 0.99, workloadsResponse.Quantiles[1].Quantile)
+	assert.Equal(
+		t,
+		workloadsResponse.Quantiles[0].Statuses,
+		workloadsResponse.Statuses,
+	)
+
+	detailsV1 := workloadsResponse.Destinations[0]
+	assert.Equal(t, "details-v1", detailsV1.Name)
+	assert.Len(t, detailsV1.Quantiles, 2)
+	assert.Len(t, detailsV1.Quantiles[1].Statuses, 16)
+
+	// invalid quantile
+	res, _ = fixtures.HTTPRequest(
+		t,
+		server.URL+"/api/v1/workloads/"+workloadName+"/status?quantile=95",
+	)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestParseQuantiles(t *testing.T) {
+	quantiles, err := parseQuantiles("")
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{0.95}, quantiles)
+
+	quantiles, err = parseQuantiles("0.5, 0.95,0.99,0.5")
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{0.5, 0.95, 0.99}, quantiles)
+
+	_, err = parseQuantiles("0.5,1")
+	assert.EqualError(t, err, "Quantile must be between 0 and 1, got: 1")
+
+	_, err = parseQuantiles("0.1,0.2,0.3,0.4,0.5,0.6")
+	assert.EqualError(t, err, "At most 5 quantiles can be requested")
+}
+
+// Adds the mocks of the signals queried besides latency
+func addSignalMocks(files map[string]string, query source.Query) {
+	for q, file := range map[string]string{
+		prometheus.GetDownstreamErrorRatesQuery(prometheus.IstioMixer, query, source.DefaultFilters):      "../../test/mock/prom_workload_source_error_rates.json",
+		prometheus.GetUpstreamErrorRatesQuery(prometheus.IstioMixer, query, source.DefaultFilters):        "../../test/mock/prom_workload_destination_error_rates.json",
+		prometheus.GetErrorRatesQuery(prometheus.IstioMixer, query, source.DefaultFilters):                "../../test/mock/prom_workload_destination_error_rates.json",
+		prometheus.GetDownstreamGRPCErrorRatesQuery(prometheus.IstioMixer, query, source.DefaultFilters):  "../../test/mock/prom_empty_matrix.json",
+		prometheus.GetUpstreamGRPCErrorRatesQuery(prometheus.IstioMixer, query, source.DefaultFilters):    "../../test/mock/prom_empty_matrix.json",
+		prometheus.GetGRPCErrorRatesQuery(prometheus.IstioMixer, query, source.DefaultFilters):            "../../test/mock/prom_empty_matrix.json",
+		prometheus.GetDownstreamRequestRatesQuery(prometheus.IstioMixer, query, source.DefaultFilters):    "../../test/mock/prom_workload_source_request_rates.json",
+		prometheus.GetUpstreamRequestRatesQuery(prometheus.IstioMixer, query, source.DefaultFilters):      "../../test/mock/prom_workload_destination_request_rates.json",
+		prometheus.GetRequestRatesQuery(prometheus.IstioMixer, query, source.DefaultFilters):              "../../test/mock/prom_workload_destination_request_rates.json",
+		prometheus.GetDownstreamConnectionChurnQuery(prometheus.IstioMixer, query, source.DefaultFilters): "../../test/mock/prom_empty_matrix.json",
+		prometheus.GetUpstreamConnectionChurnQuery(prometheus.IstioMixer, query, source.DefaultFilters):   "../../test/mock/prom_empty_matrix.json",
+		prometheus.GetConnectionChurnQuery(prometheus.IstioMixer, query, source.DefaultFilters):           "../../test/mock/prom_empty_matrix.json",
+		prometheus.GetDownstreamThroughputQuery(prometheus.IstioMixer, query, source.DefaultFilters):      "../../test/mock/prom_empty_matrix.json",
+		prometheus.GetUpstreamThroughputQuery(prometheus.IstioMixer, query, source.DefaultFilters):        "../../test/mock/prom_empty_matrix.json",
+		prometheus.GetThroughputQuery(prometheus.IstioMixer, query, source.DefaultFilters):                "../../test/mock/prom_empty_matrix.json",
+	} {
+		files[q] = file
+	}
+}
+
+func TestApiGetWorkloadStatusReporterGap(t *testing.T) {
+	workloadName := "productpage-v1"
+	query := source.Query{Workload: workloadName}
+
+	files := map[string]string{
+		prometheus.GetDownstreamRequestDurationsQuery(prometheus.IstioMixer, query, source.DefaultFilters): "../../test/mock/prom_workload_source_request_durations.json",
+		prometheus.GetUpstreamRequestDurationsQuery(prometheus.IstioMixer, query, source.DefaultFilters):   "../../test/mock/prom_workload_destination_request_durations.json",
+		prometheus.GetStatusesQuery(prometheus.IstioMixer, query, source.DefaultFilters):                   "../../test/mock/prom_workload_destination_request_durations.json",
+		prometheus.GetDownstreamReporterGapQuery(prometheus.IstioMixer, query, source.DefaultFilters):      "../../test/mock/prom_workload_source_reporter_gaps.json",
+		prometheus.GetUpstreamReporterGapQuery(prometheus.IstioMixer, query, source.DefaultFilters):        "../../test/mock/prom_empty_matrix.json",
+	}
+	addSignalMocks(files, query)
+	mockServer := fixtures.PrometheusResponseStub(t, files)
+	defer mockServer.Close()
+
+	// router
+	metricsSource, err := prometheus.NewSource(
+		mockServer.URL,
+		prometheus.Options{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testRouter := Setup(metricsSource, "./web-dist", Options{})
+	server := httptest.NewServer(testRouter)
+
+	// call api
+	workloadsURL := server.URL + "/api/v1/workloads/" + workloadName +
+		"/status?end=2018-10-27T15:00:00Z&reporterGap=true"
+	res, body := fixtures.HTTPRequest(t, workloadsURL)
+
+	workloadsResponse := models.Workload{}
+	jsonErr := json.Unmarshal(body, &workloadsResponse)
+	if jsonErr != nil {
+		panic(jsonErr)
+	}
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	detailsV1 := workloadsResponse.Destinations[0]
+	assert.Equal(t, "details-v1", detailsV1.Name)
+
+	statuses := make([]string, len(detailsV1.ReporterGap))
+	for i, status := range detailsV1.ReporterGap {
+		statuses[i] = status.Status
+	}
+	assert.Equal(t, []string{
+		"ok", "ok", "ok", "ok",
+		"ok", "ok", "ok", "ok",
+		"ok", "ok", "ok", "ok",
+		"ok", "ok", "high-gap", "ok",
+	}, statuses)
+
+	assert.Empty(t, workloadsResponse.Sources[0].ReporterGap)
+}
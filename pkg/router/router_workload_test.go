@@ -8,18 +8,27 @@ import (
 
 	"github.com/hekike/outlier-istio/pkg/models"
 	"github.com/hekike/outlier-istio/pkg/prometheus"
+	"github.com/hekike/outlier-istio/pkg/source"
 	"github.com/hekike/outlier-istio/test/fixtures"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestApiGetWorkloads(t *testing.T) {
 	mockServer := fixtures.PrometheusResponseStub(t, map[string]string{
-		prometheus.GetRequestsTotalByWorkloadsQuery(): "../../test/mock/prom_workload_request_totals.json",
+		prometheus.GetRequestsTotalByWorkloadsQuery(prometheus.IstioMixer, prometheus.DefaultRateWindow, source.DefaultFilters):  "../../test/mock/prom_workload_request_totals.json",
+		prometheus.GetGRPCErrorRatesByWorkloadsQuery(prometheus.IstioMixer, prometheus.DefaultRateWindow, source.DefaultFilters): "../../test/mock/prom_empty_vector.json",
 	})
 	defer mockServer.Close()
 
 	// router
-	testRouter := Setup(mockServer.URL, "./web-dist")
+	metricsSource, err := prometheus.NewSource(
+		mockServer.URL,
+		prometheus.Options{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testRouter := Setup(metricsSource, "./web-dist", Options{})
 	server := httptest.NewServer(testRouter)
 
 	// call api
@@ -40,44 +49,143 @@ func TestApiGetWorkloads(t *testing.T) {
 	)
 }
 
+func TestApiGetWorkloadsByNamespace(t *testing.T) {
+	mockServer := fixtures.PrometheusResponseStub(t, map[string]string{
+		prometheus.GetRequestsTotalByWorkloadsQuery(prometheus.IstioMixer, prometheus.DefaultRateWindow, source.DefaultFilters):  "../../test/mock/prom_workload_request_totals.json",
+		prometheus.GetGRPCErrorRatesByWorkloadsQuery(prometheus.IstioMixer, prometheus.DefaultRateWindow, source.DefaultFilters): "../../test/mock/prom_empty_vector.json",
+	})
+	defer mockServer.Close()
+
+	// router
+	metricsSource, err := prometheus.NewSource(
+		mockServer.URL,
+		prometheus.Options{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testRouter := Setup(metricsSource, "./web-dist", Options{})
+	server := httptest.NewServer(testRouter)
+
+	for _, path := range []string{
+		"/api/v1/namespaces/unknown/workloads",
+		"/api/v1/workloads?namespace=unknown",
+	} {
+		res, body := fixtures.HTTPRequest(t, server.URL+path)
+
+		workloadsResponse := APIResponseWorkloads{}
+		jsonErr := json.Unmarshal(body, &workloadsResponse)
+		if jsonErr != nil {
+			panic(jsonErr)
+		}
+
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Len(t, workloadsResponse.Workloads, 1)
+		assert.Equal(t, "unknown", workloadsResponse.Workloads[0].Namespace)
+	}
+}
+
 func getWorkloadsResponseMock() []models.Workload {
 	unknown := models.Workload{}
+	unknown.Namespace = "unknown"
 	unknown.Name = "unknown"
 	unknown.App = "unknown"
 	unknown.Sources = make([]models.Workload, 0)
 
 	productpage := models.Workload{}
+	productpage.Namespace = "default"
 	productpage.Name = "productpage-v1"
 	productpage.App = "productpage"
 
 	reviews := models.Workload{}
+	reviews.Namespace = "default"
 	reviews.Name = "reviews-v3"
 	reviews.App = "reviews"
 
 	ratings := models.Workload{}
+	ratings.Namespace = "default"
 	ratings.Name = "ratings-v1"
 	ratings.App = "ratings"
-	ratings.Destinations = make([]models.Workload, 0)
 
-	unknown.AddDestination(
-		models.Workload{Name: "productpage-v1", App: "productpage"},
-	)
+	mongodb := models.Workload{}
+	mongodb.Namespace = "default"
+	mongodb.Name = "mongodb-v1"
+	mongodb.App = "mongodb"
+	mongodb.Destinations = make([]models.Workload, 0)
 
-	productpage.AddSource(models.Workload{Name: "unknown", App: "unknown"})
-	productpage.AddDestination(
-		models.Workload{Name: "reviews-v3", App: "reviews"},
-	)
+	rate := func(value float64) *float64 {
+		return &value
+	}
 
-	reviews.AddSource(
-		models.Workload{Name: "productpage-v1", App: "productpage"},
-	)
-	reviews.AddDestination(
-		models.Workload{Name: "ratings-v1", App: "ratings"},
-	)
+	unknown.AddDestination(models.Workload{
+		Namespace:   "default",
+		Name:        "productpage-v1",
+		App:         "productpage",
+		Protocol:    "http",
+		RequestRate: rate(2.5),
+	})
+
+	productpage.AddSource(models.Workload{
+		Namespace:   "unknown",
+		Name:        "unknown",
+		App:         "unknown",
+		Protocol:    "http",
+		RequestRate: rate(2.5),
+	})
+	productpage.AddDestination(models.Workload{
+		Namespace:   "default",
+		Name:        "reviews-v3",
+		App:         "reviews",
+		Protocol:    "http",
+		RequestRate: rate(1.2),
+	})
+
+	reviews.AddSource(models.Workload{
+		Namespace:   "default",
+		Name:        "productpage-v1",
+		App:         "productpage",
+		Protocol:    "http",
+		RequestRate: rate(1.2),
+	})
+	reviews.AddDestination(models.Workload{
+		Namespace:   "default",
+		Name:        "ratings-v1",
+		App:         "ratings",
+		Protocol:    "http",
+		RequestRate: rate(1.1),
+	})
+
+	ratings.AddSource(models.Workload{
+		Namespace:   "default",
+		Name:        "reviews-v3",
+		App:         "reviews",
+		Protocol:    "http",
+		RequestRate: rate(1.1),
+	})
 
-	ratings.AddSource(models.Workload{Name: "reviews-v3", App: "reviews"})
+	ratings.AddDestination(models.Workload{
+		Namespace:      "default",
+		Name:           "mongodb-v1",
+		App:            "mongodb",
+		Protocol:       "tcp",
+		ConnectionRate: rate(0.3),
+	})
+
+	mongodb.AddSource(models.Workload{
+		Namespace:      "default",
+		Name:           "ratings-v1",
+		App:            "ratings",
+		Protocol:       "tcp",
+		ConnectionRate: rate(0.3),
+	})
 
-	workloads := []models.Workload{unknown, reviews, ratings, productpage}
+	workloads := []models.Workload{
+		unknown,
+		reviews,
+		ratings,
+		mongodb,
+		productpage,
+	}
 
 	return workloads
 }
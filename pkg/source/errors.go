@@ -0,0 +1,60 @@
+package source
+
+import (
+	"fmt"
+	"time"
+)
+
+// ResultTypeError is returned when a query returns an unexpected result
+// type.
+type ResultTypeError struct {
+	Query    string
+	Expected string
+	Actual   string
+}
+
+func (e *ResultTypeError) Error() string {
+	return fmt.Sprintf(
+		"unexpected result type of query, expected %s, got %s",
+		e.Expected,
+		e.Actual,
+	)
+}
+
+// QueryError is an error reported by the metrics backend.
+type QueryError struct {
+	Query string
+	// Error type reported by the backend, like bad_data
+	Type    string
+	Message string
+	Err     error
+}
+
+func (e *QueryError) Error() string {
+	if e.Type == "" {
+		return fmt.Sprintf("query failed: %s", e.Message)
+	}
+	return fmt.Sprintf("query failed: %s: %s", e.Type, e.Message)
+}
+
+// Unwrap returns the error of the backend client.
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+// TimeoutError is returned when a query does not finish in time.
+type TimeoutError struct {
+	Query   string
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("query timed out after %s", e.Timeout)
+}
+
+// Unwrap returns the error of the backend client,
+// context.DeadlineExceeded when the query timeout elapsed.
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,110 @@
+package source
+
+import (
+	"context"
+	"time"
+
+	promModel "github.com/prometheus/common/model"
+)
+
+// Fake is an in-memory MetricsSource. It ignores the query quantile.
+type Fake struct {
+	// Topology vectors by signal
+	Topologies map[Signal]promModel.Vector
+	// Matrices by query without time range and quantile, the direction of
+	// status queries is empty
+	Matrices map[Query]promModel.Matrix
+	// Rate window of every range
+	Window time.Duration
+}
+
+// NewFake creates an empty fake source.
+func NewFake() *Fake {
+	return &Fake{
+		Topologies: make(map[Signal]promModel.Vector),
+		Matrices:   make(map[Query]promModel.Matrix),
+	}
+}
+
+// Topology returns the stored topology of the signal.
+func (f *Fake) Topology(
+	ctx context.Context,
+	signal Signal,
+) (promModel.Vector, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if vector, found := f.Topologies[signal]; found {
+		return vector, nil
+	}
+	return promModel.Vector{}, nil
+}
+
+// RateWindow returns the Window of the fake.
+func (f *Fake) RateWindow(start time.Time, end time.Time) time.Duration {
+	return f.Window
+}
+
+// Edges returns the stored edges within the query's time range.
+func (f *Fake) Edges(
+	ctx context.Context,
+	query Query,
+) (promModel.Matrix, error) {
+	return f.matrix(ctx, query)
+}
+
+// Statuses returns the stored statuses within the query's time range.
+func (f *Fake) Statuses(
+	ctx context.Context,
+	query Query,
+) (promModel.Matrix, error) {
+	query.Direction = ""
+	return f.matrix(ctx, query)
+}
+
+func (f *Fake) matrix(
+	ctx context.Context,
+	query Query,
+) (promModel.Matrix, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	key := Query{
+		Namespace: query.Namespace,
+		Workload:  query.Workload,
+		Direction: query.Direction,
+		Signal:    query.Signal,
+	}
+	return FilterRange(f.Matrices[key], query.Start, query.End), nil
+}
+
+// FilterRange returns the samples between start and end (inclusive).
+// Streams without samples in the range are dropped.
+func FilterRange(
+	matrix promModel.Matrix,
+	start time.Time,
+	end time.Time,
+) promModel.Matrix {
+	from := promModel.TimeFromUnixNano(start.UnixNano())
+	to := promModel.TimeFromUnixNano(end.UnixNano())
+
+	filtered := promModel.Matrix{}
+	for _, sampleStream := range matrix {
+		values := make([]promModel.SamplePair, 0, len(sampleStream.Values))
+		for _, samplePair := range sampleStream.Values {
+			if samplePair.Timestamp.Before(from) ||
+				samplePair.Timestamp.After(to) {
+				continue
+			}
+			values = append(values, samplePair)
+		}
+		if len(values) == 0 {
+			continue
+		}
+		filtered = append(filtered, &promModel.SampleStream{
+			Metric: sampleStream.Metric,
+			Values: values,
+		})
+	}
+	return filtered
+}
@@ -0,0 +1,61 @@
+package source
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	promModel "github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeEdges(t *testing.T) {
+	metric := promModel.Metric{
+		"source_workload":      "productpage-v1",
+		"destination_workload": "details-v1",
+	}
+	fake := NewFake()
+	fake.Matrices[Query{
+		Namespace: "default",
+		Workload:  "productpage-v1",
+		Direction: Downstream,
+	}] = promModel.Matrix{
+		&promModel.SampleStream{
+			Metric: metric,
+			Values: []promModel.SamplePair{
+				{Timestamp: 10000, Value: 1},
+				{Timestamp: 20000, Value: 2},
+				{Timestamp: 30000, Value: 3},
+			},
+		},
+	}
+
+	matrix, err := fake.Edges(context.Background(), Query{
+		Namespace: "default",
+		Workload:  "productpage-v1",
+		Direction: Downstream,
+		Start:     time.Unix(20, 0),
+		End:       time.Unix(30, 0),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, promModel.Matrix{
+		&promModel.SampleStream{
+			Metric: metric,
+			Values: []promModel.SamplePair{
+				{Timestamp: 20000, Value: 2},
+				{Timestamp: 30000, Value: 3},
+			},
+		},
+	}, matrix)
+
+	// Other direction is empty
+	matrix, err = fake.Edges(context.Background(), Query{
+		Namespace: "default",
+		Workload:  "productpage-v1",
+		Direction: Upstream,
+		Start:     time.Unix(20, 0),
+		End:       time.Unix(30, 0),
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, matrix)
+}
@@ -0,0 +1,63 @@
+package source
+
+import (
+	"fmt"
+	"regexp"
+
+	promModel "github.com/prometheus/common/model"
+)
+
+// LabelMatcher matches an Istio label by value or by regular expression.
+type LabelMatcher struct {
+	Label string `yaml:"label"`
+	Value string `yaml:"value,omitempty"`
+	// Anchored RE2 expression, like in PromQL
+	Regex string `yaml:"regex,omitempty"`
+}
+
+// Filters select the series used for the analysis. A series must match
+// every include and none of the exclude matchers.
+type Filters struct {
+	Include []LabelMatcher `yaml:"include"`
+	Exclude []LabelMatcher `yaml:"exclude"`
+}
+
+// DefaultFilters hide the Istio control plane.
+var DefaultFilters = Filters{
+	Exclude: []LabelMatcher{
+		LabelMatcher{Label: "source_app", Value: "mixer"},
+		LabelMatcher{Label: "destination_app", Value: "mixer"},
+		LabelMatcher{Label: "source_app", Value: "telemetry"},
+		LabelMatcher{Label: "destination_app", Value: "telemetry"},
+		LabelMatcher{Label: "source_app", Value: "policy"},
+		LabelMatcher{Label: "destination_app", Value: "policy"},
+	},
+}
+
+// Validate checks the label names and regular expressions.
+func (f Filters) Validate() error {
+	for _, matcher := range append(f.Include, f.Exclude...) {
+		if err := matcher.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m LabelMatcher) validate() error {
+	if !promModel.LabelName(m.Label).IsValid() {
+		return fmt.Errorf("invalid filter label: %q", m.Label)
+	}
+	if m.Value != "" && m.Regex != "" {
+		return fmt.Errorf(
+			"filter of %s label can have either value or regex",
+			m.Label,
+		)
+	}
+	if m.Regex != "" {
+		if _, err := regexp.Compile("^(?:" + m.Regex + ")$"); err != nil {
+			return fmt.Errorf("invalid filter regex of %s label: %s", m.Label, err)
+		}
+	}
+	return nil
+}
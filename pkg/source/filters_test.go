@@ -0,0 +1,42 @@
+package source
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFiltersValidate(t *testing.T) {
+	assert.NoError(t, DefaultFilters.Validate())
+
+	filters := Filters{
+		Include: []LabelMatcher{
+			LabelMatcher{Label: "destination_workload_namespace", Value: "default"},
+		},
+		Exclude: []LabelMatcher{
+			LabelMatcher{Label: "source_app", Regex: "health-.*|load-generator"},
+		},
+	}
+	assert.NoError(t, filters.Validate())
+
+	filters = Filters{
+		Exclude: []LabelMatcher{LabelMatcher{Label: "source-app", Value: "x"}},
+	}
+	assert.EqualError(t, filters.Validate(), `invalid filter label: "source-app"`)
+
+	filters = Filters{
+		Exclude: []LabelMatcher{
+			LabelMatcher{Label: "source_app", Value: "x", Regex: "x"},
+		},
+	}
+	assert.EqualError(
+		t,
+		filters.Validate(),
+		"filter of source_app label can have either value or regex",
+	)
+
+	filters = Filters{
+		Include: []LabelMatcher{LabelMatcher{Label: "source_app", Regex: "("}},
+	}
+	assert.Error(t, filters.Validate())
+}
@@ -0,0 +1,94 @@
+// Package source defines where workload metrics come from.
+package source
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	promModel "github.com/prometheus/common/model"
+)
+
+// Direction of the edges relative to the queried workload.
+type Direction string
+
+const (
+	// Downstream edges are requests made by the workload.
+	Downstream Direction = "downstream"
+	// Upstream edges are requests received by the workload.
+	Upstream Direction = "upstream"
+)
+
+// Signal is the measured value of a query.
+type Signal string
+
+const (
+	// Latency is the request duration quantile, the default signal.
+	Latency Signal = ""
+	// ErrorRate is the ratio of 5xx responses.
+	ErrorRate Signal = "errors"
+	// RequestRate is the number of requests per second.
+	RequestRate Signal = "traffic"
+	// ConnectionChurn is the number of opened and closed TCP connections
+	// per second.
+	ConnectionChurn Signal = "connections"
+	// Throughput is the number of sent and received TCP bytes per second.
+	Throughput Signal = "throughput"
+	// GRPCErrorRate is the ratio of gRPC calls with non-OK status.
+	GRPCErrorRate Signal = "grpc-errors"
+	// ReporterGap is the request duration quantile reported by the source
+	// minus the one reported by the destination, only for edges.
+	ReporterGap Signal = "reporter-gap"
+)
+
+// DefaultQuantile of the request durations
+const DefaultQuantile = 0.95
+
+// Query describes a range query for a single workload.
+type Query struct {
+	// Workloads of all namespaces are selected when empty
+	Namespace string
+	Workload  string
+	Direction Direction
+	Signal    Signal
+	// Quantile of the request durations, DefaultQuantile when zero
+	Quantile float64
+	Start    time.Time
+	End      time.Time
+	// Window of rate(), set by the source from RateWindow
+	RateWindow time.Duration
+}
+
+// MetricsSource provides the metrics the models are built from.
+// Implementations abort in-flight queries when the context is done.
+type MetricsSource interface {
+	// Topology returns the signal between source and destination
+	// workloads, request and TCP connection rates for RequestRate.
+	Topology(ctx context.Context, signal Signal) (promModel.Vector, error)
+	// Edges returns the signal of the workload's edges in the direction of
+	// the query, one sample stream per edge.
+	Edges(ctx context.Context, query Query) (promModel.Matrix, error)
+	// Statuses returns the signal of the workload itself.
+	Statuses(ctx context.Context, query Query) (promModel.Matrix, error)
+	// RateWindow returns the window rates are calculated over in the range
+	// queries between start and end.
+	RateWindow(start time.Time, end time.Time) time.Duration
+}
+
+// FormatRateWindow formats the rate window as a Prometheus duration in
+// seconds rounded up, empty when the window is zero.
+func FormatRateWindow(window time.Duration) string {
+	if window == 0 {
+		return ""
+	}
+	seconds := (window + time.Second - 1) / time.Second
+	return fmt.Sprintf("%ds", int64(seconds))
+}
+
+// Stepper is implemented by the sources evaluating the range queries at a
+// step.
+type Stepper interface {
+	// QueryStep returns the step of the range queries between start and
+	// end.
+	QueryStep(start time.Time, end time.Time) time.Duration
+}
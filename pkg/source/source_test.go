@@ -0,0 +1,17 @@
+package source
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatRateWindow(t *testing.T) {
+	assert.Equal(t, "", FormatRateWindow(0))
+	assert.Equal(t, "60s", FormatRateWindow(time.Minute))
+	assert.Equal(t, "90s", FormatRateWindow(90*time.Second))
+	// Fractional windows are rounded up
+	assert.Equal(t, "2s", FormatRateWindow(1500*time.Millisecond))
+	assert.Equal(t, "1s", FormatRateWindow(400*time.Millisecond))
+}
@@ -0,0 +1,47 @@
+package source
+
+import (
+	"context"
+	"sync"
+)
+
+// Warnings collects the warnings of the queries made with a context, like
+// partial responses. It is safe to use from multiple goroutines.
+type Warnings struct {
+	mu       sync.Mutex
+	warnings []string
+	seen     map[string]bool
+}
+
+type warningsKey struct{}
+
+// WithWarnings returns a context collecting the warnings of its queries.
+func WithWarnings(ctx context.Context) (context.Context, *Warnings) {
+	warnings := &Warnings{seen: make(map[string]bool)}
+	return context.WithValue(ctx, warningsKey{}, warnings), warnings
+}
+
+// AddWarnings adds the warnings to the collector of the context, it is a
+// no-op without collector.
+func AddWarnings(ctx context.Context, warnings ...string) {
+	collector, ok := ctx.Value(warningsKey{}).(*Warnings)
+	if !ok {
+		return
+	}
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	for _, warning := range warnings {
+		if collector.seen[warning] {
+			continue
+		}
+		collector.seen[warning] = true
+		collector.warnings = append(collector.warnings, warning)
+	}
+}
+
+// List returns the distinct warnings in the order they were added.
+func (w *Warnings) List() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string{}, w.warnings...)
+}
@@ -0,0 +1,25 @@
+package source
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWarnings(t *testing.T) {
+	// No-op without collector
+	AddWarnings(context.Background(), "dropped")
+
+	ctx, warnings := WithWarnings(context.Background())
+	assert.Equal(t, []string{}, warnings.List())
+
+	AddWarnings(ctx, "partial response")
+	AddWarnings(ctx, "partial response", "too many samples")
+
+	assert.Equal(
+		t,
+		[]string{"partial response", "too many samples"},
+		warnings.List(),
+	)
+}
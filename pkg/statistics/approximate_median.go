@@ -1,17 +1,11 @@
 package statistics
 
-import "sort"
-
-// ApproximateMedian TODO: normal median for now
+// ApproximateMedian estimates the median of the values with a GK summary
+// of DefaultEpsilon rank error. The values are not modified.
 func ApproximateMedian(values Measurements) float64 {
-	sort.Sort(values)
-
-	length := len(values)
-	middle := length / 2
-
-	if length%2 == 1 {
-		return values[middle]
+	estimator := NewGK(0.5, DefaultEpsilon)
+	for _, value := range values {
+		estimator.Add(value)
 	}
-
-	return (values[middle-1] + values[middle]) / 2
+	return estimator.Quantile()
 }
@@ -0,0 +1,45 @@
+package statistics
+
+import "math"
+
+// Moments calculates the mean and the standard deviation of a stream of
+// values in constant memory (Welford's algorithm).
+type Moments struct {
+	n    int
+	mean float64
+	// Sum of the squared differences from the mean
+	m2 float64
+}
+
+// Add adds a value of the stream, NaN values are skipped.
+func (m *Moments) Add(value float64) {
+	if math.IsNaN(value) {
+		return
+	}
+	m.n++
+	delta := value - m.mean
+	m.mean += delta / float64(m.n)
+	m.m2 += delta * (value - m.mean)
+}
+
+// Count returns the number of added values.
+func (m *Moments) Count() int {
+	return m.n
+}
+
+// Mean returns the mean, NaN without values.
+func (m *Moments) Mean() float64 {
+	if m.n == 0 {
+		return math.NaN()
+	}
+	return m.mean
+}
+
+// StdDev returns the sample standard deviation, NaN with less than two
+// values.
+func (m *Moments) StdDev() float64 {
+	if m.n < 2 {
+		return math.NaN()
+	}
+	return math.Sqrt(m.m2 / float64(m.n-1))
+}
@@ -0,0 +1,27 @@
+package statistics
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMoments(t *testing.T) {
+	moments := Moments{}
+	assert.True(t, math.IsNaN(moments.Mean()))
+
+	moments.Add(10)
+	assert.Equal(t, 10.0, moments.Mean())
+	assert.True(t, math.IsNaN(moments.StdDev()))
+
+	values := Measurements{10, 12, 23, 23, 16, 23, 21, 16}
+	for _, value := range values[1:] {
+		moments.Add(value)
+	}
+	moments.Add(math.NaN())
+
+	assert.Equal(t, 8, moments.Count())
+	assert.InDelta(t, 18.0, moments.Mean(), 1e-12)
+	assert.InDelta(t, math.Sqrt(192.0/7), moments.StdDev(), 1e-12)
+}
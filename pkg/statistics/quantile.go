@@ -0,0 +1,196 @@
+package statistics
+
+import (
+	"math"
+	"sort"
+)
+
+// DefaultEpsilon is the rank error of the approximate median, streams up to
+// 1/(2*DefaultEpsilon) values are summarized exactly.
+const DefaultEpsilon = 0.005
+
+// QuantileEstimator estimates a quantile of a stream of values in bounded
+// memory.
+type QuantileEstimator interface {
+	// Add adds a value of the stream, NaN values are skipped
+	Add(value float64)
+	// Count returns the number of added values
+	Count() int
+	// Quantile returns the estimate, NaN without values
+	Quantile() float64
+	// Bounds returns the values the exact quantile is between
+	Bounds() (lower float64, upper float64)
+	// RankError returns the maximum rank error of the estimate as a
+	// fraction of Count
+	RankError() float64
+}
+
+// GK is the Greenwald-Khanna quantile summary. It keeps
+// O(1/epsilon * log(epsilon*n)) values of a stream of n values, the rank
+// of the estimate is within epsilon*n of the rank of the exact quantile.
+type GK struct {
+	quantile float64
+	epsilon  float64
+	n        int
+	tuples   []gkTuple
+	// Values added since the last compression
+	inserted int
+}
+
+// Summarized value, g is the rank difference to the previous tuple, delta
+// is the uncertainty of the rank
+type gkTuple struct {
+	value float64
+	g     int
+	delta int
+}
+
+// NewGK creates a summary of the quantile (0-1) with the rank error
+// epsilon.
+func NewGK(quantile float64, epsilon float64) *GK {
+	return &GK{quantile: quantile, epsilon: epsilon}
+}
+
+// Add adds a value of the stream, NaN values are skipped.
+func (e *GK) Add(value float64) {
+	if math.IsNaN(value) {
+		return
+	}
+
+	i := sort.Search(len(e.tuples), func(i int) bool {
+		return e.tuples[i].value > value
+	})
+	tuple := gkTuple{value: value, g: 1}
+	// The minimum and the maximum have exact ranks
+	if i > 0 && i < len(e.tuples) {
+		tuple.delta = e.threshold()
+	}
+	e.tuples = append(e.tuples, gkTuple{})
+	copy(e.tuples[i+1:], e.tuples[i:])
+	e.tuples[i] = tuple
+	e.n++
+
+	e.inserted++
+	if period := int(1 / (2 * e.epsilon)); e.inserted >= period {
+		e.compress()
+		e.inserted = 0
+	}
+}
+
+// Count returns the number of added values.
+func (e *GK) Count() int {
+	return e.n
+}
+
+// Quantile returns the estimated quantile, interpolated between the values
+// around its rank like the exact median of an even number of values. It is
+// NaN without values.
+func (e *GK) Quantile() float64 {
+	if e.n == 0 {
+		return math.NaN()
+	}
+	position := e.quantile * float64(e.n-1)
+	rank := int(position) + 1
+	value := e.valueAtRank(rank)
+	if fraction := position - float64(rank-1); fraction > 0 {
+		value += fraction * (e.valueAtRank(rank+1) - value)
+	}
+	return value
+}
+
+// Bounds returns the values the exact quantile is between, the values
+// epsilon*n ranks below and above the estimate.
+func (e *GK) Bounds() (float64, float64) {
+	if e.n == 0 {
+		return math.NaN(), math.NaN()
+	}
+	position := e.quantile * float64(e.n-1)
+	rankError := e.epsilon * float64(e.n)
+	lower := int(math.Floor(position + 1 - rankError))
+	upper := int(math.Ceil(position + 1 + rankError))
+	return e.valueAtRank(lower), e.valueAtRank(upper)
+}
+
+// RankError returns epsilon.
+func (e *GK) RankError() float64 {
+	return e.epsilon
+}
+
+// MedianAbsoluteDeviation approximates the median of the absolute
+// deviations from the estimated quantile, every summarized value stands for
+// the values merged into it. It is NaN without values.
+func (e *GK) MedianAbsoluteDeviation() float64 {
+	if e.n == 0 {
+		return math.NaN()
+	}
+	center := e.Quantile()
+	deviations := make([]gkTuple, len(e.tuples))
+	for i, tuple := range e.tuples {
+		deviations[i] = gkTuple{value: math.Abs(tuple.value - center), g: tuple.g}
+	}
+	sort.Slice(deviations, func(i, j int) bool {
+		return deviations[i].value < deviations[j].value
+	})
+
+	rank := 0
+	for _, deviation := range deviations {
+		rank += deviation.g
+		if 2*rank >= e.n {
+			return deviation.value
+		}
+	}
+	return deviations[len(deviations)-1].value
+}
+
+// Maximum g + delta of a tuple
+func (e *GK) threshold() int {
+	return int(2 * e.epsilon * float64(e.n))
+}
+
+// Value of the given rank (1-n) within epsilon*n ranks
+func (e *GK) valueAtRank(rank int) float64 {
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > e.n {
+		rank = e.n
+	}
+	bound := float64(rank) + e.epsilon*float64(e.n)
+	minRank := 0
+	for i := 0; i < len(e.tuples)-1; i++ {
+		minRank += e.tuples[i].g
+		next := e.tuples[i+1]
+		if float64(minRank+next.g+next.delta) > bound {
+			return e.tuples[i].value
+		}
+	}
+	return e.tuples[len(e.tuples)-1].value
+}
+
+// Merges the neighbour tuples whose rank uncertainty stays within the
+// threshold, the minimum is kept
+func (e *GK) compress() {
+	if len(e.tuples) < 3 {
+		return
+	}
+	threshold := e.threshold()
+
+	merged := make([]gkTuple, 0, len(e.tuples))
+	current := e.tuples[len(e.tuples)-1]
+	for i := len(e.tuples) - 2; i >= 1; i-- {
+		tuple := e.tuples[i]
+		if tuple.g+current.g+current.delta <= threshold {
+			current.g += tuple.g
+			continue
+		}
+		merged = append(merged, current)
+		current = tuple
+	}
+	merged = append(merged, current, e.tuples[0])
+
+	// Back to ascending order
+	for i, j := 0, len(merged)-1; i < j; i, j = i+1, j-1 {
+		merged[i], merged[j] = merged[j], merged[i]
+	}
+	e.tuples = merged
+}
@@ -0,0 +1,132 @@
+package statistics
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Exact quantile, interpolated between the values around its rank
+func exactQuantile(values []float64, quantile float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	position := quantile * float64(len(sorted)-1)
+	lower := int(position)
+	if lower == len(sorted)-1 {
+		return sorted[lower]
+	}
+	fraction := position - float64(lower)
+	return sorted[lower] + fraction*(sorted[lower+1]-sorted[lower])
+}
+
+// Rank of the value in the sorted values, the range of ranks for
+// duplicates
+func ranks(sorted []float64, value float64) (int, int) {
+	first := sort.SearchFloat64s(sorted, value)
+	last := sort.Search(len(sorted), func(i int) bool {
+		return sorted[i] > value
+	})
+	return first + 1, last
+}
+
+func TestGKExactForShortStreams(t *testing.T) {
+	estimator := NewGK(0.5, DefaultEpsilon)
+	assert.True(t, math.IsNaN(estimator.Quantile()))
+
+	for _, value := range []float64{3, 1, math.NaN(), 2} {
+		estimator.Add(value)
+	}
+	assert.Equal(t, 3, estimator.Count())
+	assert.Equal(t, 2.0, estimator.Quantile())
+
+	estimator.Add(4)
+	assert.Equal(t, 2.5, estimator.Quantile())
+	lower, upper := estimator.Bounds()
+	assert.Equal(t, 2.0, lower)
+	assert.Equal(t, 3.0, upper)
+}
+
+func TestGKAccuracy(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	streams := map[string]func(i int) float64{
+		"uniform":   func(i int) float64 { return random.Float64() },
+		"normal":    func(i int) float64 { return random.NormFloat64()*10 + 100 },
+		"lognormal": func(i int) float64 { return math.Exp(random.NormFloat64()) },
+		"ascending": func(i int) float64 { return float64(i) },
+		"duplicates": func(i int) float64 {
+			return float64(random.Intn(10))
+		},
+	}
+
+	for name, next := range streams {
+		for _, quantile := range []float64{0.5, 0.95} {
+			for _, epsilon := range []float64{0.01, DefaultEpsilon} {
+				estimator := NewGK(quantile, epsilon)
+				values := make([]float64, 0, 20000)
+				for i := 0; i < 20000; i++ {
+					value := next(i)
+					values = append(values, value)
+					estimator.Add(value)
+				}
+				sorted := append([]float64(nil), values...)
+				sort.Float64s(sorted)
+
+				// Rank of the estimate is within the rank error
+				estimate := estimator.Quantile()
+				exactRank := quantile*float64(len(values)-1) + 1
+				rankError := epsilon * float64(len(values))
+				first, last := ranks(sorted, estimator.valueAtRank(int(exactRank)))
+				assert.True(
+					t,
+					float64(last) >= exactRank-rankError-1 &&
+						float64(first) <= exactRank+rankError+1,
+					"%s q%v e%v: rank %d-%d, expected %v±%v",
+					name, quantile, epsilon, first, last, exactRank, rankError,
+				)
+
+				// Bounds contain the exact quantile and the estimate
+				exact := exactQuantile(values, quantile)
+				lower, upper := estimator.Bounds()
+				assert.True(t, lower <= exact && exact <= upper, "%s q%v e%v: %v not in [%v, %v]", name, quantile, epsilon, exact, lower, upper)
+				assert.True(t, lower <= estimate && estimate <= upper, name)
+
+				// Memory is bounded
+				assert.True(
+					t,
+					len(estimator.tuples) < len(values)/10,
+					"%s: %d tuples",
+					name,
+					len(estimator.tuples),
+				)
+			}
+		}
+	}
+}
+
+func TestGKMedianAbsoluteDeviation(t *testing.T) {
+	estimator := NewGK(0.5, DefaultEpsilon)
+	assert.True(t, math.IsNaN(estimator.MedianAbsoluteDeviation()))
+	for _, value := range []float64{1, 1, 2, 2, 4, 6, 9} {
+		estimator.Add(value)
+	}
+	assert.Equal(t, 1.0, estimator.MedianAbsoluteDeviation())
+
+	// 0.6745 standard deviations of normal values
+	random := rand.New(rand.NewSource(42))
+	estimator = NewGK(0.5, DefaultEpsilon)
+	for i := 0; i < 20000; i++ {
+		estimator.Add(random.NormFloat64()*10 + 100)
+	}
+	assert.InDelta(t, 6.745, estimator.MedianAbsoluteDeviation(), 0.2)
+}
+
+func BenchmarkGKAdd(b *testing.B) {
+	random := rand.New(rand.NewSource(42))
+	estimator := NewGK(0.5, DefaultEpsilon)
+	for i := 0; i < b.N; i++ {
+		estimator.Add(random.Float64())
+	}
+}